@@ -15,8 +15,8 @@ const TIME_FORMAT = "2006-01-02 15:04:05"
 var BaseDir string
 
 type Configuration struct {
-	OnlineDSN        *dsn `yaml:"online-dsn"`     // 线上环境数据库配置
-	TestDSN          *dsn `yaml:"test-dsn"`       // 测试环境数据库配置
+	OnlineDSN        *DSN `yaml:"online-dsn"`     // 线上环境数据库配置
+	TestDSN          *DSN `yaml:"test-dsn"`       // 测试环境数据库配置
 	MysqlConnTimeOut int  `yaml:"conn-time-out"`  // 数据库连接超时时间，单位秒
 	QueryTimeOut     int  `yaml:"query-time-out"` // 数据库SQL执行超时时间，单位秒
 
@@ -42,13 +42,13 @@ type Configuration struct {
 }
 
 var Config = &Configuration{
-	OnlineDSN: &dsn{
+	OnlineDSN: &DSN{
 		Schema:  "information_schema",
 		Charset: "utf8mb4",
 		Disable: true,
 		Version: 99999,
 	},
-	TestDSN: &dsn{
+	TestDSN: &DSN{
 		Schema:  "information_schema",
 		Charset: "utf8mb4",
 		Disable: true,
@@ -98,13 +98,22 @@ type rpcdsn struct {
 	Hostname          string `yaml:"hostname"`
 	ConnectionTimeout int    `yaml:"connection-timeout"`
 }
-type dsn struct {
+type DSN struct {
 	Addr     string `yaml:"addr"`
 	Schema   string `yaml:"schema"`
 	User     string `yaml:"user"`
 	Password string `yaml:"password"`
 	Charset  string `yaml:"charset"`
 	Disable  bool   `yaml:"disable"`
+
+	ConnectTimeout int               `yaml:"connect-timeout"` // 建立连接超时时间，单位秒，0为驱动默认值
+	ReadTimeout    int               `yaml:"read-timeout"`    // 读超时时间，单位秒，0为不超时
+	WriteTimeout   int               `yaml:"write-timeout"`   // 写超时时间，单位秒，0为不超时
+	TLS            string            `yaml:"tls"`             // TLS模式：空、false、true、skip-verify、preferred或已注册的配置名
+	Collation      string            `yaml:"collation"`       // 连接排序规则，为空时使用驱动默认值
+	Loc            string            `yaml:"loc"`             // 时间解析使用的时区，默认Local
+	ParseTime      bool              `yaml:"parse-time"`      // DATE、DATETIME是否解析为time.Time
+	Params         map[string]string `yaml:"params"`          // 其他连接参数，如sql_mode、autocommit
 	//版本自动检查，不可配置
 	Version int `yaml:"-"`
 }
@@ -0,0 +1,119 @@
+package log
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// 配置错误，Field为出错的配置项
+type ConfigError struct {
+	Field  string
+	Value  interface{}
+	Reason string
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("invalid config %v=[%v]: %v", e.Field, e.Value, e.Reason)
+}
+
+// 校验数据库连接配置
+func (d *DSN) Validate() error {
+	if d == nil {
+		return &ConfigError{Field: "dsn", Reason: "dsn is nil"}
+	}
+	if "" == d.Addr {
+		return &ConfigError{Field: "addr", Value: d.Addr, Reason: "addr is required"}
+	}
+	if host, port, err := net.SplitHostPort(d.Addr); err == nil {
+		if "" == host {
+			return &ConfigError{Field: "addr", Value: d.Addr, Reason: "host is empty"}
+		}
+		if n, err := strconv.Atoi(port); err != nil || n <= 0 || n > 65535 {
+			return &ConfigError{Field: "addr", Value: d.Addr, Reason: "invalid port"}
+		}
+	}
+	if "" == d.User {
+		return &ConfigError{Field: "user", Value: d.User, Reason: "user is required"}
+	}
+	timeouts := []struct {
+		field string
+		value int
+	}{
+		{"connect-timeout", d.ConnectTimeout},
+		{"read-timeout", d.ReadTimeout},
+		{"write-timeout", d.WriteTimeout},
+	}
+	for _, timeout := range timeouts {
+		if timeout.value < 0 {
+			return &ConfigError{Field: timeout.field, Value: timeout.value, Reason: "timeout must not be negative"}
+		}
+	}
+	if "" != d.Loc {
+		if _, err := time.LoadLocation(d.Loc); err != nil {
+			return &ConfigError{Field: "loc", Value: d.Loc, Reason: err.Error()}
+		}
+	}
+	for key := range d.Params {
+		if "" == key {
+			return &ConfigError{Field: "params", Value: key, Reason: "param name is empty"}
+		}
+	}
+	return nil
+}
+
+/*
+ * 转换为驱动的连接配置
+ * 密码等字段中的@、/、%等特殊字符由驱动处理，不需要转义
+ */
+func (d *DSN) MysqlConfig() (*mysql.Config, error) {
+	if err := d.Validate(); err != nil {
+		return nil, err
+	}
+	cfg := mysql.NewConfig()
+	cfg.User = d.User
+	cfg.Passwd = d.Password
+	cfg.Net = "tcp"
+	cfg.Addr = d.Addr
+	cfg.DBName = d.Schema
+	cfg.ParseTime = d.ParseTime
+	cfg.TLSConfig = d.TLS
+	cfg.Timeout = time.Duration(d.ConnectTimeout) * time.Second
+	cfg.ReadTimeout = time.Duration(d.ReadTimeout) * time.Second
+	cfg.WriteTimeout = time.Duration(d.WriteTimeout) * time.Second
+	if "" != d.Collation {
+		cfg.Collation = d.Collation
+	}
+	cfg.Loc = time.Local
+	if "" != d.Loc {
+		cfg.Loc, _ = time.LoadLocation(d.Loc)
+	}
+	if "" != d.Charset || len(d.Params) > 0 {
+		cfg.Params = make(map[string]string, len(d.Params)+1)
+		for key, value := range d.Params {
+			cfg.Params[key] = value
+		}
+		if "" != d.Charset {
+			cfg.Params["charset"] = d.Charset
+		}
+	}
+	return cfg, nil
+}
+
+/*
+ * 生成go-sql-driver/mysql格式的连接串
+ *
+ *EXAMPLE:
+ *	dataSource, err := log.Config.OnlineDSN.FormatDSN()
+ *	db, err := sql.Open("mysql", dataSource)
+ */
+func (d *DSN) FormatDSN() (string, error) {
+	cfg, err := d.MysqlConfig()
+	if err != nil {
+		return "", err
+	}
+	return cfg.FormatDSN(), nil
+}
@@ -0,0 +1,70 @@
+package log
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+func TestFormatDSN(t *testing.T) {
+	dsn := &DSN{
+		Addr:           "127.0.0.1:3306",
+		Schema:         "monitor",
+		User:           "root",
+		Password:       "p@ss/w%rd",
+		Charset:        "utf8mb4",
+		ConnectTimeout: 3,
+		ReadTimeout:    30,
+		WriteTimeout:   30,
+		TLS:            "skip-verify",
+		Collation:      "utf8mb4_bin",
+		Loc:            "Asia/Shanghai",
+		ParseTime:      true,
+		Params:         map[string]string{"sql_mode": "'STRICT_ALL_TABLES'"},
+	}
+	dataSource, err := dsn.FormatDSN()
+	if err != nil {
+		t.Fatalf("FormatDSN fail. err=[%v]", err)
+	}
+	cfg, err := mysql.ParseDSN(dataSource)
+	if err != nil {
+		t.Fatalf("ParseDSN fail. dsn=[%v] err=[%v]", dataSource, err)
+	}
+	if "root" != cfg.User || "p@ss/w%rd" != cfg.Passwd || "127.0.0.1:3306" != cfg.Addr || "monitor" != cfg.DBName {
+		t.Errorf("unexpected account. cfg=[%+v]", cfg)
+	}
+	if 3*time.Second != cfg.Timeout || 30*time.Second != cfg.ReadTimeout || 30*time.Second != cfg.WriteTimeout {
+		t.Errorf("unexpected timeouts. cfg=[%+v]", cfg)
+	}
+	if "skip-verify" != cfg.TLSConfig || "utf8mb4_bin" != cfg.Collation || "Asia/Shanghai" != cfg.Loc.String() || !cfg.ParseTime {
+		t.Errorf("unexpected options. cfg=[%+v]", cfg)
+	}
+	if "utf8mb4" != cfg.Params["charset"] || "'STRICT_ALL_TABLES'" != cfg.Params["sql_mode"] {
+		t.Errorf("unexpected params. params=[%v]", cfg.Params)
+	}
+}
+
+func TestDSNValidate(t *testing.T) {
+	cases := map[string]*DSN{
+		"addr":            {User: "root"},
+		"user":            {Addr: "127.0.0.1:3306"},
+		"read-timeout":    {Addr: "127.0.0.1:3306", User: "root", ReadTimeout: -1},
+		"loc":             {Addr: "127.0.0.1:3306", User: "root", Loc: "Mars/Base"},
+		"params":          {Addr: "127.0.0.1:3306", User: "root", Params: map[string]string{"": "1"}},
+		"connect-timeout": {Addr: "127.0.0.1:3306", User: "root", ConnectTimeout: -3},
+	}
+	for field, dsn := range cases {
+		_, err := dsn.FormatDSN()
+		configErr, ok := err.(*ConfigError)
+		if !ok || field != configErr.Field {
+			t.Errorf("expect config error of [%v]. err=[%v]", field, err)
+		}
+	}
+	if _, err := (&DSN{Addr: "127.0.0.1:port", User: "root"}).FormatDSN(); err == nil {
+		t.Errorf("invalid port should be rejected")
+	}
+	if _, err := (&DSN{Addr: "db.local", User: "root"}).FormatDSN(); err != nil {
+		t.Errorf("addr without port should be accepted. err=[%v]", err)
+	}
+}
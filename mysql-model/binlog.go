@@ -0,0 +1,46 @@
+package dao
+
+import (
+	"fmt"
+	"go-tools/log"
+	"go-tools/mysql"
+)
+
+//取db_instances中与主库同集群、同分片的其他实例位置点
+//只排除主库自身(InstanceId相同)，双主中的另一个主库同样从该主库复制，需要参与计算
+func ReplicaPositions(master DbInstance, instances []DbInstance) []mysql.ReplicaPosition {
+	var positions []mysql.ReplicaPosition
+	for _, instance := range instances {
+		if instance.ClusterId != master.ClusterId || instance.NodeId != master.NodeId ||
+			instance.InstanceId == master.InstanceId {
+			continue
+		}
+		positions = append(positions, mysql.ReplicaPosition{
+			Name:     fmt.Sprintf("%v:%v", instance.Ip, instance.Port),
+			File:     instance.File,
+			Position: instance.Position,
+		})
+	}
+	return positions
+}
+
+//根据db_instances中记录的从库File/Position生成主库的binlog清理计划
+//instances为db_instances中的实例，通常为ReadAllInstance()的结果
+//*EXAMPLE:
+//*        instances, err := new(DbInstance).ReadAllInstance()
+//*        plan, err := PlanMasterBinlogPurge(pool, master, instances, mysql.PurgeOptions{MinRetainFiles: 5})
+//*        err = pool.PurgeBinaryLogs(plan, dryRun)
+//
+func PlanMasterBinlogPurge(pool *mysql.DBPool, master DbInstance, instances []DbInstance,
+	opts mysql.PurgeOptions) (mysql.PurgePlan, error) {
+	replicas := ReplicaPositions(master, instances)
+	plan, err := pool.PlanBinlogPurge(replicas, opts)
+	if err != nil {
+		log.Log.Warn("Plan binlog purge failed! master=[%v:%v], replicas=[%+v], error=[%v].",
+			master.Ip, master.Port, replicas, err)
+		return plan, err
+	}
+	log.Log.Info("Plan binlog purge. master=[%v:%v], purge_to=[%v], oldest_needed=[%v], needed_by=[%v], reason=[%v].",
+		master.Ip, master.Port, plan.PurgeTo, plan.OldestNeeded, plan.NeededBy, plan.Reason)
+	return plan, nil
+}
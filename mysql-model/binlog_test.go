@@ -0,0 +1,31 @@
+package dao
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestReplicaPositions(t *testing.T) {
+	Convey("只取同分片的从库位置点", t, func() {
+		instances := newElectionInstances()
+		instances[1].Ip, instances[1].Port = "10.0.0.2", 3306
+		positions := ReplicaPositions(instances[0], instances)
+
+		So(len(positions), ShouldEqual, 4)
+		So(positions[0].Name, ShouldEqual, "10.0.0.2:3306")
+		So(positions[0].File, ShouldEqual, "mysql-bin.000010")
+		So(positions[0].Position, ShouldEqual, 300)
+	})
+
+	Convey("双主中另一个主库的位置点参与计算", t, func() {
+		master := DbInstance{InstanceId: 1, ClusterId: 1, NodeId: 1, Ip: "10.0.0.1", Port: 3306, Role: Role_Master,
+			File: "mysql-bin.000020", Position: 100}
+		peer := DbInstance{InstanceId: 2, ClusterId: 1, NodeId: 1, Ip: "10.0.0.2", Port: 3306, Role: Role_Master,
+			File: "mysql-bin.000012", Position: 400}
+		positions := ReplicaPositions(master, []DbInstance{master, peer})
+
+		So(len(positions), ShouldEqual, 1)
+		So(positions[0].Name, ShouldEqual, "10.0.0.2:3306")
+		So(positions[0].File, ShouldEqual, "mysql-bin.000012")
+	})
+}
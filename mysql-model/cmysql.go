@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"github.com/astaxie/beego/orm"
 	"go-tools/log"
+	"go-tools/mysql"
 	"reflect"
 )
 
@@ -654,10 +655,10 @@ func RawExecSql(ptrOrmer orm.Ormer, sql string, args ...interface{}) (sql.Result
 
 	result, err := rawSet.Exec()
 	if err != nil {
-		log.Log.Warn("Execute non query sql failed! Sql=[%v] args=[%v] Err=[%v]", sql, args, err)
+		log.Log.Warn("Execute non query sql failed! Sql=[%v] Fingerprint=[%v] args=[%v] Err=[%v]", sql, mysql.Fingerprint(sql), args, err)
 	}
 
-	log.Log.Debug("Execute non query sql successfully. Sql=[%v] args=[%v]", sql, args)
+	log.Log.Debug("Execute non query sql successfully. Sql=[%v] Fingerprint=[%v] args=[%v]", sql, mysql.Fingerprint(sql), args)
 	return result, err
 }
 
@@ -674,10 +675,10 @@ func RawQueryRow(ptrOrmer orm.Ormer, rst interface{}, sql string, args ...interf
 	err := rawSet.QueryRow(rst)
 
 	if err != nil {
-		log.Log.Warn("Execute query sql failed! Sql=[%v] args=[%v] Err=[%v]", sql, args, err)
+		log.Log.Warn("Execute query sql failed! Sql=[%v] Fingerprint=[%v] args=[%v] Err=[%v]", sql, mysql.Fingerprint(sql), args, err)
 	}
 
-	log.Log.Debug("Execute query sql successfully. Sql=[%v] args=[%v]", sql, args)
+	log.Log.Debug("Execute query sql successfully. Sql=[%v] Fingerprint=[%v] args=[%v]", sql, mysql.Fingerprint(sql), args)
 	return err
 }
 
@@ -693,10 +694,10 @@ func RawQueryRows(ptrOrmer orm.Ormer, rst interface{}, sql string, args ...inter
 
 	retNum, err := rawSet.QueryRows(rst)
 	if err != nil {
-		log.Log.Warn("Execute query sql failed! Sql=[%v] args=[%v] Err=[%v]", sql, args, err)
+		log.Log.Warn("Execute query sql failed! Sql=[%v] Fingerprint=[%v] args=[%v] Err=[%v]", sql, mysql.Fingerprint(sql), args, err)
 	}
 
-	log.Log.Debug("Execute query sql successfully. Sql=[%v] args=[%v]", sql, args)
+	log.Log.Debug("Execute query sql successfully. Sql=[%v] Fingerprint=[%v] args=[%v]", sql, mysql.Fingerprint(sql), args)
 	return retNum, err
 }
 
@@ -0,0 +1,240 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-tools/log"
+	"go-tools/mysql"
+	"sync"
+	"time"
+)
+
+//实例探测结果
+type ProbeResult struct {
+	File            string // 从库为已执行的主库binlog文件，主库为自身binlog文件
+	Position        int64
+	ExecutedGtidSet string
+}
+
+//实例探测接口，默认实现为DBPoolProber，测试时可替换为不依赖MySQL的实现
+type InstanceProber interface {
+	Probe(ctx context.Context, instance DbInstance) (ProbeResult, error)
+}
+
+//实例读写接口，默认实现读写db_instances表
+type InstanceStore interface {
+	ReadAllInstance() ([]DbInstance, error)
+	UpdateInstance(instance *DbInstance, cols []string) error
+}
+
+//基于db_instances表的InstanceStore实现
+type ormInstanceStore struct{}
+
+func (s ormInstanceStore) ReadAllInstance() ([]DbInstance, error) {
+	return new(DbInstance).ReadAllInstance()
+}
+
+func (s ormInstanceStore) UpdateInstance(instance *DbInstance, cols []string) error {
+	_, err := instance.UpdateByIndexs(cols)
+	return err
+}
+
+//基于mysql.DBPool的实例探测
+//GetPool根据实例信息返回连接池，由调用方负责连接池的创建与复用
+type DBPoolProber struct {
+	GetPool func(instance DbInstance) (*mysql.DBPool, error)
+}
+
+//从库取show slave status中已执行的主库位置点，主库取show master status
+//查询使用ctx，采集器取消或单个实例探测超时时中断正在执行的查询
+func (p *DBPoolProber) Probe(ctx context.Context, instance DbInstance) (result ProbeResult, err error) {
+	if err = ctx.Err(); err != nil {
+		return result, err
+	}
+	pool, err := p.GetPool(instance)
+	if err != nil {
+		return result, err
+	}
+	slaveStatus, err := pool.QuerySlaveStatusContext(ctx, nil)
+	if err != nil {
+		return result, err
+	}
+	if slaveStatus.Master_Host != "" {
+		result.File = slaveStatus.Relay_Master_Log_File
+		result.Position = slaveStatus.Exec_Master_Log_Pos
+		result.ExecutedGtidSet = slaveStatus.Executed_Gtid_Set
+		return result, ctx.Err()
+	}
+	masterStatus, err := pool.QueryMasterStatusContext(ctx, nil)
+	if err != nil {
+		return result, err
+	}
+	result.File = masterStatus.File
+	result.Position = masterStatus.Position
+	result.ExecutedGtidSet = masterStatus.Executed_Gtid_Set
+	return result, ctx.Err()
+}
+
+//实例心跳采集器
+//周期性探测db_instances中的全部实例，成功时更新HeartBeat、File、Position、ExecutedGtidSet并清零ExceptionNums，
+//ExecutedGtidSet无法解析或超出字段长度时不更新该字段，
+//失败时ExceptionNums加1
+type HeartbeatCollector struct {
+	Prober       InstanceProber
+	Store        InstanceStore
+	Interval     time.Duration // 采集周期
+	ProbeTimeout time.Duration // 单个实例探测超时时间
+	WorkerNumber int           // 并发探测的协程数
+
+	now func() time.Time
+}
+
+//单轮采集结果
+type CollectSummary struct {
+	Total     int
+	Succeeded int
+	Failed    int
+}
+
+//使用log.Config中的WorkerNumber、QueryTimeOut初始化采集器
+//*EXAMPLE:
+//*        prober := &DBPoolProber{GetPool: func(instance DbInstance) (*mysql.DBPool, error) {...}}
+//*        collector := NewHeartbeatCollector(prober, 10*time.Second)
+//*        ctx, cancel := context.WithCancel(context.Background())
+//*        go collector.Run(ctx)
+//*        ...
+//*        cancel()
+//
+func NewHeartbeatCollector(prober InstanceProber, interval time.Duration) *HeartbeatCollector {
+	return &HeartbeatCollector{
+		Prober:       prober,
+		Store:        ormInstanceStore{},
+		Interval:     interval,
+		ProbeTimeout: time.Duration(log.Config.QueryTimeOut) * time.Second,
+		WorkerNumber: log.Config.WorkerNumber,
+		now:          time.Now,
+	}
+}
+
+//按Interval周期采集，直到ctx被取消
+func (c *HeartbeatCollector) Run(ctx context.Context) error {
+	if c.Interval <= 0 {
+		return fmt.Errorf("Invalid heartbeat interval=[%v]", c.Interval)
+	}
+	ticker := time.NewTicker(c.Interval)
+	defer ticker.Stop()
+	for {
+		summary, err := c.CollectOnce(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Log.Warn("Collect heartbeat failed! summary=[%+v], error=[%v].", summary, err)
+		}
+		select {
+		case <-ctx.Done():
+			log.Log.Notice("Heartbeat collector stopped. reason=[%v]", ctx.Err())
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+//采集一轮，所有实例处理完成或ctx被取消后返回
+func (c *HeartbeatCollector) CollectOnce(ctx context.Context) (summary CollectSummary, err error) {
+	if c.Prober == nil || c.Store == nil {
+		return summary, errors.New("HeartbeatCollector need Prober and Store")
+	}
+	instances, err := c.Store.ReadAllInstance()
+	if err != nil {
+		return summary, err
+	}
+	summary.Total = len(instances)
+
+	workerNumber := c.WorkerNumber
+	if workerNumber <= 0 {
+		workerNumber = 1
+	}
+	if workerNumber > len(instances) {
+		workerNumber = len(instances)
+	}
+
+	jobs := make(chan *DbInstance)
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < workerNumber; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for instance := range jobs {
+				ok := c.collectInstance(ctx, instance)
+				lock.Lock()
+				if ok {
+					summary.Succeeded++
+				} else {
+					summary.Failed++
+				}
+				lock.Unlock()
+			}
+		}()
+	}
+
+dispatch:
+	for i := range instances {
+		select {
+		case <-ctx.Done():
+			break dispatch
+		case jobs <- &instances[i]:
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	log.Log.Debug("Collect heartbeat finished. summary=[%+v]", summary)
+	return summary, ctx.Err()
+}
+
+//探测单个实例并写回，返回探测是否成功
+func (c *HeartbeatCollector) collectInstance(ctx context.Context, instance *DbInstance) bool {
+	probeCtx := ctx
+	if c.ProbeTimeout > 0 {
+		var cancel context.CancelFunc
+		probeCtx, cancel = context.WithTimeout(ctx, c.ProbeTimeout)
+		defer cancel()
+	}
+	result, err := c.Prober.Probe(probeCtx, *instance)
+	if err != nil {
+		// 采集器被取消导致的失败不计入实例异常
+		if ctx.Err() != nil {
+			return false
+		}
+		instance.ExceptionNums++
+		log.Log.Warn("Probe instance failed! instance_id=[%v], ip=[%v], port=[%v], exception_num=[%v], error=[%v].",
+			instance.InstanceId, instance.Ip, instance.Port, instance.ExceptionNums, err)
+		if err := c.Store.UpdateInstance(instance, []string{"ExceptionNums"}); err != nil {
+			log.Log.Warn("Update exception_num failed! instance_id=[%v], error=[%v].", instance.InstanceId, err)
+		}
+		return false
+	}
+
+	now := time.Now
+	if c.now != nil {
+		now = c.now
+	}
+	instance.HeartBeat = now().Unix()
+	instance.File = result.File
+	instance.Position = result.Position
+	instance.ExceptionNums = 0
+	cols := []string{"HeartBeat", "File", "Position", "ExceptionNums"}
+	// gtid集合无法解析或超出字段长度时只记录日志，不影响心跳等其他字段的更新
+	if gtidSet, err := mysql.ParseGTIDSet(result.ExecutedGtidSet); err != nil {
+		log.Log.Warn("Parse probed executed_gtid_set failed! instance_id=[%v], error=[%v].", instance.InstanceId, err)
+	} else if err := instance.SetGtidSet(gtidSet); err != nil {
+		log.Log.Warn("Set executed_gtid_set failed! instance_id=[%v], error=[%v].", instance.InstanceId, err)
+	} else {
+		cols = append(cols, "ExecutedGtidSet")
+	}
+	if err := c.Store.UpdateInstance(instance, cols); err != nil {
+		log.Log.Warn("Update heartbeat failed! instance_id=[%v], error=[%v].", instance.InstanceId, err)
+		return false
+	}
+	return true
+}
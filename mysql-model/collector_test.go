@@ -0,0 +1,163 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+//内存版InstanceStore
+type memInstanceStore struct {
+	lock      sync.Mutex
+	instances map[int64]DbInstance
+	updates   map[int64][]string
+}
+
+func newMemInstanceStore(instances ...DbInstance) *memInstanceStore {
+	s := &memInstanceStore{instances: make(map[int64]DbInstance), updates: make(map[int64][]string)}
+	for _, instance := range instances {
+		s.instances[instance.InstanceId] = instance
+	}
+	return s
+}
+
+func (s *memInstanceStore) ReadAllInstance() (result []DbInstance, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, instance := range s.instances {
+		result = append(result, instance)
+	}
+	return result, nil
+}
+
+func (s *memInstanceStore) UpdateInstance(instance *DbInstance, cols []string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.instances[instance.InstanceId] = *instance
+	s.updates[instance.InstanceId] = cols
+	return nil
+}
+
+//按InstanceId返回结果的探测器
+type fakeProber struct {
+	running  int32
+	maxInUse int32
+	fail     map[int64]bool
+	gtid     map[int64]string
+	block    bool
+}
+
+func (p *fakeProber) Probe(ctx context.Context, instance DbInstance) (ProbeResult, error) {
+	inUse := atomic.AddInt32(&p.running, 1)
+	defer atomic.AddInt32(&p.running, -1)
+	for {
+		max := atomic.LoadInt32(&p.maxInUse)
+		if inUse <= max || atomic.CompareAndSwapInt32(&p.maxInUse, max, inUse) {
+			break
+		}
+	}
+	if p.block {
+		<-ctx.Done()
+		return ProbeResult{}, ctx.Err()
+	}
+	time.Sleep(time.Millisecond)
+	if p.fail[instance.InstanceId] {
+		return ProbeResult{}, errors.New("connection refused")
+	}
+	gtid, ok := p.gtid[instance.InstanceId]
+	if !ok {
+		gtid = testUuidA + ":1-10"
+	}
+	return ProbeResult{File: "mysql-bin.000003", Position: instance.InstanceId * 100,
+		ExecutedGtidSet: gtid}, nil
+}
+
+func newTestCollector(prober InstanceProber, store InstanceStore, workers int) *HeartbeatCollector {
+	collector := NewHeartbeatCollector(prober, time.Second)
+	collector.Store = store
+	collector.WorkerNumber = workers
+	collector.ProbeTimeout = time.Second
+	collector.now = func() time.Time { return time.Unix(1600000000, 0) }
+	return collector
+}
+
+func TestHeartbeatCollector(t *testing.T) {
+
+	Convey("CollectOnce updates heartbeat columns and exception counters.", t, func() {
+		store := newMemInstanceStore(
+			DbInstance{InstanceId: 1, ExceptionNums: 2},
+			DbInstance{InstanceId: 2, ExceptionNums: 1},
+		)
+		prober := &fakeProber{fail: map[int64]bool{2: true}}
+		summary, err := newTestCollector(prober, store, 4).CollectOnce(context.Background())
+		So(err, ShouldBeNil)
+		So(summary, ShouldResemble, CollectSummary{Total: 2, Succeeded: 1, Failed: 1})
+
+		ok := store.instances[1]
+		So(ok.HeartBeat, ShouldEqual, 1600000000)
+		So(ok.File, ShouldEqual, "mysql-bin.000003")
+		So(ok.Position, ShouldEqual, 100)
+		So(ok.ExecutedGtidSet, ShouldEqual, testUuidA+":1-10")
+		So(ok.ExceptionNums, ShouldEqual, 0)
+
+		failed := store.instances[2]
+		So(failed.ExceptionNums, ShouldEqual, 2)
+		So(failed.HeartBeat, ShouldEqual, 0)
+		So(store.updates[2], ShouldResemble, []string{"ExceptionNums"})
+	})
+
+	Convey("CollectOnce still updates heartbeat when executed_gtid_set is too long.", t, func() {
+		var uuids []string
+		for i := 0; i < 30; i++ {
+			uuids = append(uuids, fmt.Sprintf("%08x-0000-0000-0000-000000000000:1-10", i+1))
+		}
+		store := newMemInstanceStore(DbInstance{InstanceId: 1, ExecutedGtidSet: testUuidA + ":1-5", ExceptionNums: 1})
+		prober := &fakeProber{gtid: map[int64]string{1: strings.Join(uuids, ",")}}
+		summary, err := newTestCollector(prober, store, 1).CollectOnce(context.Background())
+		So(err, ShouldBeNil)
+		So(summary.Succeeded, ShouldEqual, 1)
+
+		instance := store.instances[1]
+		So(instance.HeartBeat, ShouldEqual, 1600000000)
+		So(instance.ExceptionNums, ShouldEqual, 0)
+		So(instance.ExecutedGtidSet, ShouldEqual, testUuidA+":1-5")
+		So(store.updates[1], ShouldResemble, []string{"HeartBeat", "File", "Position", "ExceptionNums"})
+	})
+
+	Convey("CollectOnce never runs more probes than WorkerNumber.", t, func() {
+		var instances []DbInstance
+		for i := int64(1); i <= 50; i++ {
+			instances = append(instances, DbInstance{InstanceId: i})
+		}
+		store := newMemInstanceStore(instances...)
+		prober := &fakeProber{}
+		summary, err := newTestCollector(prober, store, 3).CollectOnce(context.Background())
+		So(err, ShouldBeNil)
+		So(summary.Succeeded, ShouldEqual, 50)
+		So(atomic.LoadInt32(&prober.maxInUse), ShouldBeLessThanOrEqualTo, 3)
+	})
+
+	Convey("Run stops when context is cancelled and does not count it as instance failure.", t, func() {
+		store := newMemInstanceStore(DbInstance{InstanceId: 1})
+		prober := &fakeProber{block: true}
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error)
+		go func() { done <- newTestCollector(prober, store, 1).Run(ctx) }()
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+		select {
+		case err := <-done:
+			So(err, ShouldEqual, context.Canceled)
+		case <-time.After(time.Second):
+			So("collector did not stop", ShouldBeEmpty)
+		}
+		So(store.instances[1].ExceptionNums, ShouldEqual, 0)
+	})
+}
@@ -0,0 +1,267 @@
+package dao
+
+import (
+	"errors"
+	"fmt"
+	"go-tools/log"
+	"go-tools/mysql"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 实例角色
+const (
+	Role_Master int32 = 0
+	Role_Slave  int32 = 1
+)
+
+// 实例状态
+const (
+	Status_Normal int32 = 0
+)
+
+// 候选实例排序方式
+type RankMode int
+
+const (
+	// 按gtid完整性排序
+	Rank_By_Gtid RankMode = iota
+	// 按binlog位置点排序
+	Rank_By_Binlog_Position
+)
+
+func (m RankMode) String() string {
+	if m == Rank_By_Gtid {
+		return "gtid"
+	}
+	return "binlog-position"
+}
+
+//选主配置
+type ElectionOptions struct {
+	ClusterId        int64   // 选举的集群，与NodeId均为0时要求全部实例属于同一集群、分片
+	NodeId           int64   // 选举的分片
+	MaxExceptionNums int     // ExceptionNums超过该值的实例不参与选举
+	HealthyStatus    []int32 // 可参与选举的实例状态，为空时使用Status_Normal
+	ExcludeRoles     []int32 // 不参与选举的实例角色，为空时使用Role_Master
+}
+
+//默认选主配置
+var DefaultElectionOptions = ElectionOptions{
+	MaxExceptionNums: 3,
+	HealthyStatus:    []int32{Status_Normal},
+	ExcludeRoles:     []int32{Role_Master},
+}
+
+//落选实例及原因
+type ElectionReject struct {
+	Instance DbInstance
+	Reason   string
+}
+
+//选主结果
+type ElectionResult struct {
+	Winner   DbInstance
+	Mode     RankMode         // 本次选举使用的排序方式
+	Ranking  []DbInstance     // 通过过滤的候选实例，按优先级从高到低排序，Ranking[0]即Winner
+	Rejected []ElectionReject // 被过滤或排名落后的实例，顺序与入参一致
+}
+
+//候选实例的排序依据
+type electionCandidate struct {
+	instance   DbInstance
+	index      int // 在入参中的位置
+	gtidSet    mysql.GTIDSet
+	missingTrx int64 // 相对全部候选实例gtid并集缺失的事务数
+	binlogSeq  int64 // binlog文件序号
+}
+
+/*
+*   ElectNewMaster -
+*
+*   DESCRIPTION - 从同一ClusterId/NodeId的实例中选出新主库，结果只依赖入参，相同输入总是得到相同结果
+*       1、过滤：ClusterId/NodeId与opts不一致、角色在ExcludeRoles中、状态不在HealthyStatus中、
+*          ExceptionNums超过阈值的实例；opts未指定ClusterId/NodeId且实例属于多个分片时返回错误
+*       2、排序：所有候选实例的ExecutedGtidSet均可解析且非空时按gtid完整性排序，否则按File/Position排序；
+*          其次按SwitchPriority从大到小；最后按InstanceId从小到大
+*
+*   PARAMS:
+*       instances: 分片的全部实例
+*       opts: 选主配置
+*
+*   RETURNS:
+*       return result ElectionResult, err error
+*              err != nil when no candidate is left or instances are mixed without opts.ClusterId/NodeId
+*
+*   Examples:
+*        t := new(DbInstance)
+*        t.ClusterId = 1
+*        t.NodeId = 1
+*        instances, err := t.ReadInstancesByCols([]string{"ClusterId", "NodeId"})
+*        opts := DefaultElectionOptions
+*        opts.ClusterId, opts.NodeId = 1, 1
+*        result, err := ElectNewMaster(instances, opts)
+*        for _, reject := range result.Rejected {
+*            fmt.Println(reject.Instance.InstanceId, reject.Reason)
+*        }
+ */
+func ElectNewMaster(instances []DbInstance, opts ElectionOptions) (result ElectionResult, err error) {
+	if len(instances) == 0 {
+		return result, errors.New("No instance for election")
+	}
+	if len(opts.HealthyStatus) == 0 {
+		opts.HealthyStatus = []int32{Status_Normal}
+	}
+	if len(opts.ExcludeRoles) == 0 {
+		opts.ExcludeRoles = []int32{Role_Master}
+	}
+	clusterId, nodeId := opts.ClusterId, opts.NodeId
+	if clusterId == 0 && nodeId == 0 {
+		//未指定分片时不能以入参顺序决定选举的分片
+		clusterId, nodeId = instances[0].ClusterId, instances[0].NodeId
+		for _, instance := range instances {
+			if instance.ClusterId != clusterId || instance.NodeId != nodeId {
+				msg := fmt.Sprintf("Instances belong to multiple nodes, set ElectionOptions.ClusterId and NodeId. "+
+					"cluster_id=[%v] node_id=[%v] instance_id=[%v]", instance.ClusterId, instance.NodeId, instance.InstanceId)
+				log.Log.Warn(msg)
+				return result, errors.New(msg)
+			}
+		}
+	}
+
+	rejected := make(map[int]string)
+	var candidates []*electionCandidate
+	for i, instance := range instances {
+		switch {
+		case instance.ClusterId != clusterId || instance.NodeId != nodeId:
+			rejected[i] = fmt.Sprintf("belongs to cluster_id=[%v] node_id=[%v], election is for cluster_id=[%v] node_id=[%v]",
+				instance.ClusterId, instance.NodeId, clusterId, nodeId)
+		case containsInt32(opts.ExcludeRoles, instance.Role):
+			rejected[i] = fmt.Sprintf("role=[%v] is excluded from election", instance.Role)
+		case !containsInt32(opts.HealthyStatus, instance.Status):
+			rejected[i] = fmt.Sprintf("status=[%v] is unhealthy", instance.Status)
+		case instance.ExceptionNums > opts.MaxExceptionNums:
+			rejected[i] = fmt.Sprintf("exception_num=[%v] exceeds threshold=[%v]",
+				instance.ExceptionNums, opts.MaxExceptionNums)
+		default:
+			candidates = append(candidates, &electionCandidate{instance: instance, index: i})
+		}
+	}
+
+	result.Mode = chooseRankMode(candidates)
+	if result.Mode == Rank_By_Gtid {
+		all := make(mysql.GTIDSet)
+		for _, c := range candidates {
+			all = all.Union(c.gtidSet)
+		}
+		for _, c := range candidates {
+			c.missingTrx = c.gtidSet.MissingCount(all)
+		}
+	} else {
+		for _, c := range candidates {
+			c.binlogSeq = binlogSequence(c.instance.File)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].betterThan(candidates[j], result.Mode)
+	})
+
+	for rank, c := range candidates {
+		result.Ranking = append(result.Ranking, c.instance)
+		if rank == 0 {
+			continue
+		}
+		rejected[c.index] = candidates[0].lostReason(c, rank+1, result.Mode)
+	}
+	for i, instance := range instances {
+		if reason, ok := rejected[i]; ok {
+			result.Rejected = append(result.Rejected, ElectionReject{Instance: instance, Reason: reason})
+		}
+	}
+	if len(candidates) == 0 {
+		msg := fmt.Sprintf("No candidate left for election. cluster_id=[%v] node_id=[%v] rejected=[%+v]",
+			clusterId, nodeId, result.Rejected)
+		log.Log.Warn(msg)
+		return result, errors.New(msg)
+	}
+	result.Winner = candidates[0].instance
+	log.Log.Notice("Elect new master successfully. cluster_id=[%v] node_id=[%v] winner=[%v] mode=[%v]",
+		clusterId, nodeId, result.Winner.InstanceId, result.Mode)
+	return result, nil
+}
+
+//所有候选实例的gtid均可解析且非空时按gtid排序，否则按binlog位置点排序
+func chooseRankMode(candidates []*electionCandidate) RankMode {
+	mode := Rank_By_Gtid
+	for _, c := range candidates {
+		gtidSet, err := mysql.ParseGTIDSet(c.instance.ExecutedGtidSet)
+		if err != nil || gtidSet.IsEmpty() {
+			mode = Rank_By_Binlog_Position
+			continue
+		}
+		c.gtidSet = gtidSet
+	}
+	return mode
+}
+
+//c是否排在other之前
+func (c *electionCandidate) betterThan(other *electionCandidate, mode RankMode) bool {
+	if mode == Rank_By_Gtid {
+		if c.missingTrx != other.missingTrx {
+			return c.missingTrx < other.missingTrx
+		}
+	} else {
+		if c.binlogSeq != other.binlogSeq {
+			return c.binlogSeq > other.binlogSeq
+		}
+		if c.instance.Position != other.instance.Position {
+			return c.instance.Position > other.instance.Position
+		}
+	}
+	if c.instance.SwitchPriority != other.instance.SwitchPriority {
+		return c.instance.SwitchPriority > other.instance.SwitchPriority
+	}
+	return c.instance.InstanceId < other.instance.InstanceId
+}
+
+//排名落后的原因，winner为c
+func (c *electionCandidate) lostReason(loser *electionCandidate, rank int, mode RankMode) string {
+	prefix := fmt.Sprintf("ranked %v behind instance_id=[%v]: ", rank, c.instance.InstanceId)
+	if mode == Rank_By_Gtid && loser.missingTrx != c.missingTrx {
+		return prefix + fmt.Sprintf("missing %v transactions, winner missing %v",
+			loser.missingTrx, c.missingTrx)
+	}
+	if mode == Rank_By_Binlog_Position &&
+		(loser.binlogSeq != c.binlogSeq || loser.instance.Position != c.instance.Position) {
+		return prefix + fmt.Sprintf("binlog position %v:%v is behind %v:%v",
+			loser.instance.File, loser.instance.Position, c.instance.File, c.instance.Position)
+	}
+	if loser.instance.SwitchPriority != c.instance.SwitchPriority {
+		return prefix + fmt.Sprintf("switch_priority %v is lower than %v",
+			loser.instance.SwitchPriority, c.instance.SwitchPriority)
+	}
+	return prefix + "same data and priority, larger instance_id"
+}
+
+//binlog文件名中的序号，如mysql-bin.000012返回12，无法解析时返回-1
+func binlogSequence(file string) int64 {
+	index := strings.LastIndex(file, ".")
+	if index < 0 {
+		return -1
+	}
+	seq, err := strconv.ParseInt(file[index+1:], 10, 64)
+	if err != nil {
+		return -1
+	}
+	return seq
+}
+
+func containsInt32(values []int32, value int32) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
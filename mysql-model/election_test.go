@@ -0,0 +1,131 @@
+package dao
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+const (
+	testUuidA = "3e11fa47-71ca-11e1-9e33-c80aa9429562"
+	testUuidB = "4a6f0b3c-71ca-11e1-9e33-c80aa9429563"
+)
+
+//构造同一分片的测试实例
+func newElectionInstances() []DbInstance {
+	return []DbInstance{
+		{InstanceId: 1, ClusterId: 1, NodeId: 1, Role: Role_Master, Status: Status_Normal,
+			ExecutedGtidSet: testUuidA + ":1-100", File: "mysql-bin.000010", Position: 500},
+		{InstanceId: 2, ClusterId: 1, NodeId: 1, Role: Role_Slave, Status: Status_Normal,
+			ExecutedGtidSet: testUuidA + ":1-90", File: "mysql-bin.000010", Position: 300, SwitchPriority: 10},
+		{InstanceId: 3, ClusterId: 1, NodeId: 1, Role: Role_Slave, Status: Status_Normal,
+			ExecutedGtidSet: testUuidA + ":1-95", File: "mysql-bin.000010", Position: 400},
+		{InstanceId: 4, ClusterId: 1, NodeId: 1, Role: Role_Slave, Status: 2,
+			ExecutedGtidSet: testUuidA + ":1-100", File: "mysql-bin.000010", Position: 500},
+		{InstanceId: 5, ClusterId: 1, NodeId: 1, Role: Role_Slave, Status: Status_Normal, ExceptionNums: 5,
+			ExecutedGtidSet: testUuidA + ":1-100", File: "mysql-bin.000010", Position: 500},
+		{InstanceId: 6, ClusterId: 1, NodeId: 2, Role: Role_Slave, Status: Status_Normal,
+			ExecutedGtidSet: testUuidA + ":1-100", File: "mysql-bin.000010", Position: 500},
+	}
+}
+
+//第1分片的选主配置
+func nodeElectionOptions() ElectionOptions {
+	opts := DefaultElectionOptions
+	opts.ClusterId, opts.NodeId = 1, 1
+	return opts
+}
+
+//根据InstanceId获取落选原因
+func rejectReason(result ElectionResult, instanceId int64) string {
+	for _, reject := range result.Rejected {
+		if reject.Instance.InstanceId == instanceId {
+			return reject.Reason
+		}
+	}
+	return ""
+}
+
+func TestElectNewMaster(t *testing.T) {
+
+	Convey("ElectNewMaster picks the candidate with the most complete gtid set.", t, func() {
+		result, err := ElectNewMaster(newElectionInstances(), nodeElectionOptions())
+		So(err, ShouldBeNil)
+		So(result.Mode, ShouldEqual, Rank_By_Gtid)
+		So(result.Winner.InstanceId, ShouldEqual, 3)
+		So(len(result.Ranking), ShouldEqual, 2)
+		So(len(result.Rejected), ShouldEqual, 5)
+		So(rejectReason(result, 1), ShouldContainSubstring, "role")
+		So(rejectReason(result, 2), ShouldContainSubstring, "missing 5 transactions")
+		So(rejectReason(result, 4), ShouldContainSubstring, "unhealthy")
+		So(rejectReason(result, 5), ShouldContainSubstring, "exception_num")
+		So(rejectReason(result, 6), ShouldContainSubstring, "node_id=[2]")
+	})
+
+	Convey("ElectNewMaster counts errant transactions against the union of all candidates.", t, func() {
+		instances := newElectionInstances()[:3]
+		instances[1].ExecutedGtidSet = testUuidA + ":1-95," + testUuidB + ":1-3"
+		result, err := ElectNewMaster(instances, DefaultElectionOptions)
+		So(err, ShouldBeNil)
+		So(result.Winner.InstanceId, ShouldEqual, 2)
+		So(rejectReason(result, 3), ShouldContainSubstring, "missing 3 transactions")
+	})
+
+	Convey("ElectNewMaster falls back to binlog position when any gtid set is empty.", t, func() {
+		instances := newElectionInstances()[:3]
+		instances[1].ExecutedGtidSet = ""
+		instances[1].File = "mysql-bin.000011"
+		instances[1].Position = 4
+		result, err := ElectNewMaster(instances, DefaultElectionOptions)
+		So(err, ShouldBeNil)
+		So(result.Mode, ShouldEqual, Rank_By_Binlog_Position)
+		So(result.Winner.InstanceId, ShouldEqual, 2)
+		So(rejectReason(result, 3), ShouldContainSubstring, "binlog position")
+	})
+
+	Convey("ElectNewMaster breaks ties by SwitchPriority and then InstanceId.", t, func() {
+		instances := newElectionInstances()[:3]
+		instances[1].ExecutedGtidSet = testUuidA + ":1-95"
+		result, err := ElectNewMaster(instances, DefaultElectionOptions)
+		So(err, ShouldBeNil)
+		So(result.Winner.InstanceId, ShouldEqual, 2)
+		So(rejectReason(result, 3), ShouldContainSubstring, "switch_priority")
+
+		instances[1].SwitchPriority = 0
+		result, err = ElectNewMaster(instances, DefaultElectionOptions)
+		So(err, ShouldBeNil)
+		So(result.Winner.InstanceId, ShouldEqual, 2)
+		So(rejectReason(result, 3), ShouldContainSubstring, "larger instance_id")
+	})
+
+	Convey("ElectNewMaster is deterministic regardless of input order.", t, func() {
+		instances := newElectionInstances()
+		expected, err := ElectNewMaster(instances, nodeElectionOptions())
+		So(err, ShouldBeNil)
+		//依次把每个实例(包括其他分片的实例)轮换到第一个
+		for shift := 1; shift < len(instances); shift++ {
+			rotated := append(append([]DbInstance{}, instances[shift:]...), instances[:shift]...)
+			result, err := ElectNewMaster(rotated, nodeElectionOptions())
+			So(err, ShouldBeNil)
+			So(result.Winner.InstanceId, ShouldEqual, expected.Winner.InstanceId)
+			So(len(result.Ranking), ShouldEqual, len(expected.Ranking))
+			for _, reject := range expected.Rejected {
+				So(rejectReason(result, reject.Instance.InstanceId), ShouldEqual, reject.Reason)
+			}
+		}
+	})
+
+	Convey("ElectNewMaster refuses mixed nodes without ClusterId and NodeId.", t, func() {
+		_, err := ElectNewMaster(newElectionInstances(), DefaultElectionOptions)
+		So(err, ShouldBeError)
+		result, err := ElectNewMaster(newElectionInstances()[:5], DefaultElectionOptions)
+		So(err, ShouldBeNil)
+		So(result.Winner.InstanceId, ShouldEqual, 3)
+	})
+
+	Convey("ElectNewMaster returns error when no candidate is left.", t, func() {
+		_, err := ElectNewMaster(newElectionInstances()[:1], DefaultElectionOptions)
+		So(err, ShouldBeError)
+		_, err = ElectNewMaster(nil, DefaultElectionOptions)
+		So(err, ShouldBeError)
+	})
+}
@@ -2,7 +2,6 @@ package dao
 
 import (
 	"errors"
-	"fmt"
 	"go-tools/log"
 
 	"github.com/astaxie/beego/orm"
@@ -34,23 +33,23 @@ func InitDao() error {
 	return err
 }
 
-// 初始化数据库连接配置
+// 初始化数据库连接配置，优先使用online-dsn
 func registerDataBase() error {
-	var databaseurl string
-	if log.Config.OnlineDSN.Disable == false {
-		databaseurl = fmt.Sprintf("%v:%v@tcp(%v)/%v?charset=%v&loc=Local",
-			log.Config.OnlineDSN.User, log.Config.OnlineDSN.Password, log.Config.OnlineDSN.Addr,
-			log.Config.OnlineDSN.Schema, log.Config.OnlineDSN.Charset)
-		orm.RegisterDataBase("default", log.Config.RegisterDatabase,
+	for _, dsn := range []*log.DSN{log.Config.OnlineDSN, log.Config.TestDSN} {
+		if dsn == nil || dsn.Disable {
+			continue
+		}
+		databaseurl, err := dsn.FormatDSN()
+		if err != nil {
+			log.Log.Warn("Build dsn failed! addr=[%v], error=[%v].", dsn.Addr, err)
+			return err
+		}
+		err = orm.RegisterDataBase("default", log.Config.RegisterDatabase,
 			databaseurl, log.Config.MaxIdleConns, log.Config.MaxOpenConns)
-		return nil
-	} else if log.Config.TestDSN.Disable == false {
-		databaseurl = fmt.Sprintf("%v:%v@tcp(%v)/%v?charset=%v&loc=Local",
-			log.Config.TestDSN.User, log.Config.TestDSN.Password, log.Config.TestDSN.Addr,
-			log.Config.TestDSN.Schema, log.Config.TestDSN.Charset)
-		orm.RegisterDataBase("default", log.Config.RegisterDatabase,
-			databaseurl, log.Config.MaxIdleConns, log.Config.MaxOpenConns)
-		return nil
+		if err != nil {
+			log.Log.Warn("Register database failed! addr=[%v], error=[%v].", dsn.Addr, err)
+		}
+		return err
 	}
 	return errors.New("online-dsn and test-dsn are all nil in tinker.yaml!")
 }
@@ -5,7 +5,11 @@ import (
 	"fmt"
 	"github.com/astaxie/beego/orm"
 	"go-tools/log"
+	"go-tools/mysql"
+)
 
+const (
+	EXECUTED_GTID_SET_SIZE = 1000 // executed_gtid_set字段长度
 )
 
 //这部分的column字段定义，等待数据库表结构定义确定后再统一修改，下方代码先暂用测试表中的字段名
@@ -13,6 +17,7 @@ import (
 //1、调用方可以通过SetPtrOrmer()和GetPtrOrmer，显式的传入数据库连接
 //2、如果未显式传入连接，默认会在struct第一次sql操作时创建连接，并在结构体变量释放前，一直复用该连接，符合SQL的session一致性原则
 //3、经过测试，新建一个连接，等待3分钟后再通过该连接操作sql，未出现问题。
+//4、需要事务时使用WithOrmTx，将闭包参数*OrmTrx传给SetPtrOrmer，由WithOrmTx负责提交与回滚
 //
 type DbInstance struct {
 	Id              int64  `orm:"column(id);auto;pk;index;description(主键id)"`
@@ -57,6 +62,28 @@ func (t *DbInstance) GetPtrOrmer() (ptrOrmer orm.Ormer) {
 	return t.ptrOrmer
 }
 
+//解析实例已执行的gtid集合
+func (t *DbInstance) GetGtidSet() (mysql.GTIDSet, error) {
+	gtidSet, err := mysql.ParseGTIDSet(t.ExecutedGtidSet)
+	if err != nil {
+		log.Log.Warn("Parse executed_gtid_set failed! record=[%+v], error=[%v].", t, err)
+	}
+	return gtidSet, err
+}
+
+//设置实例已执行的gtid集合，超出字段长度时返回错误且不修改原值
+//仅修改结构体，落库需调用UpdateByIndexs([]string{"ExecutedGtidSet"})
+func (t *DbInstance) SetGtidSet(gtidSet mysql.GTIDSet) error {
+	value := gtidSet.String()
+	if len(value) > EXECUTED_GTID_SET_SIZE {
+		log.Log.Warn("executed_gtid_set is too long! len=[%v], max=[%v], record=[%+v].",
+			len(value), EXECUTED_GTID_SET_SIZE, t)
+		return fmt.Errorf("executed_gtid_set is too long! len=[%v], max=[%v]", len(value), EXECUTED_GTID_SET_SIZE)
+	}
+	t.ExecutedGtidSet = value
+	return nil
+}
+
 //!DbInstance索引，可以唯一确定DbInstance记录
 func (t *DbInstance) Indexes() (cols []string) {
 	cols = []string{"ClusterId", "NodeId", "InstanceId"}
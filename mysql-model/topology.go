@@ -0,0 +1,203 @@
+package dao
+
+import (
+	"context"
+	"fmt"
+	"github.com/astaxie/beego/orm"
+	"go-tools/log"
+	"go-tools/mysql"
+	"sort"
+)
+
+//根据复制拓扑登记db_instances的选项
+type TopologySeedOptions struct {
+	ClusterId int64
+	NodeId    int64
+	//为新实例分配InstanceId，为nil时使用server_id
+	NewInstanceId func(node *mysql.TopologyNode) int64
+}
+
+//需要更新的实例及字段
+type InstanceChange struct {
+	Instance DbInstance
+	Cols     []string
+}
+
+//复制拓扑与db_instances的对比结果
+type TopologyReconcile struct {
+	Insert   []DbInstance     //拓扑中发现但db_instances中不存在的实例
+	Update   []InstanceChange //已登记但Ip、Port、Role、Uuid与拓扑不一致的实例
+	Missing  []DbInstance     //已登记在该集群、分片，但拓扑中未发现的实例，不自动删除
+	Conflict []DbInstance     //已登记在其他集群或分片的实例，不自动修改
+	Skipped  []string         //连接失败等原因无法确认身份的实例地址，已登记时不计入Missing
+}
+
+//拓扑角色对应的db_instances角色
+//双主中只读的实例为从库，其余为主库
+func topologyInstanceRole(node *mysql.TopologyNode) int32 {
+	switch node.Role {
+	case mysql.Topology_Master, mysql.Topology_Standalone:
+		return Role_Master
+	case mysql.Topology_Co_Master:
+		if !node.ReadOnly {
+			return Role_Master
+		}
+	}
+	return Role_Slave
+}
+
+//对比复制拓扑与db_instances，只生成变更不落库
+//按Ip+Port匹配已登记的实例，匹配不到时按Uuid匹配
+//instances为db_instances中的实例，通常为ReadAllInstance()的结果
+func ReconcileTopology(topology *mysql.Topology, instances []DbInstance,
+	opts TopologySeedOptions) (result TopologyReconcile, err error) {
+	byAddr := make(map[string]int, len(instances))
+	byUuid := make(map[string]int, len(instances))
+	usedIds := make(map[int64]bool, len(instances))
+	for i, instance := range instances {
+		byAddr[fmt.Sprintf("%v:%v", instance.Ip, instance.Port)] = i
+		if instance.Uuid != "" {
+			byUuid[instance.Uuid] = i
+		}
+		usedIds[instance.InstanceId] = true
+	}
+
+	addrs := make([]string, 0, len(topology.Nodes))
+	for addr := range topology.Nodes {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+
+	matched := make(map[int]bool)
+	for _, addr := range addrs {
+		node := topology.Nodes[addr]
+		index, ok := byAddr[fmt.Sprintf("%v:%v", node.Host, node.Port)]
+		if !ok && node.ServerUUID != "" {
+			index, ok = byUuid[node.ServerUUID]
+		}
+		if node.Error != nil {
+			//实例仍在拓扑中，只是无法确认身份，已登记的实例不计入Missing
+			if ok {
+				matched[index] = true
+			}
+			result.Skipped = append(result.Skipped, addr)
+			continue
+		}
+		role := topologyInstanceRole(node)
+
+		if !ok {
+			instanceId := node.ServerId
+			if opts.NewInstanceId != nil {
+				instanceId = opts.NewInstanceId(node)
+			}
+			if instanceId <= 0 || usedIds[instanceId] {
+				return result, fmt.Errorf("Invalid instance_id for new instance! addr=[%v], instance_id=[%v]",
+					addr, instanceId)
+			}
+			usedIds[instanceId] = true
+			result.Insert = append(result.Insert, DbInstance{
+				ClusterId:  opts.ClusterId,
+				NodeId:     opts.NodeId,
+				InstanceId: instanceId,
+				Ip:         node.Host,
+				Port:       node.Port,
+				Role:       role,
+				Status:     Status_Normal,
+				Uuid:       node.ServerUUID,
+			})
+			continue
+		}
+
+		matched[index] = true
+		instance := instances[index]
+		if instance.ClusterId != opts.ClusterId || instance.NodeId != opts.NodeId {
+			result.Conflict = append(result.Conflict, instance)
+			continue
+		}
+		var cols []string
+		if instance.Ip != node.Host || instance.Port != node.Port {
+			instance.Ip, instance.Port = node.Host, node.Port
+			cols = append(cols, "Ip", "Port")
+		}
+		if instance.Role != role {
+			instance.Role = role
+			cols = append(cols, "Role")
+		}
+		if node.ServerUUID != "" && instance.Uuid != node.ServerUUID {
+			instance.Uuid = node.ServerUUID
+			cols = append(cols, "Uuid")
+		}
+		if len(cols) > 0 {
+			result.Update = append(result.Update, InstanceChange{Instance: instance, Cols: cols})
+		}
+	}
+
+	for i, instance := range instances {
+		if !matched[i] && instance.ClusterId == opts.ClusterId && instance.NodeId == opts.NodeId {
+			result.Missing = append(result.Missing, instance)
+		}
+	}
+	return result, nil
+}
+
+//在一个事务中写入对比结果的Insert及Update，Missing、Conflict只记录日志
+//o为nil时新建orm.Ormer
+func ApplyTopologyReconcile(ctx context.Context, o orm.Ormer, result TopologyReconcile) error {
+	for _, instance := range result.Missing {
+		log.Log.Warn("Instance not found in replication topology! instance_id=[%v], ip=[%v], port=[%v].",
+			instance.InstanceId, instance.Ip, instance.Port)
+	}
+	for _, instance := range result.Conflict {
+		log.Log.Warn("Instance belongs to another cluster! instance_id=[%v], cluster_id=[%v], node_id=[%v], ip=[%v], port=[%v].",
+			instance.InstanceId, instance.ClusterId, instance.NodeId, instance.Ip, instance.Port)
+	}
+	return WithOrmTx(ctx, o, nil, func(trx *OrmTrx) error {
+		for i := range result.Insert {
+			instance := result.Insert[i]
+			instance.SetPtrOrmer(trx)
+			if _, err := instance.InsertOneRecord(); err != nil {
+				return err
+			}
+		}
+		for i := range result.Update {
+			instance := result.Update[i].Instance
+			instance.SetPtrOrmer(trx)
+			if _, err := instance.UpdateByIndexs(result.Update[i].Cols); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+//从seed发现复制拓扑，并登记到db_instances的ClusterId、NodeId下
+//dryRun为true时只返回对比结果，不写入db_instances
+//*EXAMPLE:
+//*        crawler := mysql.NewTopologyCrawler(func(host string, port int32) (*mysql.DBPool, error) {...})
+//*        opts := TopologySeedOptions{ClusterId: 1, NodeId: 1}
+//*        topology, result, err := SyncClusterTopology(ctx, crawler, pool, "10.0.0.1", 3306, opts, true)
+//*        fmt.Print(topology.Text())
+//
+func SyncClusterTopology(ctx context.Context, crawler *mysql.TopologyCrawler, seed *mysql.DBPool, host string, port int32,
+	opts TopologySeedOptions, dryRun bool) (topology *mysql.Topology, result TopologyReconcile, err error) {
+	topology, err = crawler.Discover(seed, host, port)
+	if err != nil {
+		log.Log.Warn("Discover replication topology failed! seed=[%v:%v], error=[%v].", host, port, err)
+		return topology, result, err
+	}
+	instances, err := new(DbInstance).ReadAllInstance()
+	if err != nil {
+		return topology, result, err
+	}
+	if result, err = ReconcileTopology(topology, instances, opts); err != nil {
+		log.Log.Warn("Reconcile replication topology failed! cluster_id=[%v], error=[%v].", opts.ClusterId, err)
+		return topology, result, err
+	}
+	log.Log.Info("Reconcile replication topology. cluster_id=[%v], node_id=[%v], insert=[%v], update=[%v], missing=[%v], conflict=[%v], skipped=[%v], dry_run=[%v].",
+		opts.ClusterId, opts.NodeId, len(result.Insert), len(result.Update), len(result.Missing),
+		len(result.Conflict), result.Skipped, dryRun)
+	if dryRun {
+		return topology, result, nil
+	}
+	return topology, result, ApplyTopologyReconcile(ctx, nil, result)
+}
@@ -0,0 +1,75 @@
+package dao
+
+import (
+	"errors"
+	. "github.com/smartystreets/goconvey/convey"
+	"go-tools/mysql"
+	"testing"
+)
+
+func newTestTopology() *mysql.Topology {
+	nodes := []*mysql.TopologyNode{
+		{Addr: "10.0.0.1:3306", Host: "10.0.0.1", Port: 3306, ServerId: 11, ServerUUID: "uuid-a", Role: mysql.Topology_Master},
+		{Addr: "10.0.0.2:3306", Host: "10.0.0.2", Port: 3306, ServerId: 12, ServerUUID: "uuid-b", Role: mysql.Topology_Replica, ReadOnly: true},
+		{Addr: "10.0.0.3:3306", Host: "10.0.0.3", Port: 3306, ServerId: 13, ServerUUID: "uuid-c", Role: mysql.Topology_Replica, ReadOnly: true},
+		{Addr: "10.0.0.4:3306", Host: "10.0.0.4", Port: 3306, Role: mysql.Topology_Unknown, Error: errors.New("connection refused")},
+		{Addr: "10.0.0.9:3306", Host: "10.0.0.9", Port: 3306, ServerId: 19, ServerUUID: "uuid-x", Role: mysql.Topology_Replica},
+	}
+	topology := &mysql.Topology{Nodes: map[string]*mysql.TopologyNode{}}
+	for _, node := range nodes {
+		topology.Nodes[node.Addr] = node
+	}
+	return topology
+}
+
+func TestReconcileTopology(t *testing.T) {
+	Convey("对比复制拓扑与db_instances", t, func() {
+		instances := []DbInstance{
+			//主库已登记，但角色记录为从库
+			{InstanceId: 1, ClusterId: 1, NodeId: 1, Ip: "10.0.0.1", Port: 3306, Role: Role_Slave, Uuid: "uuid-a"},
+			//从库迁移了ip，按uuid匹配
+			{InstanceId: 2, ClusterId: 1, NodeId: 1, Ip: "10.0.1.2", Port: 3306, Role: Role_Slave, Uuid: "uuid-b"},
+			//连接失败，跳过但不计入Missing
+			{InstanceId: 4, ClusterId: 1, NodeId: 1, Ip: "10.0.0.4", Port: 3306, Role: Role_Slave},
+			//已下线
+			{InstanceId: 5, ClusterId: 1, NodeId: 1, Ip: "10.0.0.5", Port: 3306, Role: Role_Slave},
+			//属于其他集群
+			{InstanceId: 9, ClusterId: 2, NodeId: 1, Ip: "10.0.0.9", Port: 3306, Role: Role_Slave},
+		}
+		result, err := ReconcileTopology(newTestTopology(), instances, TopologySeedOptions{ClusterId: 1, NodeId: 1})
+		So(err, ShouldBeNil)
+
+		So(len(result.Insert), ShouldEqual, 1)
+		So(result.Insert[0].InstanceId, ShouldEqual, 13)
+		So(result.Insert[0].Ip, ShouldEqual, "10.0.0.3")
+		So(result.Insert[0].Role, ShouldEqual, Role_Slave)
+		So(result.Insert[0].ClusterId, ShouldEqual, 1)
+
+		So(len(result.Update), ShouldEqual, 2)
+		So(result.Update[0].Instance.InstanceId, ShouldEqual, 1)
+		So(result.Update[0].Cols, ShouldResemble, []string{"Role"})
+		So(result.Update[0].Instance.Role, ShouldEqual, Role_Master)
+		So(result.Update[1].Instance.InstanceId, ShouldEqual, 2)
+		So(result.Update[1].Cols, ShouldResemble, []string{"Ip", "Port"})
+
+		So(len(result.Missing), ShouldEqual, 1)
+		So(result.Missing[0].InstanceId, ShouldEqual, 5)
+		So(len(result.Conflict), ShouldEqual, 1)
+		So(result.Conflict[0].InstanceId, ShouldEqual, 9)
+		So(result.Skipped, ShouldResemble, []string{"10.0.0.4:3306"})
+	})
+
+	Convey("新实例的InstanceId不能重复", t, func() {
+		opts := TopologySeedOptions{ClusterId: 3, NodeId: 1, NewInstanceId: func(node *mysql.TopologyNode) int64 {
+			return 100
+		}}
+		_, err := ReconcileTopology(newTestTopology(), nil, opts)
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("双主中可写的实例登记为主库", t, func() {
+		So(topologyInstanceRole(&mysql.TopologyNode{Role: mysql.Topology_Co_Master}), ShouldEqual, Role_Master)
+		So(topologyInstanceRole(&mysql.TopologyNode{Role: mysql.Topology_Co_Master, ReadOnly: true}), ShouldEqual, Role_Slave)
+		So(topologyInstanceRole(&mysql.TopologyNode{Role: mysql.Topology_Intermediate}), ShouldEqual, Role_Slave)
+	})
+}
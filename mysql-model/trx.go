@@ -0,0 +1,128 @@
+package dao
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/astaxie/beego/orm"
+	"go-tools/log"
+)
+
+//WithOrmTx传给闭包的事务，实现了orm.Ormer，可直接传给SetPtrOrmer
+type OrmTrx struct {
+	orm.Ormer
+	state     *ormTrxState
+	savepoint string //嵌套事务的SAVEPOINT名，最外层为空
+}
+
+//同一个事务内各层共享的状态
+type ormTrxState struct {
+	savepointSeq int
+	hooks        []func()
+}
+
+//在事务中执行fn，fn返回nil时提交，返回错误或panic时回滚，panic在回滚后继续抛出
+//o为nil时新建orm.Ormer；opts为nil时使用REPEATABLE READ
+//*EXAMPLE:
+//*        err := WithOrmTx(ctx, nil, nil, func(trx *OrmTrx) error {
+//*            t := new(DbInstance)
+//*            t.SetPtrOrmer(trx)//!transaction
+//*            t.InstanceId = 1
+//*            t.Role = Role_Master
+//*            if _, err := t.UpdateByIndexs([]string{"Role"}); err != nil {
+//*                return err
+//*            }
+//*            trx.AfterCommit(func() { notify(t) })
+//*            return nil
+//*        })
+//
+func WithOrmTx(ctx context.Context, o orm.Ormer, opts *sql.TxOptions, fn func(trx *OrmTrx) error) (err error) {
+	if o == nil {
+		o = orm.NewOrm()
+	}
+	if opts == nil {
+		opts = &sql.TxOptions{Isolation: sql.LevelRepeatableRead}
+	}
+	if err = o.BeginTx(ctx, opts); err != nil {
+		log.Log.Warn("Begin transaction failed! error=[%v].", err)
+		return err
+	}
+	trx := &OrmTrx{Ormer: o, state: &ormTrxState{}}
+	defer func() {
+		if ri := recover(); ri != nil {
+			trx.rollback()
+			panic(ri)
+		}
+	}()
+	if err = fn(trx); err != nil {
+		trx.rollback()
+		return err
+	}
+	if err = o.Commit(); err != nil {
+		log.Log.Warn("Commit transaction failed! error=[%v].", err)
+		return err
+	}
+	trx.runHooks()
+	return nil
+}
+
+//嵌套事务，通过SAVEPOINT实现
+//fn返回nil时RELEASE SAVEPOINT，返回错误或panic时ROLLBACK TO SAVEPOINT，并丢弃fn中注册的AfterCommit函数
+func (trx *OrmTrx) WithTx(fn func(trx *OrmTrx) error) (err error) {
+	trx.state.savepointSeq++
+	nested := &OrmTrx{
+		Ormer:     trx.Ormer,
+		state:     trx.state,
+		savepoint: fmt.Sprintf("sp_%d", trx.state.savepointSeq),
+	}
+	if _, err = trx.Raw("SAVEPOINT " + nested.savepoint).Exec(); err != nil {
+		log.Log.Warn("Create savepoint failed! savepoint=[%v], error=[%v].", nested.savepoint, err)
+		return err
+	}
+	hookNum := len(trx.state.hooks)
+	defer func() {
+		if ri := recover(); ri != nil {
+			nested.rollbackTo(hookNum)
+			panic(ri)
+		}
+	}()
+	if err = fn(nested); err != nil {
+		nested.rollbackTo(hookNum)
+		return err
+	}
+	if _, err = trx.Raw("RELEASE SAVEPOINT " + nested.savepoint).Exec(); err != nil {
+		log.Log.Warn("Release savepoint failed! savepoint=[%v], error=[%v].", nested.savepoint, err)
+		return err
+	}
+	return nil
+}
+
+//注册在最外层事务提交成功后执行的函数
+func (trx *OrmTrx) AfterCommit(hook func()) {
+	trx.state.hooks = append(trx.state.hooks, hook)
+}
+
+//回滚最外层事务
+func (trx *OrmTrx) rollback() {
+	if err := trx.Rollback(); err != nil {
+		log.Log.Warn("Rollback transaction failed! error=[%v].", err)
+	}
+}
+
+//回滚到SAVEPOINT
+func (trx *OrmTrx) rollbackTo(hookNum int) {
+	trx.state.hooks = trx.state.hooks[:hookNum]
+	if _, err := trx.Raw("ROLLBACK TO SAVEPOINT " + trx.savepoint).Exec(); err != nil {
+		log.Log.Warn("Rollback to savepoint failed! savepoint=[%v], error=[%v].", trx.savepoint, err)
+	}
+}
+
+//执行提交后的函数，单个函数panic不影响后续函数
+func (trx *OrmTrx) runHooks() {
+	for _, hook := range trx.state.hooks {
+		func() {
+			defer DoDaoException(hook)
+			hook()
+		}()
+	}
+}
@@ -0,0 +1,94 @@
+package dao
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/astaxie/beego/orm"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+//记录事务操作的orm.Ormer，未实现的方法调用时panic
+type fakeOrmer struct {
+	orm.Ormer
+	ops []string
+}
+
+func (o *fakeOrmer) BeginTx(ctx context.Context, opts *sql.TxOptions) error {
+	o.ops = append(o.ops, "BEGIN")
+	return nil
+}
+
+func (o *fakeOrmer) Commit() error {
+	o.ops = append(o.ops, "COMMIT")
+	return nil
+}
+
+func (o *fakeOrmer) Rollback() error {
+	o.ops = append(o.ops, "ROLLBACK")
+	return nil
+}
+
+func (o *fakeOrmer) Raw(query string, args ...interface{}) orm.RawSeter {
+	return &fakeRawSeter{ormer: o, query: query}
+}
+
+type fakeRawSeter struct {
+	orm.RawSeter
+	ormer *fakeOrmer
+	query string
+}
+
+func (r *fakeRawSeter) Exec() (sql.Result, error) {
+	r.ormer.ops = append(r.ormer.ops, r.query)
+	return nil, nil
+}
+
+func TestWithOrmTx(t *testing.T) {
+	Convey("WithOrmTx", t, func() {
+		o := &fakeOrmer{}
+		var hooks []string
+
+		Convey("commit with savepoints", func() {
+			errNested := errors.New("nested fail")
+			err := WithOrmTx(context.Background(), o, nil, func(trx *OrmTrx) error {
+				trx.AfterCommit(func() { hooks = append(hooks, "outer") })
+				So(trx.WithTx(func(trx *OrmTrx) error {
+					trx.AfterCommit(func() { hooks = append(hooks, "sp_1") })
+					return nil
+				}), ShouldBeNil)
+				So(trx.WithTx(func(trx *OrmTrx) error {
+					trx.AfterCommit(func() { hooks = append(hooks, "sp_2") })
+					return errNested
+				}), ShouldEqual, errNested)
+				return nil
+			})
+			So(err, ShouldBeNil)
+			So(o.ops, ShouldResemble, []string{"BEGIN", "SAVEPOINT sp_1", "RELEASE SAVEPOINT sp_1",
+				"SAVEPOINT sp_2", "ROLLBACK TO SAVEPOINT sp_2", "COMMIT"})
+			So(hooks, ShouldResemble, []string{"outer", "sp_1"})
+		})
+
+		Convey("rollback on error", func() {
+			errFail := errors.New("fail")
+			err := WithOrmTx(context.Background(), o, nil, func(trx *OrmTrx) error {
+				trx.AfterCommit(func() { hooks = append(hooks, "outer") })
+				return errFail
+			})
+			So(err, ShouldEqual, errFail)
+			So(o.ops, ShouldResemble, []string{"BEGIN", "ROLLBACK"})
+			So(hooks, ShouldBeEmpty)
+		})
+
+		Convey("rollback on panic", func() {
+			So(func() {
+				WithOrmTx(context.Background(), o, nil, func(trx *OrmTrx) error {
+					panic("boom")
+				})
+			}, ShouldPanic)
+			So(o.ops, ShouldResemble, []string{"BEGIN", "ROLLBACK"})
+		})
+	})
+}
@@ -0,0 +1,124 @@
+package mysql
+
+/*
+ * 自动采集语句执行影响
+ * DBPool.CaptureAffect为true时，语句执行后在同一会话内查询SHOW WARNINGS及last_query_cost，
+ * 结果填充到QueryResult.Warning、QueryResult.QueryCost
+ * 1、exec为nil或*sql.DB时，从连接池中固定一个连接执行语句，采集完成后归还
+ * 2、exec为*sql.Conn或*sql.Tx时直接在该会话内采集
+ * 3、DBExec在执行后立即采集；DBQuery需要读完结果集，在Rows读到末尾、res.Rows.Close()或res.Close()时采集，
+ *    同时归还固定的连接，只关闭res.Rows不会泄漏连接
+ * 4、code在PromoteWarnings中的warning会转为*WarningError，保存到QueryResult.Error
+ *
+ * Demo：
+ *	pool := &DBPool{DB: db, CaptureAffect: true, PromoteWarnings: []int32{WARN_DATA_TRUNCATED}}
+ *	res, err := pool.DBExec(nil, nil, 3, "insert into t(name) values(?)", name)
+ *	if nil != err {
+ *		// 数据被截断时err为*WarningError
+ *	}
+ *	fmt.Println(res.Warning, res.QueryCost)
+ */
+import (
+	"context"
+	"fmt"
+	"go-tools/log"
+	"strconv"
+)
+
+// 由warning提升的错误
+type WarningError struct {
+	Warning QueryWarning
+}
+
+func (e *WarningError) Error() string {
+	return fmt.Sprintf("Promoted warning. level=[%v] code=[%v] message=[%v]",
+		e.Warning.Level, e.Warning.Code, e.Warning.Message)
+}
+
+// 返回采集执行影响使用的会话及归还函数，未开启采集或exec已是会话时原样返回
+func (db *DBPool) affectSession(ctx context.Context, exec Executor) (session Executor, release func(), err error) {
+	if !db.CaptureAffect || isSessionExecutor(exec) {
+		return exec, func() {}, nil
+	}
+	conn, err := db.Conn(ctx)
+	if nil != err {
+		return nil, nil, err
+	}
+	return conn, func() {
+		if closeErr := conn.Close(); nil != closeErr {
+			log.Log.Warning("Fail to release conn. reason=[%v]", closeErr)
+		}
+	}, nil
+}
+
+// 采集session上一条语句的执行影响，并将需要提升的warning写入res.Error
+func (db *DBPool) captureAffect(session Executor, res *QueryResult) {
+	ctx, cancel := timeoutContext(db.rwTimeout())
+	defer cancel()
+	warnings, queryCost, err := readAffect(ctx, session)
+	res.Warning = warnings
+	if nil != err {
+		log.Log.Warning("Fail to capture affect. reason=[%v]", err)
+	} else {
+		res.QueryCost = queryCost
+	}
+	if promoted := db.promoteWarning(warnings); nil != promoted && nil == res.Error {
+		res.Error = promoted
+	}
+}
+
+// 返回第一个需要提升为错误的warning
+func (db *DBPool) promoteWarning(warnings []QueryWarning) error {
+	for _, warning := range warnings {
+		for _, code := range db.PromoteWarnings {
+			if warning.Code == code {
+				return &WarningError{Warning: warning}
+			}
+		}
+	}
+	return nil
+}
+
+// 在同一会话内读取SHOW WARNINGS及last_query_cost
+// 直接使用exec执行，不经过DBQueryContext，避免开启采集时递归采集
+func readAffect(ctx context.Context, exec Executor) (warnings []QueryWarning, queryCost float64, err error) {
+	queryCost = -1.0
+	warnings, err = showWarning(ctx, exec)
+	if nil != err {
+		log.Log.Warning("Fail to show warning. reason=[%v]", err)
+	}
+	var variableName, queryCostStr string
+	err = exec.QueryRowContext(ctx, "SHOW SESSION STATUS LIKE 'last_query_cost'").Scan(&variableName, &queryCostStr)
+	if nil != err {
+		log.Log.Warning("Fail to get SQL last_query_cost. reason=[%v]", err)
+		return warnings, queryCost, err
+	}
+	queryCost, err = strconv.ParseFloat(queryCostStr, 64)
+	if nil != err {
+		log.Log.Warning("Fail to trans string to float64. reason=[%v] vars=[%v]", err, queryCostStr)
+		return warnings, -1.0, err
+	}
+	return warnings, queryCost, nil
+}
+
+/*
+ * 查看执行Warning信息
+ */
+func showWarning(ctx context.Context, exec Executor) (warnings []QueryWarning, err error) {
+	rows, err := exec.QueryContext(ctx, "SHOW WARNINGS")
+	if nil != err {
+		log.Log.Warning("Fail to exec SHOW WARNINGS. reason=[%v]", err)
+		return nil, err
+	}
+	defer CloseRows(rows)
+	for rows.Next() {
+		var warning QueryWarning
+		err := rows.Scan(&warning.Level, &warning.Code, &warning.Message)
+		if nil != err {
+			log.Log.Warning("Fail to exec SHOW WARNINGS. reason=[%v]", err)
+			return nil, err
+		}
+		warnings = append(warnings, warning)
+	}
+	return warnings, rows.Err()
+}
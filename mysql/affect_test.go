@@ -0,0 +1,113 @@
+package mysql
+
+import (
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+const lastQueryCostSQL = "SHOW SESSION STATUS LIKE 'last_query_cost'"
+
+func newAffectPool(t *testing.T, warnings [][]driver.Value) (*DBPool, *fakeServer) {
+	pool, server := newFakePool(t, map[string]fakeResult{
+		"insert t":      {rowsAffected: 1},
+		"select t":      fakeSequenceRows("id", 2),
+		"SHOW WARNINGS": {columns: []string{"Level", "Code", "Message"}, rows: warnings},
+		lastQueryCostSQL: {columns: []string{"Variable_name", "Value"}, rows: [][]driver.Value{
+			{"Last_query_cost", "10.500000"},
+		}},
+	})
+	pool.CaptureAffect = true
+	return pool, server
+}
+
+func TestCaptureAffectExec(t *testing.T) {
+	pool, server := newAffectPool(t, [][]driver.Value{
+		{"Warning", int64(WARN_DATA_TRUNCATED), "Data truncated for column 'name' at row 1"},
+	})
+	res, err := pool.DBExec(nil, nil, 3, "insert t")
+	if nil != err {
+		t.Fatalf("DBExec fail. err=[%v]", err)
+	}
+	if 1 != len(res.Warning) || WARN_DATA_TRUNCATED != res.Warning[0].Code || 10.5 != res.QueryCost {
+		t.Errorf("unexpected affect. warning=[%+v] cost=[%v]", res.Warning, res.QueryCost)
+	}
+	want := []string{"insert t", "SHOW WARNINGS", lastQueryCostSQL}
+	if got := server.executedSQL(); !reflect.DeepEqual(want, got) {
+		t.Errorf("executed=[%v], want [%v]", got, want)
+	}
+
+	pool.PromoteWarnings = []int32{WARN_DATA_TRUNCATED}
+	res, err = pool.DBExec(nil, nil, 3, "insert t")
+	var warningErr *WarningError
+	if !errors.As(err, &warningErr) || WARN_DATA_TRUNCATED != warningErr.Warning.Code || res.Error != err {
+		t.Errorf("truncation warning is not promoted. err=[%v]", err)
+	}
+}
+
+func TestCaptureAffectQuery(t *testing.T) {
+	pool, server := newAffectPool(t, [][]driver.Value{
+		{"Warning", int64(ER_TRUNCATED_WRONG_VALUE), "Truncated incorrect DOUBLE value: 'a'"},
+	})
+	pool.PromoteWarnings = []int32{ER_TRUNCATED_WRONG_VALUE}
+	res := fakeQuery(pool, "select t")
+	if nil != res.Warning || 1 != len(server.executedSQL()) {
+		t.Fatalf("affect should not be captured before rows are read. executed=[%v]", server.executedSQL())
+	}
+	ids, err := ScanAll[scanBase](res)
+	if 2 != len(ids) || 1 != len(res.Warning) || 10.5 != res.QueryCost {
+		t.Errorf("unexpected result. ids=[%v] warning=[%+v] cost=[%v]", ids, res.Warning, res.QueryCost)
+	}
+	var warningErr *WarningError
+	if !errors.As(err, &warningErr) {
+		t.Errorf("ScanAll should return promoted warning. err=[%v]", err)
+	}
+	if 0 != server.openRows() {
+		t.Errorf("rows are not closed. open=[%v]", server.openRows())
+	}
+}
+
+func TestCaptureAffectDisabled(t *testing.T) {
+	pool, server := newAffectPool(t, nil)
+	pool.CaptureAffect = false
+	res, err := pool.DBExec(nil, nil, 3, "insert t")
+	if nil != err || nil != res.Warning || -1.0 != res.QueryCost {
+		t.Errorf("unexpected result. warning=[%+v] cost=[%v] err=[%v]", res.Warning, res.QueryCost, err)
+	}
+	if got := server.executedSQL(); 1 != len(got) {
+		t.Errorf("affect should not be captured. executed=[%v]", got)
+	}
+}
+
+func TestCaptureAffectRowsClose(t *testing.T) {
+	pool, server := newAffectPool(t, [][]driver.Value{
+		{"Warning", int64(ER_TRUNCATED_WRONG_VALUE), "Truncated incorrect DOUBLE value: 'a'"},
+	})
+	pool.PromoteWarnings = []int32{ER_TRUNCATED_WRONG_VALUE}
+	// 只调用res.Rows.Close()，不调用res.Close()
+	for i := 0; i < 3; i++ {
+		res := fakeQuery(pool, "select t")
+		if 1 != pool.Stats().InUse {
+			t.Fatalf("query should pin a conn. in_use=[%v]", pool.Stats().InUse)
+		}
+		if err := res.Rows.Close(); nil != err {
+			t.Fatalf("close rows fail. err=[%v]", err)
+		}
+		if 0 != pool.Stats().InUse || 1 != len(res.Warning) {
+			t.Errorf("conn should be released when rows are closed. in_use=[%v] warning=[%+v]", pool.Stats().InUse, res.Warning)
+		}
+	}
+
+	// 读到末尾时采集，Rows.Err()返回提升的warning
+	res := fakeQuery(pool, "select t")
+	for res.Rows.Next() {
+	}
+	var warningErr *WarningError
+	if !errors.As(res.Rows.Err(), &warningErr) || 0 != pool.Stats().InUse {
+		t.Errorf("rows end should capture affect. err=[%v] in_use=[%v]", res.Rows.Err(), pool.Stats().InUse)
+	}
+	if 0 != server.openRows() {
+		t.Errorf("rows are not closed. open=[%v]", server.openRows())
+	}
+}
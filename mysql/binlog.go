@@ -0,0 +1,206 @@
+package mysql
+
+/*
+ * binlog清单及清理计划
+ * 1、ShowBinaryLogs按列名解析SHOW BINARY LOGS，返回文件名及大小
+ * 2、PlanBinlogPurge根据各从库已执行到的主库位置点，计算仍被需要的最早文件，生成PURGE BINARY LOGS TO计划
+ * 3、当前写入的文件、从库需要的文件、MinRetainFiles/MinRetainBytes保留的文件均不会被清理
+ * 4、从库位置点未知或已早于现存最早文件时返回错误，不生成计划
+ * 5、PurgeBinaryLogs执行计划，dryRun为true时只记录日志
+ *
+ * Demo：
+ *	plan, err := pool.PlanBinlogPurge([]ReplicaPosition{{Name: "10.0.0.2:3306", File: "mysql-bin.000012"}},
+ *		PurgeOptions{MinRetainFiles: 5, MinRetainBytes: 10 << 30})
+ *	if nil != err {
+ *		return err
+ *	}
+ *	err = pool.PurgeBinaryLogs(plan, true)
+ */
+import (
+	"errors"
+	"fmt"
+	"go-tools/log"
+	"regexp"
+	"strings"
+)
+
+// SHOW BINARY LOGS的一行
+type BinaryLog struct {
+	Log_name  string
+	File_size int64
+	Encrypted string // 8.0.14及以上
+}
+
+// 从库已执行到的主库位置点
+type ReplicaPosition struct {
+	Name     string // 从库标识，如ip:port，用于日志及计划说明
+	File     string // 已执行到的主库binlog文件
+	Position int64
+}
+
+// 清理的保留条件
+type PurgeOptions struct {
+	MinRetainFiles int   // 至少保留的文件数(含当前文件)，<=1时只保留当前文件
+	MinRetainBytes int64 // 至少保留的最新文件总大小，单位字节
+}
+
+// binlog清理计划
+type PurgePlan struct {
+	Logs         []BinaryLog // 计划生成时的全部binlog
+	Current      string      // 当前写入的文件
+	OldestNeeded string      // 从库仍需要的最早文件，没有从库时为空
+	NeededBy     string      // 需要OldestNeeded的从库
+	PurgeTo      string      // PURGE BINARY LOGS TO的目标文件，该文件之前的文件被清理；为空时不清理
+	Purge        []BinaryLog // 将被清理的文件
+	PurgeBytes   int64       // 将被清理的总大小
+	Reason       string      // 清理范围由哪个条件决定
+}
+
+// 计划对应的SQL，不清理时为空
+func (p PurgePlan) SQL() string {
+	if "" == p.PurgeTo {
+		return ""
+	}
+	return fmt.Sprintf("PURGE BINARY LOGS TO '%v'", p.PurgeTo)
+}
+
+// binlog文件名允许的字符
+var binlogNamePattern = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+/*
+ * show binary logs 语句执行接口，按文件顺序返回
+ * exec为nil时使用连接池，未开启binlog时返回错误
+ */
+func (db *DBPool) ShowBinaryLogs(exec Executor) (logs []BinaryLog, err error) {
+	res, err := db.QueryWithExecutor(exec, db.rwTimeout(), "SHOW BINARY LOGS")
+	defer DoQueryException(res.Rows)
+	defer res.Close()
+	if nil != err {
+		log.Log.Warning("Fail to exec SHOW BINARY LOGS. reason=[%v]", err)
+		return nil, err
+	}
+	records, err := scanStatusRows(res.Rows)
+	if nil != err {
+		log.Log.Warning("Fail to exec SHOW BINARY LOGS. reason=[%v]", err)
+		return nil, err
+	}
+	for _, record := range records {
+		var binaryLog BinaryLog
+		if err = assignStatusRow(&binaryLog, record); nil != err {
+			log.Log.Warning("Fail to exec SHOW BINARY LOGS. reason=[%v]", err)
+			return nil, err
+		}
+		logs = append(logs, binaryLog)
+	}
+	return logs, nil
+}
+
+// 查询binlog清单并生成清理计划
+func (db *DBPool) PlanBinlogPurge(replicas []ReplicaPosition, opts PurgeOptions) (plan PurgePlan, err error) {
+	logs, err := db.ShowBinaryLogs(nil)
+	if nil != err {
+		return plan, err
+	}
+	return PlanBinlogPurge(logs, replicas, opts)
+}
+
+/*
+ * 生成清理计划，logs为SHOW BINARY LOGS的结果，最后一个为当前写入的文件
+ * 从库位置点未知、不在清单中时返回错误，不生成可能导致从库中断的计划
+ */
+func PlanBinlogPurge(logs []BinaryLog, replicas []ReplicaPosition, opts PurgeOptions) (plan PurgePlan, err error) {
+	if 0 == len(logs) {
+		return plan, errors.New("binary log list is empty")
+	}
+	plan.Logs = logs
+	plan.Current = logs[len(logs)-1].Log_name
+	index := make(map[string]int, len(logs))
+	for i, binaryLog := range logs {
+		index[binaryLog.Log_name] = i
+	}
+
+	// 清理logs[:limit]，limit不能超过当前文件
+	limit := len(logs) - 1
+	plan.Reason = "current binary log"
+
+	for _, replica := range replicas {
+		if "" == replica.File {
+			return plan, fmt.Errorf("replica position is unknown. replica=[%v]", replica.Name)
+		}
+		i, ok := index[replica.File]
+		if !ok {
+			return plan, fmt.Errorf("replica needs a binary log not in the list. replica=[%v] file=[%v] oldest=[%v]",
+				replica.Name, replica.File, logs[0].Log_name)
+		}
+		if "" == plan.OldestNeeded || i < index[plan.OldestNeeded] {
+			plan.OldestNeeded = replica.File
+			plan.NeededBy = replica.Name
+		}
+		if i < limit {
+			limit = i
+			plan.Reason = fmt.Sprintf("needed by replica %v", replica.Name)
+		}
+	}
+
+	if keep := len(logs) - opts.MinRetainFiles; opts.MinRetainFiles > 1 && keep < limit {
+		limit = keep
+		plan.Reason = fmt.Sprintf("min retain files %v", opts.MinRetainFiles)
+	}
+	if opts.MinRetainBytes > 0 {
+		// 从最新的文件开始保留，直到总大小达到MinRetainBytes，logs[keep:]被保留
+		var retained int64
+		keep := len(logs)
+		for keep > 0 && retained < opts.MinRetainBytes {
+			keep--
+			retained += logs[keep].File_size
+		}
+		if keep < limit {
+			limit = keep
+			plan.Reason = fmt.Sprintf("min retain bytes %v", opts.MinRetainBytes)
+		}
+	}
+
+	if limit <= 0 {
+		return plan, nil
+	}
+	plan.PurgeTo = logs[limit].Log_name
+	plan.Purge = logs[:limit]
+	for _, binaryLog := range plan.Purge {
+		plan.PurgeBytes += binaryLog.File_size
+	}
+	return plan, nil
+}
+
+/*
+ * 执行清理计划，dryRun为true时只记录计划不执行
+ * 不清理的计划直接返回nil
+ */
+func (db *DBPool) PurgeBinaryLogs(plan PurgePlan, dryRun bool) error {
+	if "" == plan.PurgeTo {
+		log.Log.Info("No binary log to purge. current=[%v] reason=[%v]", plan.Current, plan.Reason)
+		return nil
+	}
+	if !binlogNamePattern.MatchString(plan.PurgeTo) {
+		return fmt.Errorf("invalid binary log name. name=[%v]", plan.PurgeTo)
+	}
+	names := make([]string, len(plan.Purge))
+	for i, binaryLog := range plan.Purge {
+		names[i] = binaryLog.Log_name
+	}
+	if dryRun {
+		log.Log.Info("Dry run purge binary logs. sql=[%v] files=[%v] bytes=[%v] reason=[%v]",
+			plan.SQL(), strings.Join(names, ","), plan.PurgeBytes, plan.Reason)
+		return nil
+	}
+	res, err := db.ExecWithExecutor(nil, db.rwTimeout(), plan.SQL())
+	res.Close()
+	if nil == err {
+		err = res.Error
+	}
+	if nil != err {
+		log.Log.Warning("Fail to purge binary logs. sql=[%v] reason=[%v]", plan.SQL(), err)
+		return err
+	}
+	log.Log.Notice("Purge binary logs. sql=[%v] files=[%v] bytes=[%v]", plan.SQL(), strings.Join(names, ","), plan.PurgeBytes)
+	return nil
+}
@@ -0,0 +1,102 @@
+package mysql
+
+import (
+	"database/sql/driver"
+	"testing"
+)
+
+func testBinaryLogs() []BinaryLog {
+	return []BinaryLog{
+		{Log_name: "mysql-bin.000001", File_size: 100},
+		{Log_name: "mysql-bin.000002", File_size: 100},
+		{Log_name: "mysql-bin.000003", File_size: 100},
+		{Log_name: "mysql-bin.000004", File_size: 100},
+		{Log_name: "mysql-bin.000005", File_size: 50},
+	}
+}
+
+func TestPlanBinlogPurge(t *testing.T) {
+	logs := testBinaryLogs()
+	replicas := []ReplicaPosition{
+		{Name: "10.0.0.2:3306", File: "mysql-bin.000004"},
+		{Name: "10.0.0.3:3306", File: "mysql-bin.000003", Position: 120},
+	}
+	plan, err := PlanBinlogPurge(logs, replicas, PurgeOptions{})
+	if nil != err {
+		t.Fatalf("PlanBinlogPurge fail. err=[%v]", err)
+	}
+	if "mysql-bin.000003" != plan.PurgeTo || 2 != len(plan.Purge) || 200 != plan.PurgeBytes {
+		t.Errorf("unexpected plan. plan=[%+v]", plan)
+	}
+	if "10.0.0.3:3306" != plan.NeededBy || "mysql-bin.000005" != plan.Current {
+		t.Errorf("unexpected oldest needed. plan=[%+v]", plan)
+	}
+	if "PURGE BINARY LOGS TO 'mysql-bin.000003'" != plan.SQL() {
+		t.Errorf("unexpected sql. sql=[%v]", plan.SQL())
+	}
+
+	// 没有从库时只保留当前文件
+	if plan, _ = PlanBinlogPurge(logs, nil, PurgeOptions{}); "mysql-bin.000005" != plan.PurgeTo {
+		t.Errorf("unexpected plan without replicas. plan=[%+v]", plan)
+	}
+	if plan, _ = PlanBinlogPurge(logs, nil, PurgeOptions{MinRetainFiles: 3}); "mysql-bin.000003" != plan.PurgeTo {
+		t.Errorf("unexpected plan with min retain files. plan=[%+v]", plan)
+	}
+	// 最新的文件累计到250字节才满足保留大小
+	if plan, _ = PlanBinlogPurge(logs, nil, PurgeOptions{MinRetainBytes: 200}); "mysql-bin.000003" != plan.PurgeTo {
+		t.Errorf("unexpected plan with min retain bytes. plan=[%+v]", plan)
+	}
+	if plan, _ = PlanBinlogPurge(logs, nil, PurgeOptions{MinRetainBytes: 1 << 20}); "" != plan.PurgeTo || "" != plan.SQL() {
+		t.Errorf("nothing should be purged. plan=[%+v]", plan)
+	}
+
+	for _, replica := range []ReplicaPosition{{Name: "unknown"}, {Name: "lost", File: "mysql-bin.000000"}} {
+		if _, err = PlanBinlogPurge(logs, []ReplicaPosition{replica}, PurgeOptions{}); nil == err {
+			t.Errorf("replica position should be rejected. replica=[%+v]", replica)
+		}
+	}
+	if _, err = PlanBinlogPurge(nil, nil, PurgeOptions{}); nil == err {
+		t.Errorf("empty binary logs should be rejected")
+	}
+}
+
+func TestPurgeBinaryLogs(t *testing.T) {
+	pool, server := newFakePool(t, map[string]fakeResult{
+		"SHOW BINARY LOGS": {
+			columns: []string{"Log_name", "File_size", "Encrypted"},
+			rows: [][]driver.Value{
+				{"mysql-bin.000001", "100", "No"},
+				{"mysql-bin.000002", "200", "No"},
+			},
+		},
+		"PURGE BINARY LOGS TO 'mysql-bin.000002'": {},
+	})
+	logs, err := pool.ShowBinaryLogs(nil)
+	if nil != err || 2 != len(logs) || 200 != logs[1].File_size || "No" != logs[0].Encrypted {
+		t.Fatalf("unexpected binary logs. logs=[%+v] err=[%v]", logs, err)
+	}
+	plan, err := pool.PlanBinlogPurge(nil, PurgeOptions{})
+	if nil != err {
+		t.Fatalf("PlanBinlogPurge fail. err=[%v]", err)
+	}
+
+	countPurge := func() int {
+		count := 0
+		for _, query := range server.executedSQL() {
+			if plan.SQL() == query {
+				count++
+			}
+		}
+		return count
+	}
+	if err = pool.PurgeBinaryLogs(plan, true); nil != err || 0 != countPurge() {
+		t.Errorf("dry run should not purge. err=[%v] executed=[%v]", err, server.executedSQL())
+	}
+	if err = pool.PurgeBinaryLogs(plan, false); nil != err || 1 != countPurge() {
+		t.Errorf("purge should be executed once. err=[%v] executed=[%v]", err, server.executedSQL())
+	}
+	plan.PurgeTo = "x'; DROP TABLE t; --"
+	if err = pool.PurgeBinaryLogs(plan, false); nil == err {
+		t.Errorf("invalid binary log name should be rejected")
+	}
+}
@@ -0,0 +1,293 @@
+package mysql
+
+/*
+ * 读写分离连接池
+ * 1、DBExec、事务、加锁读(FOR UPDATE/FOR SHARE/LOCK IN SHARE MODE)及非SELECT语句发往主库
+ * 2、普通SELECT按轮询或最小延迟发往从库
+ * 3、从库需通过RefreshReplicas或Run检测复制状态，复制异常或延迟超过阈值的从库不参与读，
+ *    尚未检测的从库同样不参与读；没有可用从库时读主库
+ *
+ * Demo：
+ *	cluster := NewClusterPool(primary, []*DBPool{replica1, replica2}, Balance_Least_Lag, 10)
+ *	ctx, cancel := context.WithCancel(context.Background())
+ *	defer cancel()
+ *	go cluster.Run(ctx, 5*time.Second)
+ *	res, err := cluster.DBQuery(nil, nil, 3, "select id from db_instances where ip = ?", ip)
+ */
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"go-tools/log"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 从库选择策略
+type BalanceMode int
+
+const (
+	// 轮询
+	Balance_Round_Robin BalanceMode = iota
+	// 选择延迟最小的从库
+	Balance_Least_Lag
+)
+
+func (m BalanceMode) String() string {
+	switch m {
+	case Balance_Round_Robin:
+		return "round-robin"
+	case Balance_Least_Lag:
+		return "least-lag"
+	}
+	return fmt.Sprintf("unknown(%d)", int(m))
+}
+
+// 加锁读，需要在主库执行
+var lockingReadPattern = regexp.MustCompile(`(?i)\bFOR\s+(UPDATE|SHARE)\b|\bLOCK\s+IN\s+SHARE\s+MODE\b`)
+
+// 从库检测结果
+type ReplicaState struct {
+	Available           bool
+	SecondsBehindMaster int32
+	Reason              string // 不可用的原因
+	CheckedAt           time.Time
+}
+
+// 一主多从连接池
+type ClusterPool struct {
+	Primary       *DBPool
+	Replicas      []*DBPool
+	Mode          BalanceMode
+	MaxLagSeconds int32 // 从库延迟超过该值时不参与读，<=0时不检查延迟
+
+	lock   sync.RWMutex
+	states []ReplicaState
+	next   uint64 // 轮询计数
+}
+
+// 创建读写分离连接池，从库在首次检测前不参与读
+func NewClusterPool(primary *DBPool, replicas []*DBPool, mode BalanceMode, maxLagSeconds int32) *ClusterPool {
+	states := make([]ReplicaState, len(replicas))
+	for i := range states {
+		states[i].SecondsBehindMaster = SECONDS_BEHIND_MASTER_UNKNOWN
+		states[i].Reason = "not checked yet"
+	}
+	return &ClusterPool{
+		Primary:       primary,
+		Replicas:      replicas,
+		Mode:          mode,
+		MaxLagSeconds: maxLagSeconds,
+		states:        states,
+	}
+}
+
+/*
+ * 检测所有从库的复制状态，更新可用从库列表
+ * 返回可用从库数
+ */
+func (c *ClusterPool) RefreshReplicas() int {
+	states := make([]ReplicaState, len(c.Replicas))
+	available := 0
+	for i, replica := range c.Replicas {
+		states[i] = c.checkReplica(replica)
+		if states[i].Available {
+			available++
+		} else {
+			log.Log.Warning("Replica is out of read pool. index=[%v] reason=[%v]", i, states[i].Reason)
+		}
+	}
+	c.lock.Lock()
+	c.states = states
+	c.lock.Unlock()
+	return available
+}
+
+// 检测单个从库
+func (c *ClusterPool) checkReplica(replica *DBPool) (state ReplicaState) {
+	state.CheckedAt = time.Now()
+	state.SecondsBehindMaster = SECONDS_BEHIND_MASTER_UNKNOWN
+	health, err := replica.QueryReplicationHealth(nil, ReplicationThreshold{MaxLagSeconds: c.MaxLagSeconds})
+	if nil != err {
+		state.Reason = err.Error()
+		return state
+	}
+	state.SecondsBehindMaster = health.SecondsBehindMaster
+	if !health.IsHealthy() {
+		state.Reason = fmt.Sprintf("state=[%v] %v", health.State, health.Reason)
+		return state
+	}
+	if health.SecondsBehindMaster < 0 {
+		state.Reason = "Seconds_Behind_Master is unknown"
+		return state
+	}
+	state.Available = true
+	return state
+}
+
+// 按interval周期检测从库，直到ctx被取消
+func (c *ClusterPool) Run(ctx context.Context, interval time.Duration) error {
+	if interval <= 0 {
+		return fmt.Errorf("Invalid replica check interval=[%v]", interval)
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		c.RefreshReplicas()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// 从库检测结果的副本，顺序与Replicas一致
+func (c *ClusterPool) ReplicaStates() []ReplicaState {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return append([]ReplicaState(nil), c.states...)
+}
+
+// 选择一个读库，没有可用从库时返回主库
+func (c *ClusterPool) Reader() *DBPool {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	n := len(c.states)
+	// Replicas被修改但尚未重新检测时，只使用已检测的从库
+	if n > len(c.Replicas) {
+		n = len(c.Replicas)
+	}
+	if 0 == n {
+		return c.Primary
+	}
+	start := int(atomic.AddUint64(&c.next, 1) % uint64(n))
+	chosen := -1
+	for i := 0; i < n; i++ {
+		index := (start + i) % n
+		state := c.states[index]
+		if !state.Available {
+			continue
+		}
+		if Balance_Round_Robin == c.Mode {
+			chosen = index
+			break
+		}
+		if -1 == chosen || state.SecondsBehindMaster < c.states[chosen].SecondsBehindMaster {
+			chosen = index
+		}
+	}
+	if -1 == chosen {
+		return c.Primary
+	}
+	return c.Replicas[chosen]
+}
+
+// 根据语句及执行者选择连接池，exec不为nil时语句在exec所属的会话内执行，使用主库
+func (c *ClusterPool) route(exec Executor, sqlText string) *DBPool {
+	if nil != exec || !IsReplicaRead(sqlText) {
+		return c.Primary
+	}
+	return c.Reader()
+}
+
+/*
+ * 是否为可在从库执行的读语句：以SELECT或WITH开头且不加锁
+ * 忽略开头的空白、注释及括号
+ */
+func IsReplicaRead(sqlText string) bool {
+	text := strings.TrimLeft(stripLeadingComments(sqlText), "( \t\r\n")
+	keyword := strings.ToUpper(firstWord(text))
+	if "SELECT" != keyword && "WITH" != keyword {
+		return false
+	}
+	return !lockingReadPattern.MatchString(sqlText)
+}
+
+// 去掉开头的/* */、#及--注释
+func stripLeadingComments(sqlText string) string {
+	text := strings.TrimSpace(sqlText)
+	for {
+		switch {
+		case strings.HasPrefix(text, "/*"):
+			end := strings.Index(text, "*/")
+			if -1 == end {
+				return ""
+			}
+			text = text[end+2:]
+		case strings.HasPrefix(text, "#"), strings.HasPrefix(text, "-- "):
+			end := strings.IndexByte(text, '\n')
+			if -1 == end {
+				return ""
+			}
+			text = text[end+1:]
+		default:
+			return text
+		}
+		text = strings.TrimSpace(text)
+	}
+}
+
+func firstWord(text string) string {
+	end := strings.IndexFunc(text, func(r rune) bool {
+		return !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z')
+	})
+	if -1 == end {
+		return text
+	}
+	return text[:end]
+}
+
+/*
+ * 查询，接口与DBPool.DBQuery一致
+ * 传入trx或conn时在对应会话内执行，否则按语句类型选择主库或从库
+ */
+func (c *ClusterPool) DBQuery(trxInvalOpt *sql.Tx, connInvalOpt *sql.Conn, timeout int, sqlText string, params ...interface{}) (res *QueryResult, err error) {
+	exec, err := pickExecutor(trxInvalOpt, connInvalOpt)
+	if nil != err {
+		return &QueryResult{QueryCost: -1.0, Error: err}, err
+	}
+	return c.QueryWithExecutor(exec, timeout, sqlText, params...)
+}
+
+// 使用指定的Executor查询，exec为nil时按语句类型选择主库或从库
+func (c *ClusterPool) QueryWithExecutor(exec Executor, timeout int, sqlText string, params ...interface{}) (res *QueryResult, err error) {
+	if nil == c.Primary {
+		err = errors.New("ClusterPool has no primary")
+		return &QueryResult{QueryCost: -1.0, Error: err}, err
+	}
+	return c.route(exec, sqlText).QueryWithExecutor(exec, timeout, sqlText, params...)
+}
+
+// 使用调用方传入的ctx查询，exec为nil时按语句类型选择主库或从库
+func (c *ClusterPool) DBQueryContext(ctx context.Context, exec Executor, sqlText string, params ...interface{}) (res *QueryResult, err error) {
+	if nil == c.Primary {
+		err = errors.New("ClusterPool has no primary")
+		return &QueryResult{QueryCost: -1.0, Error: err}, err
+	}
+	return c.route(exec, sqlText).DBQueryContext(ctx, exec, sqlText, params...)
+}
+
+// 在主库执行ddl或dml语句
+func (c *ClusterPool) DBExec(trxInvalOpt *sql.Tx, connInvalOpt *sql.Conn, timeout int, sqlText string, params ...interface{}) (res *QueryResult, err error) {
+	return c.Primary.DBExec(trxInvalOpt, connInvalOpt, timeout, sqlText, params...)
+}
+
+// 在主库使用指定的Executor执行ddl或dml语句
+func (c *ClusterPool) ExecWithExecutor(exec Executor, timeout int, sqlText string, params ...interface{}) (res *QueryResult, err error) {
+	return c.Primary.ExecWithExecutor(exec, timeout, sqlText, params...)
+}
+
+// 在主库使用调用方传入的ctx执行ddl或dml语句
+func (c *ClusterPool) DBExecContext(ctx context.Context, exec Executor, sqlText string, params ...interface{}) (res *QueryResult, err error) {
+	return c.Primary.DBExecContext(ctx, exec, sqlText, params...)
+}
+
+// 在主库开启事务
+func (c *ClusterPool) BeginTrx() (trx *sql.Tx, err error) {
+	return c.Primary.BeginTrx()
+}
@@ -0,0 +1,127 @@
+package mysql
+
+import (
+	"database/sql/driver"
+	"testing"
+)
+
+// 构造一个返回指定复制状态的从库
+func newFakeReplica(t *testing.T, sqlRunning string, lag interface{}) (*DBPool, *fakeServer) {
+	return newFakePool(t, map[string]fakeResult{
+		"SHOW SLAVE STATUS": {
+			columns: []string{"Master_Host", "Slave_IO_Running", "Slave_SQL_Running", "Seconds_Behind_Master", "Channel_Name"},
+			rows:    [][]driver.Value{{"10.0.0.1", "Yes", sqlRunning, lag, ""}},
+		},
+		"select a": fakeSequenceRows("id", 1),
+	})
+}
+
+// 统计server执行select a的次数
+func countSelect(server *fakeServer) int {
+	count := 0
+	for _, query := range server.executedSQL() {
+		if "select a" == query {
+			count++
+		}
+	}
+	return count
+}
+
+func TestIsReplicaRead(t *testing.T) {
+	cases := map[string]bool{
+		"select * from t":                         true,
+		"  /* hint */ SELECT 1":                   true,
+		"(select 1) union (select 2)":             true,
+		"with a as (select 1) select * from a":    true,
+		"-- comment\nselect 1":                    true,
+		"select * from t where id = 1 for update": false,
+		"SELECT * FROM t FOR SHARE":               false,
+		"select * from t lock in share mode":      false,
+		"insert into t values(1)":                 false,
+		"show master status":                      false,
+		"selected":                                false,
+	}
+	for sqlText, want := range cases {
+		if got := IsReplicaRead(sqlText); got != want {
+			t.Errorf("IsReplicaRead(%q)=%v, want %v", sqlText, got, want)
+		}
+	}
+}
+
+func TestClusterPoolRoute(t *testing.T) {
+	primary, primaryServer := newFakePool(t, map[string]fakeResult{
+		"select a":            fakeSequenceRows("id", 1),
+		"select a for update": fakeSequenceRows("id", 1),
+		"update a":            {rowsAffected: 1},
+	})
+	replica1, server1 := newFakeReplica(t, "Yes", int64(1))
+	replica2, server2 := newFakeReplica(t, "Yes", int64(5))
+	cluster := NewClusterPool(primary, []*DBPool{replica1, replica2}, Balance_Round_Robin, 10)
+
+	// 检测前读主库
+	mustQuery(t, cluster.Primary, nil, "select a")
+	if cluster.Reader() != primary {
+		t.Errorf("replicas should not be used before check")
+	}
+
+	if 2 != cluster.RefreshReplicas() {
+		t.Fatalf("unexpected replica states. states=[%+v]", cluster.ReplicaStates())
+	}
+	for i := 0; i < 4; i++ {
+		res, err := cluster.DBQuery(nil, nil, 3, "select a")
+		if nil != err {
+			t.Fatalf("DBQuery fail. err=[%v]", err)
+		}
+		res.Close()
+	}
+	if 2 != countSelect(server1) || 2 != countSelect(server2) {
+		t.Errorf("round robin is not balanced. replica1=[%v] replica2=[%v]", countSelect(server1), countSelect(server2))
+	}
+
+	res, err := cluster.DBQuery(nil, nil, 3, "select a for update")
+	if nil != err {
+		t.Fatalf("DBQuery fail. err=[%v]", err)
+	}
+	res.Close()
+	if _, err = cluster.DBExec(nil, nil, 3, "update a"); nil != err {
+		t.Fatalf("DBExec fail. err=[%v]", err)
+	}
+	want := []string{"select a", "select a for update", "update a"}
+	if got := primaryServer.executedSQL(); len(got) != len(want) || got[1] != want[1] || got[2] != want[2] {
+		t.Errorf("primary executed=[%v], want [%v]", got, want)
+	}
+
+	cluster.Mode = Balance_Least_Lag
+	for i := 0; i < 3; i++ {
+		if cluster.Reader() != replica1 {
+			t.Errorf("least lag should choose replica1")
+		}
+	}
+}
+
+func TestClusterPoolEvict(t *testing.T) {
+	primary, _ := newFakePool(t, map[string]fakeResult{})
+	lagging, _ := newFakeReplica(t, "Yes", int64(100))
+	broken, _ := newFakeReplica(t, "No", nil)
+	healthy, _ := newFakeReplica(t, "Yes", int64(0))
+	cluster := NewClusterPool(primary, []*DBPool{lagging, broken, healthy}, Balance_Round_Robin, 10)
+
+	if 1 != cluster.RefreshReplicas() {
+		t.Fatalf("only healthy replica should be available. states=[%+v]", cluster.ReplicaStates())
+	}
+	states := cluster.ReplicaStates()
+	if states[0].Available || states[1].Available || !states[2].Available || 100 != states[0].SecondsBehindMaster {
+		t.Errorf("unexpected replica states. states=[%+v]", states)
+	}
+	for i := 0; i < 3; i++ {
+		if cluster.Reader() != healthy {
+			t.Errorf("reader should be the healthy replica")
+		}
+	}
+
+	// 所有从库不可用时读主库
+	cluster.Replicas = cluster.Replicas[:2]
+	if 0 != cluster.RefreshReplicas() || cluster.Reader() != primary {
+		t.Errorf("reader should fall back to primary. states=[%+v]", cluster.ReplicaStates())
+	}
+}
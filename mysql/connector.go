@@ -10,11 +10,9 @@ import (
 	"errors"
 	"fmt"
 	"go-tools/log"
-	"strconv"
-	"strings"
+	"io"
+	"reflect"
 	"time"
-
-	_ "github.com/go-sql-driver/mysql"
 )
 
 //!统一处理mysql层异常
@@ -24,7 +22,8 @@ func DoQueryException(t interface{}) {
 	}
 }
 
-func CloseRows(rows *sql.Rows) {
+// 关闭结果集，rows可以是*sql.Rows或*Rows
+func CloseRows(rows io.Closer) {
 	defer DoQueryException(rows)
 	closeErr := rows.Close()
 	if nil != closeErr {
@@ -41,6 +40,8 @@ func (db *DBPool) BeginTrx() (trx *sql.Tx, err error) {
 
 /*
  * 查询，支持事务查询、同会话查询及简单查询
+ * trxInvalOpt与connInvalOpt不能同时传入，新代码建议使用QueryWithExecutor
+ * timeout为超时时间，单位秒，<=0时不设置超时；ctx在Rows读完、调用res.Rows.Close()或res.Close()时释放
  *
  * Demo：
  *	事务查询：
@@ -56,7 +57,7 @@ func (db *DBPool) BeginTrx() (trx *sql.Tx, err error) {
  *		Rows.Next()  // Scan()之前需要做Next()
  *		Rows.Scan(&a5)  // Scan只匹配列个数不匹配列名
  *		fmt.Printf("sql=[select database() db.] values=[%v]\n", a5)
- *		Rows.Close()  // 同一个连接或事务内，在执行下一条语句之前必须清空上一条语句的缓存
+ *		res.Close()  // 同一个连接或事务内，在执行下一条语句之前必须清空上一条语句的缓存
  *	}
  *	if err := trx.Rollback(); nil != err {
  *		log.Log.Warning("Rollback fail %v \n", err)
@@ -70,202 +71,337 @@ func (db *DBPool) BeginTrx() (trx *sql.Tx, err error) {
  *	res, err := conn.Query(nil, rwTimeOut, v_conn, "select database();")
  */
 func (db *DBPool) DBQuery(trxInvalOpt *sql.Tx, connInvalOpt *sql.Conn, timeout int, sqlText string, params ...interface{}) (res *QueryResult, err error) {
-	log.Log.Debug("Execute query type SQL . sql=[%s] timeout=[%v]", fmt.Sprintf(sqlText, params...), timeout)
+	exec, err := pickExecutor(trxInvalOpt, connInvalOpt)
+	if nil != err {
+		log.Log.Warning("Query failed. sql=[%s] err=[%v]", LogSQL(sqlText, params...), err)
+		return &QueryResult{QueryCost: -1.0, Error: err}, err
+	}
+	return db.QueryWithExecutor(exec, timeout, sqlText, params...)
+}
 
-	var ctx context.Context
-	// ctx的close在rows close的时候进行
-	if timeout <= 0 {
-		ctx = context.Background()
-	} else {
-		ctx, _ = context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
+/*
+ * 使用指定的Executor查询，exec为nil时使用连接池
+ * timeout为超时时间，单位秒，<=0时不设置超时；ctx在Rows读完、调用res.Rows.Close()或res.Close()时释放
+ */
+func (db *DBPool) QueryWithExecutor(exec Executor, timeout int, sqlText string, params ...interface{}) (res *QueryResult, err error) {
+	ctx, cancel := timeoutContext(timeout)
+	res, err = db.DBQueryContext(ctx, exec, sqlText, params...)
+	// ctx的cancel在rows读完或close的时候进行
+	res.cancel = cancel
+	if nil != err {
+		res.Close()
 	}
+	return res, err
+}
+
+/*
+ * 查询，使用调用方传入的ctx控制超时、取消及传递请求级别的参数
+ * exec可以是*sql.DB、*sql.Conn或*sql.Tx，为nil时使用连接池
+ * 返回的Rows在ctx结束后不可再读取，使用完毕后需要读完Rows或调用res.Rows.Close()、res.Close()
+ */
+func (db *DBPool) DBQueryContext(ctx context.Context, exec Executor, sqlText string, params ...interface{}) (res *QueryResult, err error) {
+	log.Log.Debug("Execute query type SQL . sql=[%s] fingerprint=[%s] deadline=[%v]", LogSQL(sqlText, params...), fingerprintLog(sqlText), ctxDeadline(ctx))
+
 	defer DoQueryException(ctx)
 	res = &QueryResult{QueryCost: -1.0}
-	// 根据是否开启事务，判断调用的方法
+	if err = checkExecutor(exec); nil != err {
+		res.Error = err
+		log.Log.Warning("Query failed. sql=[%s] fingerprint=[%s] err=[%v]", LogSQL(sqlText, params...), fingerprintLog(sqlText), res.Error)
+		return res, res.Error
+	}
+	session, release, err := db.affectSession(ctx, exec)
+	if nil != err {
+		res.Error = err
+		log.Log.Warning("Query failed. sql=[%s] fingerprint=[%s] err=[%v]", LogSQL(sqlText, params...), fingerprintLog(sqlText), res.Error)
+		return res, res.Error
+	}
 	// 此处由于需要在外层对查询结果进行解析，所以不能进行res.Rows.Close()
-	if nil != trxInvalOpt {
-		res.Rows, res.Error = trxInvalOpt.QueryContext(ctx, sqlText, params...)
-		if nil != res.Error {
-			log.Log.Warning("Query failed. sql=[%s] err=[%v]", fmt.Sprintf(sqlText, params...), res.Error)
-		}
-		// 同会话查询
-	} else if nil != connInvalOpt {
-		res.Rows, res.Error = connInvalOpt.QueryContext(ctx, sqlText, params...)
-		if nil != res.Error {
-			log.Log.Warning("Query failed. sql=[%s] err=[%v]", fmt.Sprintf(sqlText, params...), res.Error)
+	start := time.Now()
+	rows, err := db.queryRows(ctx, session, sqlText, params...)
+	res.Error = err
+	if nil != res.Error {
+		db.observe(sqlText, start, -1, res.Error)
+		log.Log.Warning("Query failed. sql=[%s] fingerprint=[%s] err=[%v]", LogSQL(sqlText, params...), fingerprintLog(sqlText), res.Error)
+		release()
+		return res, res.Error
+	}
+	res.Rows = &Rows{Rows: rows, res: res}
+	// 耗时包含读取结果集的时间，在Rows读完或关闭时记录
+	if nil != db.metrics {
+		res.observe = func(err error) {
+			db.observe(sqlText, start, -1, err)
 		}
-		// 简单查询
-	} else {
-		res.Rows, res.Error = db.QueryContext(ctx, sqlText, params...)
-		if nil != res.Error {
-			log.Log.Warning("Query failed. sql=[%s] err=[%v]", fmt.Sprintf(sqlText, params...), res.Error)
+	}
+	// 结果集读完之前会话不能执行其他语句，执行影响在Rows读完或关闭时采集
+	if db.CaptureAffect {
+		res.affect = func() {
+			defer release()
+			db.captureAffect(session, res)
 		}
 	}
-
 	return res, res.Error
-
 }
 
 /*
- * 执行ddl或dml语句，SQL字符串可使用Sprintf格式拼接
+ * 执行ddl或dml语句，参数使用?占位符，日志中的SQL经LogSQL渲染及脱敏
+ * trxInvalOpt与connInvalOpt不能同时传入，新代码建议使用ExecWithExecutor
+ * timeout为超时时间，单位秒，<=0时不设置超时
  */
 func (db *DBPool) DBExec(trxInvalOpt *sql.Tx, connInvalOpt *sql.Conn, timeout int, sqlText string, params ...interface{}) (res *QueryResult, err error) {
-
-	log.Log.Debug("Execute dml\\ddl type SQL. sql=[%s] timeout=[%v]", fmt.Sprintf(sqlText, params...), timeout)
-	var ctx context.Context
-	var cancel context.CancelFunc
-	if timeout <= 0 {
-		ctx, cancel = context.WithCancel(context.Background())
-	} else {
-		ctx, cancel = context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
+	exec, err := pickExecutor(trxInvalOpt, connInvalOpt)
+	if nil != err {
+		log.Log.Warning("Execute failed. sql=[%s] err=[%v]", LogSQL(sqlText, params...), err)
+		return &QueryResult{QueryCost: -1.0, Error: err}, err
 	}
+	return db.ExecWithExecutor(exec, timeout, sqlText, params...)
+}
+
+/*
+ * 使用指定的Executor执行ddl或dml语句，exec为nil时使用连接池
+ * timeout为超时时间，单位秒，<=0时不设置超时
+ */
+func (db *DBPool) ExecWithExecutor(exec Executor, timeout int, sqlText string, params ...interface{}) (res *QueryResult, err error) {
+	ctx, cancel := timeoutContext(timeout)
 	defer cancel()
+	return db.DBExecContext(ctx, exec, sqlText, params...)
+}
+
+/*
+ * 执行ddl或dml语句，使用调用方传入的ctx控制超时、取消及传递请求级别的参数
+ * exec可以是*sql.DB、*sql.Conn或*sql.Tx，为nil时使用连接池
+ */
+func (db *DBPool) DBExecContext(ctx context.Context, exec Executor, sqlText string, params ...interface{}) (res *QueryResult, err error) {
+
+	log.Log.Debug("Execute dml\\ddl type SQL. sql=[%s] fingerprint=[%s] deadline=[%v]", LogSQL(sqlText, params...), fingerprintLog(sqlText), ctxDeadline(ctx))
 	res = &QueryResult{QueryCost: -1.0}
 	defer DoQueryException(ctx)
-	// 根据是否开启事务，判断调用的方法
-	// 此处由于需要在外层对查询结果进行解析，所以不能进行res.Rows.Close()
-	if nil != trxInvalOpt {
-		res.Result, res.Error = trxInvalOpt.ExecContext(ctx, sqlText, params...)
-		if nil != res.Error {
-			log.Log.Warning("Execute failed. sql=[%s] err=[%v]", fmt.Sprintf(sqlText, params...), res.Error)
-		}
-		// 同会话查询
-	} else if nil != connInvalOpt {
-		res.Result, res.Error = connInvalOpt.ExecContext(ctx, sqlText, params...)
-		if nil != res.Error {
-			log.Log.Warning("Execute failed. sql=[%s] err=[%v]", fmt.Sprintf(sqlText, params...), res.Error)
-		}
-		// 简单查询
-	} else {
-		res.Result, res.Error = db.ExecContext(ctx, sqlText, params...)
-		if nil != res.Error {
-			log.Log.Warning("Execute failed. sql=[%s] err=[%v]", fmt.Sprintf(sqlText, params...), res.Error)
-		}
+	if err = checkExecutor(exec); nil != err {
+		res.Error = err
+		log.Log.Warning("Execute failed. sql=[%s] fingerprint=[%s] err=[%v]", LogSQL(sqlText, params...), fingerprintLog(sqlText), res.Error)
+		return res, res.Error
+	}
+	session, release, err := db.affectSession(ctx, exec)
+	if nil != err {
+		res.Error = err
+		log.Log.Warning("Execute failed. sql=[%s] fingerprint=[%s] err=[%v]", LogSQL(sqlText, params...), fingerprintLog(sqlText), res.Error)
+		return res, res.Error
+	}
+	defer release()
+	start := time.Now()
+	res.Result, res.Error = db.execResult(ctx, session, sqlText, params...)
+	db.observe(sqlText, start, resultRowsAffected(res.Result), res.Error)
+	if nil != res.Error {
+		log.Log.Warning("Execute failed. sql=[%s] fingerprint=[%s] err=[%v]", LogSQL(sqlText, params...), fingerprintLog(sqlText), res.Error)
+		return res, res.Error
+	}
+	if db.CaptureAffect {
+		db.captureAffect(session, res)
 	}
-
 	return res, res.Error
+}
 
+// exec为nil时返回连接池
+func (db *DBPool) executor(exec Executor) Executor {
+	if nil == exec {
+		return db.DB
+	}
+	return exec
 }
 
-/*
- * show status 或 show variables语句执行接口
- */
-func (db *DBPool) QueryShow(trxInvalOpt *sql.Tx, connInvalOpt *sql.Conn, showTag string, variableName string) (value string, err error) {
+// 兼容trx、conn两个可选参数的旧接口，二者同时传入时报错，均为nil时返回nil(使用连接池)
+func pickExecutor(trxInvalOpt *sql.Tx, connInvalOpt *sql.Conn) (Executor, error) {
+	if nil != trxInvalOpt && nil != connInvalOpt {
+		return nil, errors.New("Transaction and connection can not be used at the same time")
+	}
+	if nil != trxInvalOpt {
+		return trxInvalOpt, nil
+	}
+	if nil != connInvalOpt {
+		return connInvalOpt, nil
+	}
+	return nil, nil
+}
 
-	sqlText := fmt.Sprintf("SHOW %v LIKE '%v'", showTag, variableName)
-	// 执行查询
-	res, err := db.DBQuery(trxInvalOpt, connInvalOpt, common.Config.RWTimeOutSec, sqlText)
-	defer DoQueryException(res.Rows)
-	defer CloseRows(res.Rows)
-	if nil != err {
-		log.Log.Warning("Fail to exec SHOW Query. sql=[%v] reason=[%v]", sqlText, err)
-		return "", err
+// 是否为会话级Executor(*sql.Conn、*sql.Tx或*Trx)，会话级的SHOW WARNINGS等语句只能在同一会话内执行
+func isSessionExecutor(exec Executor) bool {
+	if nil != checkExecutor(exec) {
+		return false
 	}
+	switch exec.(type) {
+	case *sql.Conn, *sql.Tx, *Trx:
+		return true
+	}
+	return false
+}
 
-	// 读取结果
-	var variable queryShow
-	if nil == res.Rows {
-		errStr := fmt.Sprintf("No result for query . sql=[%v]", sqlText)
-		return value, errors.New(errStr)
+// 持有nil指针的Executor(如(*sql.Tx)(nil))会在database/sql内部panic，提前返回错误；exec为nil时使用连接池，不报错
+func checkExecutor(exec Executor) error {
+	var isNil bool
+	switch e := exec.(type) {
+	case nil:
+		return nil
+	case *Trx:
+		isNil = nil == e || nil == e.Tx
+	default:
+		value := reflect.ValueOf(exec)
+		isNil = reflect.Ptr == value.Kind() && value.IsNil()
 	}
-	res.Rows.Next()
-	err = res.Rows.Scan(&variable.VariableName, &variable.Value)
-	if nil != err {
-		log.Log.Warning("Fail to exec SHOW Query. sql=[%v] reason=[%v]", sqlText, err)
-		return "", err
+	if isNil {
+		return fmt.Errorf("Executor is a nil pointer. type=[%T]", exec)
 	}
-	return variable.Value, err
+	return nil
+}
+
+// 根据超时秒数生成ctx，timeout<=0时不设置超时
+func timeoutContext(timeout int) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
+}
+
+// 日志中展示ctx的截止时间，未设置时返回none
+func ctxDeadline(ctx context.Context) string {
+	if deadline, ok := ctx.Deadline(); ok {
+		return deadline.Format(log.TIME_FORMAT)
+	}
+	return "none"
 }
 
 /*
- * 查看执行Warning信息
+ * 释放查询结果：关闭Rows、采集执行影响(开启CaptureAffect时)并释放查询使用的ctx
+ * 采集到需要提升的warning时写入res.Error；可重复调用
  */
-func (db *DBPool) showWarning(conn *sql.Conn) (warnings []QueryWarning, err error) {
-	res, err := db.DBQuery(nil, conn, common.Config.RWTimeOutSec, "SHOW WARNINGS")
-	defer DoQueryException(res.Rows)
-	defer CloseRows(res.Rows)
-	if nil != err {
-		log.Log.Warning("Fail to exec SHOW WARNINGS. reason=[%v]", err)
-		return nil, err
+func (res *QueryResult) Close() {
+	if nil == res {
+		return
 	}
-	if nil == res.Rows {
-		return nil, err
+	if nil != res.Rows {
+		CloseRows(res.Rows)
 	}
-	for res.Rows.Next() {
-		var warning QueryWarning
-		err := res.Rows.Scan(&warning.Level, &warning.Code, &warning.Message)
-		if nil != err {
-			log.Log.Warning("Fail to exec SHOW WARNINGS. reason=[%v]", err)
-			return nil, err
+	res.finish()
+}
+
+// 结果集结束后记录监控、采集执行影响、归还会话并释放查询使用的ctx，可重复调用
+func (res *QueryResult) finish() {
+	if nil != res.observe {
+		observe := res.observe
+		res.observe = nil
+		var err error
+		if nil != res.Rows {
+			err = res.Rows.Rows.Err()
 		}
-		warnings = append(warnings, warning)
+		observe(err)
+	}
+	if nil != res.affect {
+		affect := res.affect
+		res.affect = nil
+		affect()
+	}
+	if nil != res.cancel {
+		res.cancel()
+		res.cancel = nil
 	}
-	return warnings, err
+}
+
+// 读取下一行，读到末尾或出错时采集执行影响并释放查询占用的会话及ctx
+func (r *Rows) Next() bool {
+	if r.Rows.Next() {
+		return true
+	}
+	r.res.finish()
+	return false
+}
+
+// 关闭结果集，采集执行影响并释放查询占用的会话及ctx，可重复调用
+func (r *Rows) Close() error {
+	err := r.Rows.Close()
+	r.res.finish()
+	return err
+}
+
+// 读取出错时返回读取错误，否则返回结果集结束后由warning提升的错误
+func (r *Rows) Err() error {
+	if err := r.Rows.Err(); nil != err {
+		return err
+	}
+	return r.res.Error
 }
 
 /*
- * 查询同一个会话内上一条语句的执行影响及消耗
+ * show status 或 show variables语句执行接口，返回按名称排序的第一个匹配值
+ * showTag为[GLOBAL|SESSION] {VARIABLES|STATUS}，variableName为LIKE模式，只允许字母、数字、_及%
+ * exec为nil时使用连接池，查询会话级变量时需传入*sql.Conn或*sql.Tx
+ * 需要多个值时使用ShowSnapshot
  */
-func (db *DBPool) ShowAffect(conn *sql.Conn) (warning []QueryWarning, queryCost float64, err error) {
-	// SHOW WARNINGS
-	warning, err = db.showWarning(conn)
+func (db *DBPool) QueryShow(exec Executor, showTag string, variableName string) (value string, err error) {
+	kind, scope, err := parseShowTag(showTag)
 	if nil != err {
-		log.Log.Warning("Fail to show warning. reason=[%v]", err)
+		log.Log.Warning("Fail to exec SHOW Query. reason=[%v]", err)
+		return "", err
 	}
-	// SHOW session status LIKE 'last_query_cost';
-	queryCostStr, err := db.QueryShow(nil, conn, "SESSION STATUS", "last_query_cost")
+	snapshot, err := db.ShowSnapshot(exec, kind, scope, variableName)
 	if nil != err {
-		log.Log.Warning("Fail to get SQL last_query_cost. reason=[%v]", err)
-		return warning, queryCost, err
+		return "", err
 	}
-	queryCost, err = strconv.ParseFloat(queryCostStr, 64)
-	if nil != err {
-		log.Log.Warning("Fail to trans string to float64. reason=[%v] vars=[%v]", err, queryCostStr)
+	names := snapshot.Names()
+	if 0 == len(names) {
+		err = fmt.Errorf("No result for query . show=[%v] name=[%v]", showTag, variableName)
+		return "", err
+	}
+	return snapshot.Values[names[0]], nil
+}
+
+/*
+ * 查询同一个会话内上一条语句的执行影响及消耗
+ * exec必须为执行上一条语句的*sql.Conn或*sql.Tx，连接池无法保证与上一条语句在同一会话
+ */
+func (db *DBPool) ShowAffect(exec Executor) (warning []QueryWarning, queryCost float64, err error) {
+	if !isSessionExecutor(exec) {
+		err = fmt.Errorf("ShowAffect need a session executor(*sql.Conn or *sql.Tx). type=[%T]", exec)
+		log.Log.Warning("Fail to show affect. reason=[%v]", err)
 		return warning, queryCost, err
 	}
-	return warning, queryCost, err
+	ctx, cancel := timeoutContext(db.rwTimeout())
+	defer cancel()
+	return readAffect(ctx, exec)
+}
+
+/*
+ * show master status 语句执行接口，exec为nil时使用连接池
+ * 按列名解析，兼容FDB等分支多出的列
+ */
+func (db *DBPool) QueryMasterStatus(exec Executor) (masterStatus QueryMasterStatus, err error) {
+	ctx, cancel := timeoutContext(db.rwTimeout())
+	defer cancel()
+	return db.QueryMasterStatusContext(ctx, exec)
 }
 
 /*
- * show master status 语句执行接口
+ * show master status 语句执行接口，使用调用方传入的ctx控制超时及取消
+ * exec为nil时使用连接池
  */
-func (db *DBPool) QueryMasterStatus() (masterStatus QueryMasterStatus, err error) {
+func (db *DBPool) QueryMasterStatusContext(ctx context.Context, exec Executor) (masterStatus QueryMasterStatus, err error) {
 
-	//rows, err := db.Db.Query("SHOW MASTER STATUS")
-	res, err := db.DBQuery(nil, nil, common.Config.RWTimeOutSec, "SHOW MASTER STATUS")
+	res, err := db.DBQueryContext(ctx, exec, "SHOW MASTER STATUS")
 
 	defer DoQueryException(res.Rows)
-	defer CloseRows(res.Rows)
+	defer res.Close()
 	if nil != err {
 		log.Log.Warning("Fail to exec SHOW MASTER STATUS. reason=[%v]", err)
 		return masterStatus, err
 	}
-	if nil == res.Rows {
-		errStr := fmt.Sprintf("No result for query . sql=[SHOW MASTER STATUS]")
-		return masterStatus, errors.New(errStr)
+	records, err := scanStatusRows(res.Rows)
+	if nil != err {
+		log.Log.Warning("Fail to exec SHOW MASTER STATUS. reason=[%v]", err)
+		return masterStatus, err
 	}
-	if !res.Rows.Next() {
+	if 0 == len(records) {
 		errStr := fmt.Sprintf("No result for query")
 		log.Log.Debug("Fail to exec SHOW MASTER STATUS. MySQL may have closed the binlog. reason=[%v] sql=[SHOW MASTER STATUS]", errStr)
 		return masterStatus, errors.New(errStr)
 	}
-	if common.Config.Isfdb == 0 {
-		err = res.Rows.Scan(&masterStatus.File,
-			&masterStatus.Position,
-			&masterStatus.Binlog_Do_DB,
-			&masterStatus.Binlog_Ignore_DB,
-			&masterStatus.Executed_Gtid_Set,
-		)
-	} else { //适配FDB
-		var xacid string
-		err = res.Rows.Scan(&masterStatus.File,
-			&masterStatus.Position,
-			&masterStatus.Binlog_Do_DB,
-			&masterStatus.Binlog_Ignore_DB,
-			&masterStatus.Executed_Gtid_Set,
-			&xacid, //适配FDB,占位
-		)
-	}
+	masterStatus, err = parseMasterStatus(records[0])
 	if nil != err {
 		log.Log.Warning("Fail to exec SHOW MASTER STATUS. reason=[%v]", err)
 		return masterStatus, err
@@ -274,164 +410,85 @@ func (db *DBPool) QueryMasterStatus() (masterStatus QueryMasterStatus, err error
 }
 
 /*
- * show slave status 语句执行接口
+ * show slave status 语句执行接口，exec为nil时使用连接池
+ * 多通道复制时返回默认通道(Channel_Name为空)，不存在默认通道时返回第一个通道
+ * 非从库返回空结构体及nil
+ */
+func (db *DBPool) QuerySlaveStatus(exec Executor) (slaveStatus QuerySlaveStatus, err error) {
+	ctx, cancel := timeoutContext(db.rwTimeout())
+	defer cancel()
+	return db.QuerySlaveStatusContext(ctx, exec)
+}
+
+/*
+ * show slave status 语句执行接口，使用调用方传入的ctx控制超时及取消，通道选择同QuerySlaveStatus
+ * exec为nil时使用连接池
+ */
+func (db *DBPool) QuerySlaveStatusContext(ctx context.Context, exec Executor) (slaveStatus QuerySlaveStatus, err error) {
+	channels, err := db.QuerySlaveStatusChannelsContext(ctx, exec)
+	if nil != err || 0 == len(channels) {
+		return slaveStatus, err
+	}
+	for _, channel := range channels {
+		if "" == channel.Channel_Name {
+			return channel, nil
+		}
+	}
+	return channels[0], nil
+}
+
+/*
+ * show slave status 语句执行接口，每个复制通道返回一个结构体
+ * 1、按列名解析，兼容MySQL 5.6/5.7/8.0及FDB的列差异，NULL列不影响其他列赋值
+ * 2、按db.Flavor及版本选择SHOW REPLICA STATUS或SHOW SLAVE STATUS，语法不支持时自动改用另一种
+ * 3、非从库返回空切片及nil
+ * exec为nil时使用连接池
  */
-func (db *DBPool) QuerySlaveStatus() (slaveStatus QuerySlaveStatus, err error) {
-	//defer DoQueryException(db.DbConn)
-	//rows, err := db.Db.Query("SHOW SLAVE STATUS")
+func (db *DBPool) QuerySlaveStatusChannels(exec Executor) (channels []QuerySlaveStatus, err error) {
+	ctx, cancel := timeoutContext(db.rwTimeout())
+	defer cancel()
+	return db.QuerySlaveStatusChannelsContext(ctx, exec)
+}
 
-	// 获得一个单独的空闲连接
-	res, err := db.DBQuery(nil, nil, common.Config.RWTimeOutSec, "SHOW SLAVE STATUS")
+/*
+ * show slave status 语句执行接口，使用调用方传入的ctx控制超时及取消，返回值同QuerySlaveStatusChannels
+ * exec为nil时使用连接池
+ */
+func (db *DBPool) QuerySlaveStatusChannelsContext(ctx context.Context, exec Executor) (channels []QuerySlaveStatus, err error) {
+	sqlText, fallback := "SHOW SLAVE STATUS", "SHOW REPLICA STATUS"
+	if db.preferReplicaSyntax() {
+		sqlText, fallback = fallback, sqlText
+	}
+	res, err := db.DBQueryContext(ctx, exec, sqlText)
+	if nil != err && isMySQLError(err, ER_PARSE_ERROR) {
+		res.Close()
+		sqlText = fallback
+		res, err = db.DBQueryContext(ctx, exec, sqlText)
+	}
 
 	defer DoQueryException(res.Rows)
-	defer CloseRows(res.Rows)
+	defer res.Close()
 	if nil != err {
-		log.Log.Warning("Fail to exec SHOW SLAVE STATUS. reason=[%v]", err)
-		return slaveStatus, err
+		log.Log.Warning("Fail to exec %v. reason=[%v]", sqlText, err)
+		return nil, err
 	}
-	if !res.Rows.Next() {
-		errStr := fmt.Sprintf("No result for query")
-		log.Log.Debug("Fail to exec SHOW SLAVE STATUS. This node may a master node. reason=[%v] sql=[SHOW SLAVE STATUS]", errStr)
-		return slaveStatus, nil
-	}
-	if common.Config.Isfdb == 0 {
-		err = res.Rows.Scan(&slaveStatus.Slave_IO_State,
-			&slaveStatus.Master_Host,
-			&slaveStatus.Master_User,
-			&slaveStatus.Master_Port,
-			&slaveStatus.Connect_Retry,
-			&slaveStatus.Master_Log_File,
-			&slaveStatus.Read_Master_Log_Pos,
-			&slaveStatus.Relay_Log_File,
-			&slaveStatus.Relay_Log_Pos,
-			&slaveStatus.Relay_Master_Log_File,
-			&slaveStatus.Slave_IO_Running,
-			&slaveStatus.Slave_SQL_Running,
-			&slaveStatus.Replicate_Do_DB,
-			&slaveStatus.Replicate_Ignore_DB,
-			&slaveStatus.Replicate_Do_Table,
-			&slaveStatus.Replicate_Ignore_Table,
-			&slaveStatus.Replicate_Wild_Do_Table,
-			&slaveStatus.Replicate_Wild_Ignore_Table,
-			&slaveStatus.Last_Errno,
-			&slaveStatus.Last_Error,
-			&slaveStatus.Skip_Counter,
-			&slaveStatus.Exec_Master_Log_Pos,
-			&slaveStatus.Relay_Log_Space,
-			&slaveStatus.Until_Condition,
-			&slaveStatus.Until_Log_File,
-			&slaveStatus.Until_Log_Pos,
-			&slaveStatus.Master_SSL_Allowed,
-			&slaveStatus.Master_SSL_CA_File,
-			&slaveStatus.Master_SSL_CA_Path,
-			&slaveStatus.Master_SSL_Cert,
-			&slaveStatus.Master_SSL_Cipher,
-			&slaveStatus.Master_SSL_Key,
-			&slaveStatus.Seconds_Behind_Master,
-			&slaveStatus.Master_SSL_Verify_Server_Cert,
-			&slaveStatus.Last_IO_Errno,
-			&slaveStatus.Last_IO_Error,
-			&slaveStatus.Last_SQL_Errno,
-			&slaveStatus.Last_SQL_Error,
-			&slaveStatus.Replicate_Ignore_Server_Ids,
-			&slaveStatus.Master_Server_Id,
-			&slaveStatus.Master_UUID,
-			&slaveStatus.Master_Info_File,
-			&slaveStatus.SQL_Delay,
-			&slaveStatus.SQL_Remaining_Delay,
-			&slaveStatus.Slave_SQL_Running_State,
-			&slaveStatus.Master_Retry_Count,
-			&slaveStatus.Master_Bind,
-			&slaveStatus.Last_IO_Error_Timestamp,
-			&slaveStatus.Last_SQL_Error_Timestamp,
-			&slaveStatus.Master_SSL_Crl,
-			&slaveStatus.Master_SSL_Crlpath,
-			&slaveStatus.Retrieved_Gtid_Set,
-			&slaveStatus.Executed_Gtid_Set,
-			&slaveStatus.Auto_Position,
-			&slaveStatus.Replicate_Rewrite_DB,
-			&slaveStatus.Channel_Name,
-			&slaveStatus.Master_TLS_Version,
-		)
-	} else { //适配FDB
-		var semiSyncGroup string
-		var iOCachedGtidSet string
-		err = res.Rows.Scan(&slaveStatus.Slave_IO_State,
-			&slaveStatus.Master_Host,
-			&slaveStatus.Master_User,
-			&slaveStatus.Master_Port,
-			&slaveStatus.Connect_Retry,
-			&slaveStatus.Master_Log_File,
-			&slaveStatus.Read_Master_Log_Pos,
-			&slaveStatus.Relay_Log_File,
-			&slaveStatus.Relay_Log_Pos,
-			&slaveStatus.Relay_Master_Log_File,
-			&slaveStatus.Slave_IO_Running,
-			&slaveStatus.Slave_SQL_Running,
-			&slaveStatus.Replicate_Do_DB,
-			&slaveStatus.Replicate_Ignore_DB,
-			&slaveStatus.Replicate_Do_Table,
-			&slaveStatus.Replicate_Ignore_Table,
-			&slaveStatus.Replicate_Wild_Do_Table,
-			&slaveStatus.Replicate_Wild_Ignore_Table,
-			&slaveStatus.Last_Errno,
-			&slaveStatus.Last_Error,
-			&slaveStatus.Skip_Counter,
-			&slaveStatus.Exec_Master_Log_Pos,
-			&slaveStatus.Relay_Log_Space,
-			&slaveStatus.Until_Condition,
-			&slaveStatus.Until_Log_File,
-			&slaveStatus.Until_Log_Pos,
-			&slaveStatus.Master_SSL_Allowed,
-			&slaveStatus.Master_SSL_CA_File,
-			&slaveStatus.Master_SSL_CA_Path,
-			&slaveStatus.Master_SSL_Cert,
-			&slaveStatus.Master_SSL_Cipher,
-			&slaveStatus.Master_SSL_Key,
-			&slaveStatus.Seconds_Behind_Master,
-			&slaveStatus.Master_SSL_Verify_Server_Cert,
-			&slaveStatus.Last_IO_Errno,
-			&slaveStatus.Last_IO_Error,
-			&slaveStatus.Last_SQL_Errno,
-			&slaveStatus.Last_SQL_Error,
-			&slaveStatus.Replicate_Ignore_Server_Ids,
-			&slaveStatus.Master_Server_Id,
-			&slaveStatus.Master_UUID,
-			&slaveStatus.Master_Info_File,
-			&slaveStatus.SQL_Delay,
-			&slaveStatus.SQL_Remaining_Delay,
-			&slaveStatus.Slave_SQL_Running_State,
-			&semiSyncGroup, //适配FDB,占位
-			&slaveStatus.Master_Retry_Count,
-			&slaveStatus.Master_Bind,
-			&slaveStatus.Last_IO_Error_Timestamp,
-			&slaveStatus.Last_SQL_Error_Timestamp,
-			&slaveStatus.Master_SSL_Crl,
-			&slaveStatus.Master_SSL_Crlpath,
-			&iOCachedGtidSet, //适配FDB,占位
-			&slaveStatus.Retrieved_Gtid_Set,
-			&slaveStatus.Executed_Gtid_Set,
-			&slaveStatus.Auto_Position,
-			//&slaveStatus.Replicate_Rewrite_DB,
-			//&slaveStatus.Channel_Name,
-			//&slaveStatus.Master_TLS_Version,
-		)
-	}
-	log.Log.Debug("slaveStatus=[%v]", slaveStatus)
+	records, err := scanStatusRows(res.Rows)
 	if nil != err {
-		// 列赋值失败的问题不进行报错处理
-		if !strings.Contains(err.Error(), ROW_PART_COLUMN_SCAN_ERROR) {
-			log.Log.Warning("Fail to exec SHOW SLAVE STATUS. reason=[%v]", err)
-			return slaveStatus, err
-		}
+		log.Log.Warning("Fail to exec %v. reason=[%v]", sqlText, err)
+		return nil, err
 	}
-	// 由于健康的从库状态中SQL_Remaining_Delay的值为nil导致rows.scan赋值到该列后终止，Executed_Gtid_Set的值被丢弃
-	// Executed_Gtid_Set暂时通过show master status来获得
-	masterStatus, err := db.QueryMasterStatus()
-	if nil != err {
-		log.Log.Warning("Fail to exec get Executed_Gtid_Set Info. reason=[%v]", err)
-		return slaveStatus, err
+	if 0 == len(records) {
+		log.Log.Debug("Fail to exec %v. This node may a master node. reason=[No result for query]", sqlText)
+		return nil, nil
+	}
+	for _, record := range records {
+		slaveStatus, err := parseSlaveStatus(record)
+		if nil != err {
+			log.Log.Warning("Fail to exec %v. reason=[%v]", sqlText, err)
+			return channels, err
+		}
+		channels = append(channels, slaveStatus)
 	}
-	slaveStatus.Executed_Gtid_Set = masterStatus.Executed_Gtid_Set
-	return slaveStatus, nil
+	log.Log.Debug("slaveStatus=[%v]", channels)
+	return channels, nil
 }
@@ -4,8 +4,10 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	toolsLog "go-tools/log"
 	"log"
-	"mysql-agent/common"
+	"net"
+	"strconv"
 	"sync"
 	"testing"
 	"time"
@@ -18,10 +20,10 @@ type Connector struct {
 	Passwd            string
 	Charset           string
 	Database          string
-	connectTimeoutSec string     //连接超时时间，单位秒
+	connectTimeoutSec int        //连接超时时间，单位秒
 	RwTimeoutSec      int        //读写超时时间，单位秒
-	maxOpenConns      int        //连接池最大连接数,暂时没用，生效的是sql.DB.maxOpen
-	maxIdleConns      int        //连接池最大空闲连接数,暂时没用，生效的是sql.DB.maxIdle
+	maxOpenConns      int        //连接池最大连接数
+	maxIdleConns      int        //连接池最大空闲连接数
 	DbConnLock        sync.Mutex // DbConn使用锁
 	DbConn            *sql.Conn
 	Db                *sql.DB
@@ -40,25 +42,34 @@ func init() {
 		Passwd:            "_Y5%C2wncJC6b^frHdiEKw*kn05VNN",
 		Charset:           "utf8mb4",
 		Database:          "cortex_server",
-		connectTimeoutSec: "2s",
+		connectTimeoutSec: 2,
 		RwTimeoutSec:      2,
-		maxOpenConns:      10,
-		maxIdleConns:      5,
+		maxOpenConns:      5,
+		maxIdleConns:      2,
 	}
 
-	var err error
-	dataSource := fmt.Sprintf("%v:%v@tcp(%v:%v)/%v?timeout=%v&charset=%v,parseTime=%v",
-		param.User, param.Passwd, param.Addr, param.Port, param.Database, param.connectTimeoutSec,
-		param.Charset, "true")
-	monitorDBPool.DB, err = sql.Open("mysql", dataSource)
+	pool, err := NewDBPool(PoolOptions{
+		DSN: &toolsLog.DSN{
+			Addr:           net.JoinHostPort(param.Addr, strconv.Itoa(param.Port)),
+			User:           param.User,
+			Password:       param.Passwd,
+			Schema:         param.Database,
+			Charset:        param.Charset,
+			ConnectTimeout: param.connectTimeoutSec,
+			ReadTimeout:    param.RwTimeoutSec,
+			WriteTimeout:   param.RwTimeoutSec,
+			ParseTime:      true,
+		},
+		MaxOpenConns:    param.maxOpenConns,
+		MaxIdleConns:    param.maxIdleConns,
+		ConnMaxLifetime: DEFAULT_CONN_MAX_LIFETIME,
+		RWTimeOutSec:    param.RwTimeoutSec,
+	})
 	if nil != err {
-		common.Log.Warning("open fail %v \n", err)
+		toolsLog.Log.Warning("open fail %v \n", err)
+		return
 	}
-
-	monitorDBPool.SetMaxOpenConns(param.maxOpenConns)
-	monitorDBPool.SetMaxOpenConns(5)
-	monitorDBPool.SetMaxIdleConns(2)
-
+	monitorDBPool = *pool
 }
 
 func TestQuery(t *testing.T) {
@@ -71,11 +82,11 @@ func TestQuery(t *testing.T) {
 
 		conn, err := monitorDBPool.Conn(context.Background())
 		if nil != err {
-			common.Log.Warning("open fail %v , conn=[%v]\n", err, conn)
+			toolsLog.Log.Warning("open fail %v , conn=[%v]\n", err, conn)
 		}
 		defer conn.Close()
 		if nil != err {
-			common.Log.Warning("Get conn fail %v \n", err)
+			toolsLog.Log.Warning("Get conn fail %v \n", err)
 		}
 		var a5 string
 
@@ -83,7 +94,7 @@ func TestQuery(t *testing.T) {
 
 		res, err := monitorDBPool.DBQuery(nil, conn, param.RwTimeoutSec, sql)
 		if nil != err {
-			common.Log.Warning("Query fail %v \n", err)
+			toolsLog.Log.Warning("Query fail %v \n", err)
 		} else {
 			Rows := res.Rows
 			Rows.Next()
@@ -95,12 +106,12 @@ func TestQuery(t *testing.T) {
 		fmt.Println("===============conn:", conn)
 		_, err = monitorDBPool.DBExec(nil, conn, param.RwTimeoutSec, "use mysql;")
 		if nil != err {
-			common.Log.Warning("Exec fail %v \n", err)
+			toolsLog.Log.Warning("Exec fail %v \n", err)
 		}
 		fmt.Println("===============conn:", conn)
 		res, err = monitorDBPool.DBQuery(nil, conn, param.RwTimeoutSec, sql)
 		if nil != err {
-			common.Log.Warning("Query fail %v \n", err)
+			toolsLog.Log.Warning("Query fail %v \n", err)
 		} else {
 			Rows := res.Rows
 			Rows.Next()
@@ -113,7 +124,7 @@ func TestQuery(t *testing.T) {
 		res1.Warning, res1.QueryCost, err = monitorDBPool.ShowAffect(conn)
 
 		if nil != err {
-			common.Log.Warning("ShowAffect fail %v \n", err)
+			toolsLog.Log.Warning("ShowAffect fail %v \n", err)
 		} else {
 			fmt.Println("res.Warning=", res.QueryCost)
 			fmt.Println("res.QueryCost=", res.QueryCost)
@@ -125,7 +136,7 @@ func TestQuery(t *testing.T) {
 
 		res, err = monitorDBPool.DBQuery(nil, conn, param.RwTimeoutSec, querySql)
 		if nil != err {
-			common.Log.Warning("Query fail %v \n", err)
+			toolsLog.Log.Warning("Query fail %v \n", err)
 		} else {
 			Rows := res.Rows
 			Rows.Next()
@@ -134,15 +145,20 @@ func TestQuery(t *testing.T) {
 		}
 
 		fmt.Printf("before set sql_log_bin values=[%v]\n", a2)
-		monitorDBPool.DBExec(nil, conn, param.RwTimeoutSec, "set sql_log_bin = 0;")
+		variables := monitorDBPool.NewVariableBatch(conn)
+		variables.Force = true
+		if err := variables.Set(Set_Session, "sql_log_bin", false); nil != err {
+			toolsLog.Log.Warning("Set sql_log_bin fail %v \n", err)
+		}
+		defer variables.Rollback()
 
 		res, err = monitorDBPool.DBQuery(nil, conn, param.RwTimeoutSec, querySql)
 		if nil != err {
-			common.Log.Warning("Query fail %v \n", err)
+			toolsLog.Log.Warning("Query fail %v \n", err)
 		} else {
 			func() {
 				if err := res.Rows.Close(); nil != err {
-					common.Log.Warning("err=[%v]", err)
+					toolsLog.Log.Warning("err=[%v]", err)
 				}
 			}()
 			Rows := res.Rows
@@ -161,7 +177,7 @@ func TestQuery(t *testing.T) {
 		var a5 string
 		res, err := monitorDBPool.DBQuery(nil, nil, param.RwTimeoutSec, "select id, cluster_id, instance_id, ip, executed_gtid_set  from cortex_server.db_instances")
 		if nil != err {
-			common.Log.Warning("Query fail %v \n", err)
+			toolsLog.Log.Warning("Query fail %v \n", err)
 		} else {
 			Rows := res.Rows
 			Rows.Next()
@@ -202,7 +218,7 @@ func TestQuery(t *testing.T) {
 		/*
 		 *  show master
 		 */
-		masterStatus, err := monitorDBPool.QueryMasterStatus()
+		masterStatus, err := monitorDBPool.QueryMasterStatus(nil)
 		fmt.Println("err=", err)
 		fmt.Println("masterStatus.File=", masterStatus.File)
 		fmt.Println("masterStatus.Position=", masterStatus.Position)
@@ -210,7 +226,7 @@ func TestQuery(t *testing.T) {
 		/*
 		 *  show slave
 		 */
-		slaveStatus, err := monitorDBPool.QuerySlaveStatus()
+		slaveStatus, err := monitorDBPool.QuerySlaveStatus(nil)
 		fmt.Println("err=", err)
 		fmt.Println("slaveStatus=", slaveStatus)
 		fmt.Println("slaveStatus.Slave_IO_Running=", slaveStatus.Slave_IO_Running)
@@ -225,7 +241,7 @@ func TestQuery(t *testing.T) {
 
 		res, err = monitorDBPool.DBQuery(nil, nil, param.RwTimeoutSec, "select database()")
 		if nil != err {
-			common.Log.Warning("Query fail %v \n", err)
+			toolsLog.Log.Warning("Query fail %v \n", err)
 		} else {
 			Rows := res.Rows
 			Rows.Next()
@@ -237,14 +253,14 @@ func TestQuery(t *testing.T) {
 		fmt.Println("================trx start============================")
 		trx, err := monitorDBPool.BeginTrx()
 		if nil != err {
-			common.Log.Warning("Start trx fail。 err=[%v]", err)
+			toolsLog.Log.Warning("Start trx fail。 err=[%v]", err)
 		}
 		getInUse(monitorDBPool.DB)
 		monitorDBPool.DBExec(trx, nil, param.RwTimeoutSec, "use mysql")
 		getInUse(monitorDBPool.DB)
 		res, err = monitorDBPool.DBQuery(trx, nil, param.RwTimeoutSec, "select database() db")
 		if nil != err {
-			common.Log.Warning("Query fail %v \n", err)
+			toolsLog.Log.Warning("Query fail %v \n", err)
 		} else {
 			Rows := res.Rows
 			Rows.Next()
@@ -254,7 +270,7 @@ func TestQuery(t *testing.T) {
 		}
 		getInUse(monitorDBPool.DB)
 		if err := trx.Rollback(); nil != err {
-			common.Log.Warning("Rollback fail %v \n", err)
+			toolsLog.Log.Warning("Rollback fail %v \n", err)
 		}
 		fmt.Println("================trx end============================")
 	}()
@@ -292,7 +308,7 @@ func TestQuery(t *testing.T) {
 	// 单链接查询超时测试
 	conn, err := monitorDBPool.Conn(context.Background())
 	if nil != err {
-		common.Log.Warning("open fail %v , conn=[%v]\n", err, conn)
+		toolsLog.Log.Warning("open fail %v , conn=[%v]\n", err, conn)
 	}
 
 	res, err = monitorDBPool.DBQuery(nil, conn, 3, "select sleep(2)")
@@ -317,7 +333,7 @@ func TestQuery(t *testing.T) {
 	getInUse(monitorDBPool.DB)
 	conn, err = monitorDBPool.Conn(context.Background())
 	if nil != err {
-		common.Log.Warning("open fail %v , conn=[%v]\n", err, conn)
+		toolsLog.Log.Warning("open fail %v , conn=[%v]\n", err, conn)
 	}
 
 	// 单链接执行超时测试
@@ -329,7 +345,7 @@ func TestQuery(t *testing.T) {
 
 	conn, err = monitorDBPool.Conn(context.Background())
 	if nil != err {
-		common.Log.Warning("open fail %v , conn=[%v]\n", err, conn)
+		toolsLog.Log.Warning("open fail %v , conn=[%v]\n", err, conn)
 	}
 	conn.Close()
 
@@ -382,6 +398,6 @@ func TestQuery(t *testing.T) {
 
 func getInUse(db *sql.DB) {
 	stats := db.Stats()
-	common.Log.Notice("in use conns:%v", stats.InUse)
+	toolsLog.Log.Notice("in use conns:%v", stats.InUse)
 
 }
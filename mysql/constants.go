@@ -1,6 +1,7 @@
 package mysql
 
 import (
+	"context"
 	"database/sql"
 
 	_ "github.com/go-sql-driver/mysql"
@@ -9,15 +10,49 @@ import (
 // mysql连接池
 type DBPool struct {
 	*sql.DB
+	CaptureAffect   bool          // 为true时自动采集每条语句的SHOW WARNINGS及last_query_cost
+	PromoteWarnings []int32       // 需要提升为错误的warning码，仅CaptureAffect为true时生效
+	RWTimeOutSec    int           // 内部查询的读写超时，单位秒，<=0时使用DEFAULT_RW_TIMEOUT_SEC
+	Flavor          Flavor        // 数据库分支，通过DetectFlavor识别或手动指定
+	Version         ServerVersion // 数据库版本，通过DetectFlavor识别
+
+	stmtCache *stmtCache   // 预编译语句缓存，通过EnableStmtCache开启
+	metrics   *poolMetrics // 监控数据，通过EnableMetrics开启
+}
+
+// SQL执行者，*sql.DB、*sql.Conn、*sql.Tx均实现了该接口
+// 需要在同一会话内执行的语句(如SHOW WARNINGS)应传入*sql.Conn或*sql.Tx
+type Executor interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
 }
 
+var (
+	_ Executor = (*sql.DB)(nil)
+	_ Executor = (*sql.Conn)(nil)
+	_ Executor = (*sql.Tx)(nil)
+)
+
 // 数据库查询返回值
 type QueryResult struct {
-	Rows      *sql.Rows
+	Rows      *Rows
 	Result    sql.Result
 	Error     error
 	Warning   []QueryWarning
 	QueryCost float64
+
+	cancel  context.CancelFunc // 查询使用的ctx，在Rows读完、Rows.Close()或Close()时释放
+	affect  func()             // 采集执行影响并归还会话，与cancel同时执行
+	observe func(err error)    // 记录监控及慢查询日志，与cancel同时执行
+}
+
+// 查询结果集，用法与*sql.Rows相同
+// Next()读到末尾或出错、调用Close()时采集执行影响，并释放查询使用的ctx及开启CaptureAffect时固定的连接
+type Rows struct {
+	*sql.Rows
+	res *QueryResult
 }
 
 // SQL语句Warn/Error解析
@@ -27,12 +62,6 @@ type QueryWarning struct {
 	Message string
 }
 
-// SQL语句showVariables解析
-type queryShow struct {
-	VariableName string
-	Value        string
-}
-
 // SQL语句show master status解析
 type QueryMasterStatus struct {
 	File              string
@@ -103,6 +132,48 @@ type QuerySlaveStatus struct {
 	Master_TLS_Version            string
 }
 
+// show slave status中Seconds_Behind_Master为NULL时的取值
+const (
+	SECONDS_BEHIND_MASTER_UNKNOWN int32 = -1
+)
+
+// MySQL服务端错误码
+const (
+	ER_CON_COUNT_ERROR       uint16 = 1040
+	ER_DBACCESS_DENIED       uint16 = 1044
+	ER_ACCESS_DENIED         uint16 = 1045
+	ER_SERVER_SHUTDOWN       uint16 = 1053
+	ER_DUP_ENTRY             uint16 = 1062
+	ER_PARSE_ERROR           uint16 = 1064
+	ER_TABLEACCESS_DENIED    uint16 = 1142
+	ER_COLUMNACCESS_DENIED   uint16 = 1143
+	ER_SYNTAX_ERROR          uint16 = 1149
+	ER_NET_READ_ERROR        uint16 = 1158
+	ER_NET_READ_INTERRUPTED  uint16 = 1159
+	ER_NET_ERROR_ON_WRITE    uint16 = 1160
+	ER_NET_WRITE_INTERRUPTED uint16 = 1161
+	ER_LOCK_WAIT_TIMEOUT     uint16 = 1205
+	ER_LOCK_DEADLOCK         uint16 = 1213
+	ER_SPECIFIC_ACCESS       uint16 = 1227
+	ER_UNSUPPORTED_PS        uint16 = 1295
+	ER_PROCACCESS_DENIED     uint16 = 1370
+	ER_DUP_ENTRY_WITH_KEY    uint16 = 1586
+	ER_NEED_REPREPARE        uint16 = 1615
+)
+
+// MySQL客户端错误码，部分代理会以服务端错误的形式返回
+const (
+	CR_SERVER_GONE_ERROR uint16 = 2006
+	CR_SERVER_LOST       uint16 = 2013
+)
+
+// 常见的MySQL warning码，可用于DBPool.PromoteWarnings
+const (
+	WARN_DATA_OUT_OF_RANGE   int32 = 1264
+	WARN_DATA_TRUNCATED      int32 = 1265
+	ER_TRUNCATED_WRONG_VALUE int32 = 1292
+)
+
 // database/sql中可不返回error的报错
 const (
 	ROW_PART_COLUMN_SCAN_ERROR string = "Scan error on column index"
@@ -0,0 +1,257 @@
+package mysql
+
+/*
+ * 测试用database/sql驱动，不依赖MySQL
+ * 每个连接池对应一个fakeServer，按SQL文本返回预设的结果集或错误
+ */
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 预设的单条SQL执行结果
+type fakeResult struct {
+	columns      []string
+	rows         [][]driver.Value
+	err          error
+	prepareErr   error         // prepare时返回的错误
+	delay        time.Duration // 返回结果前的等待时间
+	rowsErr      error         // 读完rows后Next返回的错误，模拟读取中途断开
+	rowsAffected int64
+}
+
+// 模拟的MySQL服务端
+type fakeServer struct {
+	lock     sync.Mutex
+	results  map[string]fakeResult
+	executed []string         // 按顺序记录执行过的SQL
+	opened   int32            // 当前未关闭的结果集数量
+	prepared int32            // 累计prepare次数(含失败)
+	stmtErrs map[string]error // 预编译语句下一次执行时返回的错误
+
+	commits   int32            // 累计提交次数
+	rollbacks int32            // 累计回滚次数
+	txOpts    driver.TxOptions // 最近一次开启事务的选项
+}
+
+var (
+	fakeServers   sync.Map
+	fakeServerSeq int64
+)
+
+func init() {
+	sql.Register("mysqlfake", fakeDriver{})
+}
+
+// 创建一个使用fakeServer的连接池
+func newFakePool(t *testing.T, results map[string]fakeResult) (*DBPool, *fakeServer) {
+	server := &fakeServer{results: results}
+	name := strconv.FormatInt(atomic.AddInt64(&fakeServerSeq, 1), 10)
+	fakeServers.Store(name, server)
+	db, err := sql.Open("mysqlfake", name)
+	if nil != err {
+		t.Fatalf("open fake pool fail. err=[%v]", err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		fakeServers.Delete(name)
+	})
+	return &DBPool{DB: db}, server
+}
+
+// 生成n行单列结果集
+func fakeSequenceRows(column string, n int) fakeResult {
+	result := fakeResult{columns: []string{column}}
+	for i := 1; i <= n; i++ {
+		result.rows = append(result.rows, []driver.Value{int64(i)})
+	}
+	return result
+}
+
+func (s *fakeServer) setResult(query string, result fakeResult) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.results[query] = result
+}
+
+func (s *fakeServer) result(query string) (fakeResult, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.executed = append(s.executed, query)
+	result, ok := s.results[query]
+	if !ok {
+		return result, fmt.Errorf("fake server has no result for query=[%v]", query)
+	}
+	return result, result.err
+}
+
+// 预编译语句query下一次执行时返回err
+func (s *fakeServer) failStmtOnce(query string, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if nil == s.stmtErrs {
+		s.stmtErrs = make(map[string]error)
+	}
+	s.stmtErrs[query] = err
+}
+
+func (s *fakeServer) takeStmtErr(query string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	err := s.stmtErrs[query]
+	delete(s.stmtErrs, query)
+	return err
+}
+
+func (s *fakeServer) executedSQL() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]string(nil), s.executed...)
+}
+
+func (s *fakeServer) openRows() int32 {
+	return atomic.LoadInt32(&s.opened)
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	server, ok := fakeServers.Load(name)
+	if !ok {
+		return nil, fmt.Errorf("fake server=[%v] not found", name)
+	}
+	return &fakeConn{server: server.(*fakeServer)}, nil
+}
+
+type fakeConn struct {
+	server *fakeServer
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	atomic.AddInt32(&c.server.prepared, 1)
+	c.server.lock.Lock()
+	prepareErr := c.server.results[query].prepareErr
+	c.server.lock.Unlock()
+	if nil != prepareErr {
+		return nil, prepareErr
+	}
+	return &fakeStmt{conn: c, query: query}, nil
+}
+
+func (c *fakeConn) Close() error { return nil }
+
+func (c *fakeConn) Begin() (driver.Tx, error) { return &fakeTx{server: c.server}, nil }
+
+// 接受任意隔离级别及只读选项
+func (c *fakeConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if err := ctx.Err(); nil != err {
+		return nil, err
+	}
+	c.server.lock.Lock()
+	c.server.txOpts = opts
+	c.server.lock.Unlock()
+	return &fakeTx{server: c.server}, nil
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if err := ctx.Err(); nil != err {
+		return nil, err
+	}
+	result, err := c.server.result(query)
+	time.Sleep(result.delay)
+	if nil != err {
+		return nil, err
+	}
+	atomic.AddInt32(&c.server.opened, 1)
+	return &fakeRows{server: c.server, result: result}, nil
+}
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if err := ctx.Err(); nil != err {
+		return nil, err
+	}
+	result, err := c.server.result(query)
+	time.Sleep(result.delay)
+	if nil != err {
+		return nil, err
+	}
+	return driver.RowsAffected(result.rowsAffected), nil
+}
+
+type fakeStmt struct {
+	conn   *fakeConn
+	query  string
+	closed bool
+}
+
+func (s *fakeStmt) Close() error {
+	s.closed = true
+	return nil
+}
+
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	if err := s.conn.server.takeStmtErr(s.query); nil != err {
+		return nil, err
+	}
+	return s.conn.ExecContext(context.Background(), s.query, nil)
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	if err := s.conn.server.takeStmtErr(s.query); nil != err {
+		return nil, err
+	}
+	return s.conn.QueryContext(context.Background(), s.query, nil)
+}
+
+type fakeTx struct {
+	server *fakeServer
+}
+
+func (tx *fakeTx) Commit() error {
+	atomic.AddInt32(&tx.server.commits, 1)
+	return nil
+}
+
+func (tx *fakeTx) Rollback() error {
+	atomic.AddInt32(&tx.server.rollbacks, 1)
+	return nil
+}
+
+type fakeRows struct {
+	server *fakeServer
+	result fakeResult
+	next   int
+	closed bool
+}
+
+func (r *fakeRows) Columns() []string { return r.result.columns }
+
+func (r *fakeRows) Close() error {
+	if !r.closed {
+		r.closed = true
+		atomic.AddInt32(&r.server.opened, -1)
+	}
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.next >= len(r.result.rows) {
+		if nil != r.result.rowsErr {
+			return r.result.rowsErr
+		}
+		return io.EOF
+	}
+	copy(dest, r.result.rows[r.next])
+	r.next++
+	return nil
+}
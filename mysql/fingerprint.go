@@ -0,0 +1,204 @@
+package mysql
+
+/*
+ * SQL归一化及指纹
+ * 将只有常量不同的语句归为一类，用于监控、慢查询及日志聚合
+ * 1、字符串、数字、十六进制常量替换为?，负数的符号一并替换
+ * 2、去掉注释，合并连续空白，去掉末尾的分号；保留版本注释(/*!开头)的内容
+ * 3、关键字及标识符转为小写，去掉标识符的反引号
+ * 4、IN列表及VALUES多行合并为(?+)
+ *
+ * Demo：
+ *	NormalizeSQL("SELECT * FROM `t` WHERE id IN (1, 2, 3) -- hint")  // select * from t where id in (?+)
+ *	Fingerprint("select * from t where id = 5") == Fingerprint("select * from t where id = 7")  // true
+ */
+import (
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"strings"
+)
+
+var (
+	// IN列表
+	inListPattern = regexp.MustCompile(`\bin ?\( ?\?( ?, ?\?)* ?\)`)
+	// VALUES多行
+	valuesPattern = regexp.MustCompile(`\bvalues ?\( ?\?( ?, ?\?)* ?\)( ?, ?\( ?\?( ?, ?\?)* ?\))*`)
+)
+
+// 返回归一化后SQL的64位FNV-1a哈希，16位十六进制
+func Fingerprint(sqlText string) string {
+	return normalizedFingerprint(NormalizeSQL(sqlText))
+}
+
+// 已归一化SQL的指纹
+func normalizedFingerprint(statement string) string {
+	h := fnv.New64a()
+	h.Write([]byte(statement))
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+// 一元负号之前可能出现的关键字
+var unaryKeywords = map[string]bool{
+	"select": true, "where": true, "and": true, "or": true, "not": true, "set": true, "on": true,
+	"when": true, "then": true, "else": true, "between": true, "like": true, "having": true,
+	"limit": true, "offset": true, "by": true, "is": true, "in": true, "values": true, "interval": true,
+}
+
+// 归一化SQL，规则见文件头说明
+func NormalizeSQL(sqlText string) string {
+	out := make([]byte, 0, len(sqlText))
+	space := false     // 是否有待输出的空白
+	versioned := false // 是否在版本注释/*!...*/中
+	// 最近输出的两个记号，last写入前out的长度及是否写入了空白，用于去掉一元负号
+	var last, beforeLast string
+	lastStart, lastSpace := 0, false
+	write := func(s string) {
+		beforeLast, last = last, s
+		lastStart, lastSpace = len(out), space && len(out) > 0
+		if lastSpace {
+			out = append(out, ' ')
+		}
+		space = false
+		out = append(out, s...)
+	}
+	// 常量替换为?，前面是一元的+、-时一并替换
+	writeLiteral := func() {
+		if ("-" == last || "+" == last) && isUnaryContext(beforeLast) {
+			out, space = out[:lastStart], lastSpace
+			last = beforeLast
+		}
+		write("?")
+	}
+
+	for i := 0; i < len(sqlText); {
+		c := sqlText[i]
+		switch {
+		case isSQLSpace(c):
+			space = true
+			i++
+		case strings.HasPrefix(sqlText[i:], "/*!"):
+			// 版本注释在满足版本要求的实例上会执行，保留注释标记及版本号
+			end := i + 3
+			for end < len(sqlText) && '0' <= sqlText[end] && sqlText[end] <= '9' {
+				end++
+			}
+			write(sqlText[i:end])
+			i = end
+			versioned = true
+			space = true
+		case versioned && strings.HasPrefix(sqlText[i:], "*/"):
+			write("*/")
+			i += 2
+			versioned = false
+		case '/' == c && i+1 < len(sqlText) && '*' == sqlText[i+1]:
+			end := strings.Index(sqlText[i+2:], "*/")
+			if -1 == end {
+				i = len(sqlText)
+			} else {
+				i += end + 4
+			}
+			space = true
+		case '#' == c || ('-' == c && strings.HasPrefix(sqlText[i:], "--") &&
+			(i+2 == len(sqlText) || isSQLSpace(sqlText[i+2]))):
+			end := strings.IndexByte(sqlText[i:], '\n')
+			if -1 == end {
+				i = len(sqlText)
+			} else {
+				i += end
+			}
+			space = true
+		case '\'' == c || '"' == c:
+			i = skipQuoted(sqlText, i, c)
+			writeLiteral()
+		case '`' == c:
+			end := skipQuoted(sqlText, i, c)
+			name := sqlText[i+1 : end]
+			if end-1 > i && '`' == sqlText[end-1] {
+				name = sqlText[i+1 : end-1]
+			}
+			write(strings.ToLower(strings.ReplaceAll(name, "``", "`")))
+			i = end
+		case isWordByte(c):
+			start := i
+			for i < len(sqlText) && isWordByte(sqlText[i]) {
+				i++
+			}
+			word := sqlText[start:i]
+			// 小数及科学计数法
+			if isNumberStart(word) {
+				for i < len(sqlText) && ('.' == sqlText[i] || isWordByte(sqlText[i]) ||
+					(('+' == sqlText[i] || '-' == sqlText[i]) && ('e' == sqlText[i-1] || 'E' == sqlText[i-1]))) {
+					i++
+				}
+				word = sqlText[start:i]
+			}
+			if isNumberLiteral(word) {
+				writeLiteral()
+			} else {
+				write(strings.ToLower(word))
+			}
+		default:
+			write(string(c))
+			i++
+		}
+	}
+
+	normalized := strings.TrimRight(string(out), "; ")
+	normalized = inListPattern.ReplaceAllString(normalized, "in (?+)")
+	normalized = valuesPattern.ReplaceAllString(normalized, "values (?+)")
+	return normalized
+}
+
+// 跳过以quote开头的引用内容，支持反斜杠转义及两个连续引号，返回结束引号之后的位置
+func skipQuoted(sqlText string, start int, quote byte) int {
+	for i := start + 1; i < len(sqlText); i++ {
+		switch sqlText[i] {
+		case '\\':
+			if '`' != quote {
+				i++
+			}
+		case quote:
+			if i+1 < len(sqlText) && quote == sqlText[i+1] {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+	return len(sqlText)
+}
+
+// 前一个记号为prev时，其后的+、-是否为一元运算符
+// 标识符、常量及右括号之后为二元运算符
+func isUnaryContext(prev string) bool {
+	if "" == prev {
+		return true
+	}
+	switch c := prev[len(prev)-1]; {
+	case ')' == c || '?' == c:
+		return false
+	case isWordByte(c):
+		return unaryKeywords[prev]
+	}
+	return true
+}
+
+func isSQLSpace(c byte) bool {
+	return ' ' == c || '\t' == c || '\n' == c || '\r' == c || '\f' == c
+}
+
+func isWordByte(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || '_' == c || '$' == c || c >= 0x80
+}
+
+func isNumberStart(word string) bool {
+	return len(word) > 0 && '0' <= word[0] && word[0] <= '9'
+}
+
+var numberPattern = regexp.MustCompile(`^(0x[0-9a-fA-F]+|0b[01]+|[0-9]+(\.[0-9]*)?([eE][+-]?[0-9]+)?)$`)
+
+// 是否为数字常量，以数字开头的标识符(如1abc)不算
+func isNumberLiteral(word string) bool {
+	return numberPattern.MatchString(word)
+}
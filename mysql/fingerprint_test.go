@@ -0,0 +1,47 @@
+package mysql
+
+import (
+	"testing"
+)
+
+func TestNormalizeSQL(t *testing.T) {
+	cases := map[string]string{
+		"select * from t where id = 5":                              "select * from t where id = ?",
+		"SELECT  *\n\tFROM `T` WHERE Id = 'a''b\\'c';":              "select * from t where id = ?",
+		"select /* hint */ a from t -- tail comment":                "select a from t",
+		"select a from t # tail comment\nwhere b = \"x\"":           "select a from t where b = ?",
+		"select * from t where id in (1, 2,3) and c IN ('a')":       "select * from t where id in (?+) and c in (?+)",
+		"insert into t(a, b) VALUES (1, 'x'), (2, 'y'),(3,'z')":     "insert into t(a, b) values (?+)",
+		"select 1.5, 1e-3, 0x1F, t1.c2 from t1":                     "select ?, ?, ?, t1.c2 from t1",
+		"update t set a = ? where id = ?":                           "update t set a = ? where id = ?",
+		"select * from `order``s` where `from` = 1":                 "select * from order`s where from = ?",
+		"select a--b from t":                                        "select a--b from t",
+		"select * from t where d > '2020-01-01' limit 10 offset 20": "select * from t where d > ? limit ? offset ?",
+		"select * from t where id = -5 and b=-1.5":                  "select * from t where id = ? and b=?",
+		"select a - 5, -3, (-2) from t where c in (-1, 2)":          "select a - ?, ?, (?) from t where c in (?+)",
+		"select /*!40001 SQL_NO_CACHE */ * from t":                  "select /*!40001 sql_no_cache */ * from t",
+	}
+	for sqlText, want := range cases {
+		if got := NormalizeSQL(sqlText); got != want {
+			t.Errorf("NormalizeSQL(%q)=[%v], want [%v]", sqlText, got, want)
+		}
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	a := Fingerprint("select * from t where id = 5")
+	b := Fingerprint("SELECT *   FROM t WHERE id = 7")
+	c := Fingerprint("select * from t where name = 5")
+	if a != b {
+		t.Errorf("fingerprints of same pattern differ. a=[%v] b=[%v]", a, b)
+	}
+	if a == c {
+		t.Errorf("fingerprints of different pattern are equal. a=[%v] c=[%v]", a, c)
+	}
+	if 16 != len(a) {
+		t.Errorf("unexpected fingerprint length. fingerprint=[%v]", a)
+	}
+	if Fingerprint("select * from t where id in (1)") != Fingerprint("select * from t where id in (1, 2, 3)") {
+		t.Errorf("IN lists should be collapsed")
+	}
+}
@@ -0,0 +1,138 @@
+package mysql
+
+/*
+ * 数据库分支识别
+ * 通过SELECT @@version, @@version_comment识别MySQL、Percona、MariaDB、FDB及版本号
+ * 状态解析及语法选择(如SHOW REPLICA STATUS)按DBPool.Flavor处理，不依赖全局配置
+ *
+ * Demo：
+ *	flavor, err := pool.DetectFlavor(nil)
+ *	if nil == err && Flavor_MariaDB == flavor {
+ *		...
+ *	}
+ */
+import (
+	"go-tools/log"
+	"strconv"
+	"strings"
+)
+
+// 数据库分支
+type Flavor int
+
+const (
+	Flavor_Unknown Flavor = iota // 未识别，按MySQL处理
+	Flavor_MySQL
+	Flavor_Percona
+	Flavor_MariaDB
+	Flavor_FDB
+)
+
+func (f Flavor) String() string {
+	switch f {
+	case Flavor_MySQL:
+		return "mysql"
+	case Flavor_Percona:
+		return "percona"
+	case Flavor_MariaDB:
+		return "mariadb"
+	case Flavor_FDB:
+		return "fdb"
+	}
+	return "unknown"
+}
+
+// 未设置RWTimeOutSec时内部查询(SHOW、采集执行影响等)使用的读写超时，单位秒
+const DEFAULT_RW_TIMEOUT_SEC = 10
+
+// 数据库版本
+type ServerVersion struct {
+	Version        string // @@version
+	VersionComment string // @@version_comment
+	Major          int
+	Minor          int
+	Patch          int
+}
+
+// 版本号是否不低于major.minor.patch
+func (v ServerVersion) AtLeast(major int, minor int, patch int) bool {
+	if v.Major != major {
+		return v.Major > major
+	}
+	if v.Minor != minor {
+		return v.Minor > minor
+	}
+	return v.Patch >= patch
+}
+
+// 解析版本号，如8.0.33-25、10.6.12-MariaDB-log
+func ParseServerVersion(version string, versionComment string) ServerVersion {
+	v := ServerVersion{Version: version, VersionComment: versionComment}
+	numbers := version
+	if end := strings.IndexFunc(numbers, func(r rune) bool { return '.' != r && (r < '0' || r > '9') }); -1 != end {
+		numbers = numbers[:end]
+	}
+	parts := strings.SplitN(numbers, ".", 3)
+	targets := []*int{&v.Major, &v.Minor, &v.Patch}
+	for i, part := range parts {
+		*targets[i], _ = strconv.Atoi(part)
+	}
+	return v
+}
+
+// 根据@@version及@@version_comment识别分支
+func ParseFlavor(version string, versionComment string) Flavor {
+	text := strings.ToLower(version + " " + versionComment)
+	switch {
+	case strings.Contains(text, "mariadb"):
+		return Flavor_MariaDB
+	case strings.Contains(text, "percona"):
+		return Flavor_Percona
+	case strings.Contains(text, "fdb"):
+		return Flavor_FDB
+	case "" == strings.TrimSpace(version):
+		return Flavor_Unknown
+	}
+	return Flavor_MySQL
+}
+
+/*
+ * 识别数据库分支及版本，结果写入db.Flavor及db.Version
+ * 需要在连接池初始化时调用，exec为nil时使用连接池
+ */
+func (db *DBPool) DetectFlavor(exec Executor) (Flavor, error) {
+	if nil == exec {
+		exec = db.DB
+	}
+	ctx, cancel := timeoutContext(db.rwTimeout())
+	defer cancel()
+	var version, versionComment string
+	err := exec.QueryRowContext(ctx, "SELECT @@version, @@version_comment").Scan(&version, &versionComment)
+	if nil != err {
+		log.Log.Warning("Fail to detect server flavor. reason=[%v]", err)
+		return Flavor_Unknown, err
+	}
+	db.Version = ParseServerVersion(version, versionComment)
+	db.Flavor = ParseFlavor(version, versionComment)
+	log.Log.Debug("Detect server flavor. flavor=[%v] version=[%v] comment=[%v]", db.Flavor, version, versionComment)
+	return db.Flavor, nil
+}
+
+// 内部查询使用的读写超时
+func (db *DBPool) rwTimeout() int {
+	if db.RWTimeOutSec > 0 {
+		return db.RWTimeOutSec
+	}
+	return DEFAULT_RW_TIMEOUT_SEC
+}
+
+// 是否优先使用SHOW REPLICA STATUS，MySQL 8.0.22及MariaDB 10.5.1开始支持
+func (db *DBPool) preferReplicaSyntax() bool {
+	switch db.Flavor {
+	case Flavor_MySQL, Flavor_Percona:
+		return db.Version.AtLeast(8, 0, 22)
+	case Flavor_MariaDB:
+		return db.Version.AtLeast(10, 5, 1)
+	}
+	return false
+}
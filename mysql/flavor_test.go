@@ -0,0 +1,75 @@
+package mysql
+
+import (
+	"database/sql/driver"
+	"testing"
+
+	mysqlDriver "github.com/go-sql-driver/mysql"
+)
+
+func TestParseFlavor(t *testing.T) {
+	cases := []struct {
+		version string
+		comment string
+		want    Flavor
+	}{
+		{"8.0.33", "MySQL Community Server - GPL", Flavor_MySQL},
+		{"8.0.33-25", "Percona Server (GPL), Release 25, Revision 60c9e2c5", Flavor_Percona},
+		{"10.6.12-MariaDB-log", "MariaDB Server", Flavor_MariaDB},
+		{"5.7.36-fdb-log", "Source distribution", Flavor_FDB},
+		{"", "", Flavor_Unknown},
+	}
+	for _, c := range cases {
+		if got := ParseFlavor(c.version, c.comment); c.want != got {
+			t.Errorf("ParseFlavor(%q, %q)=[%v], want [%v]", c.version, c.comment, got, c.want)
+		}
+	}
+}
+
+func TestParseServerVersion(t *testing.T) {
+	v := ParseServerVersion("10.6.12-MariaDB-log", "")
+	if 10 != v.Major || 6 != v.Minor || 12 != v.Patch {
+		t.Errorf("unexpected version. version=[%+v]", v)
+	}
+	if !v.AtLeast(10, 5, 1) || v.AtLeast(10, 6, 13) || !v.AtLeast(10, 6, 12) || v.AtLeast(11, 0, 0) {
+		t.Errorf("unexpected AtLeast result. version=[%+v]", v)
+	}
+	if v = ParseServerVersion("8.0", ""); 8 != v.Major || 0 != v.Patch {
+		t.Errorf("unexpected version. version=[%+v]", v)
+	}
+}
+
+func TestDetectFlavor(t *testing.T) {
+	pool, server := newFakePool(t, map[string]fakeResult{
+		"SELECT @@version, @@version_comment": {
+			columns: []string{"@@version", "@@version_comment"},
+			rows:    [][]driver.Value{{"8.0.33", "MySQL Community Server - GPL"}},
+		},
+		"SHOW SLAVE STATUS": {err: &mysqlDriver.MySQLError{Number: ER_PARSE_ERROR}},
+		"SHOW REPLICA STATUS": {
+			columns: []string{"Source_Host", "Replica_IO_Running", "Channel_Name"},
+			rows:    [][]driver.Value{{"10.0.0.1", "Yes", ""}},
+		},
+	})
+	if 10 != pool.rwTimeout() {
+		t.Errorf("unexpected default rw timeout. timeout=[%v]", pool.rwTimeout())
+	}
+	flavor, err := pool.DetectFlavor(nil)
+	if nil != err || Flavor_MySQL != flavor || Flavor_MySQL != pool.Flavor || 8 != pool.Version.Major {
+		t.Fatalf("unexpected flavor. flavor=[%v] version=[%+v] err=[%v]", flavor, pool.Version, err)
+	}
+
+	channels, err := pool.QuerySlaveStatusChannels(nil)
+	if nil != err || 1 != len(channels) || "10.0.0.1" != channels[0].Master_Host {
+		t.Fatalf("unexpected channels. channels=[%+v] err=[%v]", channels, err)
+	}
+	executed := server.executedSQL()
+	if "SHOW REPLICA STATUS" != executed[len(executed)-1] {
+		t.Errorf("SHOW REPLICA STATUS should be used first on 8.0.33. executed=[%v]", executed)
+	}
+	for _, query := range executed {
+		if "SHOW SLAVE STATUS" == query {
+			t.Errorf("SHOW SLAVE STATUS should not be executed on 8.0.33. executed=[%v]", executed)
+		}
+	}
+}
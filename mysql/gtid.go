@@ -0,0 +1,253 @@
+package mysql
+
+/*
+ * GTID集合运算
+ * 解析MySQL的uuid:1-5:7-9,uuid2:1-3格式，支持并集、差集、包含、相等及缺失事务数计算
+ * GTIDSet中每个uuid对应的区间始终保持有序且互不重叠
+ */
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// GTID区间，包含Start和End
+type GTIDInterval struct {
+	Start int64
+	End   int64
+}
+
+// 区间内的事务数
+func (i GTIDInterval) Count() int64 {
+	return i.End - i.Start + 1
+}
+
+func (i GTIDInterval) String() string {
+	if i.Start == i.End {
+		return strconv.FormatInt(i.Start, 10)
+	}
+	return fmt.Sprintf("%d-%d", i.Start, i.End)
+}
+
+// GTID集合，key为小写的server uuid
+type GTIDSet map[string][]GTIDInterval
+
+/*
+ * 解析gtid字符串，兼容show master status中",\n"分隔的多行格式
+ * 空字符串返回空集合
+ */
+func ParseGTIDSet(gtidSet string) (GTIDSet, error) {
+	set := make(GTIDSet)
+	for _, part := range strings.Split(gtidSet, ",") {
+		part = strings.TrimSpace(part)
+		if "" == part {
+			continue
+		}
+		fields := strings.Split(part, ":")
+		uuid := strings.ToLower(strings.TrimSpace(fields[0]))
+		if !isValidUUID(uuid) {
+			return nil, fmt.Errorf("invalid gtid uuid=[%v] in=[%v]", fields[0], part)
+		}
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("gtid has no interval. in=[%v]", part)
+		}
+		for _, field := range fields[1:] {
+			interval, err := parseGTIDInterval(strings.TrimSpace(field))
+			if nil != err {
+				return nil, fmt.Errorf("%v in=[%v]", err, part)
+			}
+			set[uuid] = append(set[uuid], interval)
+		}
+		set[uuid] = mergeGTIDIntervals(set[uuid])
+	}
+	return set, nil
+}
+
+// 解析失败时panic，仅用于常量及测试
+func MustParseGTIDSet(gtidSet string) GTIDSet {
+	set, err := ParseGTIDSet(gtidSet)
+	if nil != err {
+		panic(err)
+	}
+	return set
+}
+
+// 解析单个区间，如 1-5 或 7
+func parseGTIDInterval(field string) (interval GTIDInterval, err error) {
+	bounds := strings.SplitN(field, "-", 2)
+	interval.Start, err = strconv.ParseInt(bounds[0], 10, 64)
+	if nil != err {
+		return interval, fmt.Errorf("invalid gtid interval=[%v]", field)
+	}
+	interval.End = interval.Start
+	if 2 == len(bounds) {
+		if interval.End, err = strconv.ParseInt(bounds[1], 10, 64); nil != err {
+			return interval, fmt.Errorf("invalid gtid interval=[%v]", field)
+		}
+	}
+	if interval.Start < 1 || interval.End < interval.Start {
+		return interval, fmt.Errorf("invalid gtid interval=[%v]", field)
+	}
+	return interval, nil
+}
+
+// 校验uuid格式：8-4-4-4-12位十六进制
+func isValidUUID(uuid string) bool {
+	if 36 != len(uuid) {
+		return false
+	}
+	for i, c := range uuid {
+		switch i {
+		case 8, 13, 18, 23:
+			if '-' != c {
+				return false
+			}
+		default:
+			if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// 区间排序并合并重叠及相邻的区间
+func mergeGTIDIntervals(intervals []GTIDInterval) []GTIDInterval {
+	if 0 == len(intervals) {
+		return nil
+	}
+	sorted := append([]GTIDInterval(nil), intervals...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Start < sorted[j].Start })
+	merged := []GTIDInterval{sorted[0]}
+	for _, interval := range sorted[1:] {
+		last := &merged[len(merged)-1]
+		if interval.Start <= last.End+1 {
+			if interval.End > last.End {
+				last.End = interval.End
+			}
+			continue
+		}
+		merged = append(merged, interval)
+	}
+	return merged
+}
+
+// 按uuid排序输出，格式与MySQL一致(不含换行)
+func (s GTIDSet) String() string {
+	uuids := s.UUIDs()
+	parts := make([]string, 0, len(uuids))
+	for _, uuid := range uuids {
+		ranges := make([]string, 0, len(s[uuid]))
+		for _, interval := range s[uuid] {
+			ranges = append(ranges, interval.String())
+		}
+		parts = append(parts, uuid+":"+strings.Join(ranges, ":"))
+	}
+	return strings.Join(parts, ",")
+}
+
+// 集合中包含的uuid，已排序
+func (s GTIDSet) UUIDs() []string {
+	uuids := make([]string, 0, len(s))
+	for uuid, intervals := range s {
+		if len(intervals) > 0 {
+			uuids = append(uuids, uuid)
+		}
+	}
+	sort.Strings(uuids)
+	return uuids
+}
+
+// 是否为空集合
+func (s GTIDSet) IsEmpty() bool {
+	return 0 == len(s.UUIDs())
+}
+
+// 集合中的事务总数
+func (s GTIDSet) Count() (count int64) {
+	for _, intervals := range s {
+		for _, interval := range intervals {
+			count += interval.Count()
+		}
+	}
+	return count
+}
+
+// 深拷贝
+func (s GTIDSet) Clone() GTIDSet {
+	clone := make(GTIDSet, len(s))
+	for uuid, intervals := range s {
+		if len(intervals) > 0 {
+			clone[uuid] = append([]GTIDInterval(nil), intervals...)
+		}
+	}
+	return clone
+}
+
+// 并集，不修改原集合
+func (s GTIDSet) Union(other GTIDSet) GTIDSet {
+	result := s.Clone()
+	for uuid, intervals := range other {
+		if len(intervals) > 0 {
+			result[uuid] = mergeGTIDIntervals(append(result[uuid], intervals...))
+		}
+	}
+	return result
+}
+
+// 差集：s中存在而other中不存在的gtid，不修改原集合
+func (s GTIDSet) Subtract(other GTIDSet) GTIDSet {
+	result := make(GTIDSet, len(s))
+	for uuid, intervals := range s {
+		var remains []GTIDInterval
+		for _, interval := range intervals {
+			remains = append(remains, subtractGTIDInterval(interval, other[uuid])...)
+		}
+		if len(remains) > 0 {
+			result[uuid] = remains
+		}
+	}
+	return result
+}
+
+// 从区间interval中扣除excludes(已有序)，返回剩余区间
+func subtractGTIDInterval(interval GTIDInterval, excludes []GTIDInterval) (remains []GTIDInterval) {
+	current := interval
+	for _, exclude := range excludes {
+		if exclude.End < current.Start {
+			continue
+		}
+		if exclude.Start > current.End {
+			break
+		}
+		if exclude.Start > current.Start {
+			remains = append(remains, GTIDInterval{Start: current.Start, End: exclude.Start - 1})
+		}
+		if exclude.End >= current.End {
+			return remains
+		}
+		current.Start = exclude.End + 1
+	}
+	return append(remains, current)
+}
+
+// s是否包含other中的全部gtid
+func (s GTIDSet) Contains(other GTIDSet) bool {
+	return other.Subtract(s).IsEmpty()
+}
+
+// 两个集合是否相等
+func (s GTIDSet) Equal(other GTIDSet) bool {
+	return s.Contains(other) && other.Contains(s)
+}
+
+// other中存在而s中缺失的事务数，用于比较候选从库与主库的数据完整性
+func (s GTIDSet) MissingCount(other GTIDSet) int64 {
+	return other.Subtract(s).Count()
+}
+
+// 缺失的gtid集合
+func (s GTIDSet) Missing(other GTIDSet) GTIDSet {
+	return other.Subtract(s)
+}
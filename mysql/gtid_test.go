@@ -0,0 +1,167 @@
+package mysql
+
+import (
+	"testing"
+)
+
+const (
+	uuid1 = "3e11fa47-71ca-11e1-9e33-c80aa9429562"
+	uuid2 = "4a6f0b3c-71ca-11e1-9e33-c80aa9429563"
+	uuid3 = "5b7e1c4d-71ca-11e1-9e33-c80aa9429564"
+)
+
+func TestParseGTIDSet(t *testing.T) {
+	cases := []struct {
+		input string
+		want  string
+		count int64
+	}{
+		{"", "", 0},
+		{"  ", "", 0},
+		{uuid1 + ":1-5", uuid1 + ":1-5", 5},
+		{uuid1 + ":7", uuid1 + ":7", 1},
+		{uuid1 + ":1-5:7-9", uuid1 + ":1-5:7-9", 8},
+		// 重叠、相邻及乱序区间合并
+		{uuid1 + ":7-9:1-5:6", uuid1 + ":1-9", 9},
+		{uuid1 + ":1-5:3-8", uuid1 + ":1-8", 8},
+		// 大写uuid及show master status中的换行格式
+		{"3E11FA47-71CA-11E1-9E33-C80AA9429562:1-3,\n" + uuid2 + ":1-2", uuid1 + ":1-3," + uuid2 + ":1-2", 5},
+		// 按uuid排序输出
+		{uuid2 + ":1," + uuid1 + ":2", uuid1 + ":2," + uuid2 + ":1", 2},
+		// 同一uuid出现多次
+		{uuid1 + ":1-3," + uuid1 + ":4-6", uuid1 + ":1-6", 6},
+	}
+	for _, c := range cases {
+		set, err := ParseGTIDSet(c.input)
+		if nil != err {
+			t.Errorf("ParseGTIDSet(%q) fail. err=[%v]", c.input, err)
+			continue
+		}
+		if set.String() != c.want {
+			t.Errorf("ParseGTIDSet(%q)=[%v] want=[%v]", c.input, set.String(), c.want)
+		}
+		if set.Count() != c.count {
+			t.Errorf("ParseGTIDSet(%q).Count()=[%v] want=[%v]", c.input, set.Count(), c.count)
+		}
+	}
+}
+
+func TestParseGTIDSetInvalid(t *testing.T) {
+	inputs := []string{
+		"not-a-uuid:1-5",
+		uuid1,
+		uuid1 + ":",
+		uuid1 + ":a-5",
+		uuid1 + ":1-b",
+		uuid1 + ":0-5",
+		uuid1 + ":5-1",
+		uuid1 + ":-1",
+		"3e11fa47x71ca-11e1-9e33-c80aa9429562:1",
+		"3e11fa47-71ca-11e1-9e33-c80aa942956g:1",
+	}
+	for _, input := range inputs {
+		if _, err := ParseGTIDSet(input); nil == err {
+			t.Errorf("ParseGTIDSet(%q) should fail", input)
+		}
+	}
+}
+
+func TestGTIDSetUnion(t *testing.T) {
+	cases := []struct{ a, b, want string }{
+		{"", "", ""},
+		{uuid1 + ":1-5", "", uuid1 + ":1-5"},
+		{"", uuid1 + ":1-5", uuid1 + ":1-5"},
+		{uuid1 + ":1-5", uuid1 + ":6-10", uuid1 + ":1-10"},
+		{uuid1 + ":1-5", uuid1 + ":8-10", uuid1 + ":1-5:8-10"},
+		{uuid1 + ":1-5", uuid2 + ":1-3", uuid1 + ":1-5," + uuid2 + ":1-3"},
+		{uuid1 + ":1-5:10-20", uuid1 + ":3-12", uuid1 + ":1-20"},
+	}
+	for _, c := range cases {
+		a, b := MustParseGTIDSet(c.a), MustParseGTIDSet(c.b)
+		got := a.Union(b)
+		if got.String() != c.want {
+			t.Errorf("Union(%q, %q)=[%v] want=[%v]", c.a, c.b, got, c.want)
+		}
+		// 原集合不被修改
+		if a.String() != MustParseGTIDSet(c.a).String() {
+			t.Errorf("Union modified receiver. a=[%v]", a)
+		}
+	}
+}
+
+func TestGTIDSetSubtract(t *testing.T) {
+	cases := []struct{ a, b, want string }{
+		{"", "", ""},
+		{uuid1 + ":1-10", "", uuid1 + ":1-10"},
+		{"", uuid1 + ":1-10", ""},
+		{uuid1 + ":1-10", uuid1 + ":1-10", ""},
+		{uuid1 + ":1-10", uuid1 + ":1-20", ""},
+		{uuid1 + ":1-10", uuid1 + ":3-5", uuid1 + ":1-2:6-10"},
+		{uuid1 + ":1-10", uuid1 + ":1-3:5:9-12", uuid1 + ":4:6-8"},
+		{uuid1 + ":1-10", uuid2 + ":1-10", uuid1 + ":1-10"},
+		{uuid1 + ":1-10," + uuid2 + ":1-5", uuid2 + ":1-5", uuid1 + ":1-10"},
+		{uuid1 + ":5-10", uuid1 + ":1-4:11-20", uuid1 + ":5-10"},
+	}
+	for _, c := range cases {
+		got := MustParseGTIDSet(c.a).Subtract(MustParseGTIDSet(c.b))
+		if got.String() != c.want {
+			t.Errorf("Subtract(%q, %q)=[%v] want=[%v]", c.a, c.b, got, c.want)
+		}
+	}
+}
+
+func TestGTIDSetContainsAndEqual(t *testing.T) {
+	cases := []struct {
+		a, b     string
+		contains bool
+		equal    bool
+	}{
+		{"", "", true, true},
+		{uuid1 + ":1-10", "", true, false},
+		{"", uuid1 + ":1", false, false},
+		{uuid1 + ":1-10", uuid1 + ":3-5", true, false},
+		{uuid1 + ":1-10", uuid1 + ":1-5:6-10", true, true},
+		{uuid1 + ":1-10", uuid1 + ":1-11", false, false},
+		{uuid1 + ":1-10," + uuid2 + ":1", uuid1 + ":1-10", true, false},
+		{uuid1 + ":1-10", uuid1 + ":1-10," + uuid2 + ":1", false, false},
+		{uuid2 + ":1," + uuid1 + ":1-10", uuid1 + ":1-10," + uuid2 + ":1", true, true},
+	}
+	for _, c := range cases {
+		a, b := MustParseGTIDSet(c.a), MustParseGTIDSet(c.b)
+		if a.Contains(b) != c.contains {
+			t.Errorf("Contains(%q, %q)=[%v] want=[%v]", c.a, c.b, a.Contains(b), c.contains)
+		}
+		if a.Equal(b) != c.equal || b.Equal(a) != c.equal {
+			t.Errorf("Equal(%q, %q)=[%v] want=[%v]", c.a, c.b, a.Equal(b), c.equal)
+		}
+	}
+}
+
+func TestGTIDSetMissing(t *testing.T) {
+	master := MustParseGTIDSet(uuid1 + ":1-100," + uuid2 + ":1-10," + uuid3 + ":1")
+	replica := MustParseGTIDSet(uuid1 + ":1-90," + uuid2 + ":1-10")
+	if got := replica.MissingCount(master); got != 11 {
+		t.Errorf("MissingCount=[%v] want=[11]", got)
+	}
+	if got := replica.Missing(master).String(); got != uuid1+":91-100,"+uuid3+":1" {
+		t.Errorf("Missing=[%v]", got)
+	}
+	if got := master.MissingCount(replica); got != 0 {
+		t.Errorf("master MissingCount=[%v] want=[0]", got)
+	}
+}
+
+func TestGTIDSetClone(t *testing.T) {
+	set := MustParseGTIDSet(uuid1 + ":1-5")
+	clone := set.Clone()
+	clone[uuid1][0].End = 100
+	if set.String() != uuid1+":1-5" {
+		t.Errorf("Clone is not a deep copy. set=[%v]", set)
+	}
+	if !MustParseGTIDSet("").IsEmpty() || set.IsEmpty() {
+		t.Errorf("unexpected IsEmpty result")
+	}
+	if (GTIDSet{uuid1: nil}).IsEmpty() != true {
+		t.Errorf("set with empty intervals should be empty")
+	}
+}
@@ -0,0 +1,184 @@
+package mysql
+
+/*
+ * 复制健康状态评估
+ * 基于QuerySlaveStatus及主库QueryMasterStatus的结果，将从库划分为：
+ * 健康、延迟、IO线程异常、SQL线程异常、非从库 五种状态
+ */
+import (
+	"fmt"
+	"go-tools/log"
+	"strconv"
+	"strings"
+)
+
+// 复制健康状态
+type ReplicationState int
+
+const (
+	// 复制正常
+	Repl_Healthy ReplicationState = iota
+	// 复制延迟超过阈值
+	Repl_Lagging
+	// IO线程未运行或报错
+	Repl_IO_Broken
+	// SQL线程未运行或报错
+	Repl_SQL_Broken
+	// 非从库
+	Repl_Not_Replica
+)
+
+func (s ReplicationState) String() string {
+	switch s {
+	case Repl_Healthy:
+		return "healthy"
+	case Repl_Lagging:
+		return "lagging"
+	case Repl_IO_Broken:
+		return "io-broken"
+	case Repl_SQL_Broken:
+		return "sql-broken"
+	case Repl_Not_Replica:
+		return "not-a-replica"
+	}
+	return fmt.Sprintf("unknown(%d)", int(s))
+}
+
+// 复制延迟阈值，取值<=0时不检查对应项
+type ReplicationThreshold struct {
+	MaxLagSeconds int32 // Seconds_Behind_Master超过该值判定为延迟，单位秒
+	MaxGtidGap    int64 // 主库已执行但从库未执行的事务数超过该值判定为延迟
+}
+
+// 默认复制延迟阈值
+var DefaultReplicationThreshold = ReplicationThreshold{
+	MaxLagSeconds: 60,
+	MaxGtidGap:    0,
+}
+
+// 复制健康评估结果
+type ReplicationHealth struct {
+	State               ReplicationState
+	Channel             string
+	SecondsBehindMaster int32 // 为SECONDS_BEHIND_MASTER_UNKNOWN时表示延迟未知
+	LastIOErrno         int
+	LastIOError         string
+	LastSQLErrno        int
+	LastSQLError        string
+	ExecutedGtidSet     string // 从库已执行的gtid
+	SourceGtidSet       string // 参与比较的gtid，主库Executed_Gtid_Set，未提供主库时为从库Retrieved_Gtid_Set
+	GtidGap             string // SourceGtidSet中从库尚未执行的部分
+	GtidGapTrx          int64  // GtidGap包含的事务数
+	Reason              string
+}
+
+// 是否健康
+func (h ReplicationHealth) IsHealthy() bool {
+	return h.State == Repl_Healthy
+}
+
+/*
+ * 根据show slave status结果评估复制健康状态，不访问数据库，可直接用于单元测试
+ * masterExecutedGtidSet：主库show master status中的Executed_Gtid_Set，为空时与从库Retrieved_Gtid_Set比较
+ * 判定顺序：非从库 -> SQL线程异常 -> IO线程异常 -> 延迟 -> 健康
+ */
+func EvaluateReplicationHealth(slaveStatus QuerySlaveStatus, masterExecutedGtidSet string,
+	threshold ReplicationThreshold) (health ReplicationHealth) {
+
+	health = ReplicationHealth{
+		Channel:             slaveStatus.Channel_Name,
+		SecondsBehindMaster: slaveStatus.Seconds_Behind_Master,
+		LastIOErrno:         parseErrno(slaveStatus.Last_IO_Errno),
+		LastIOError:         slaveStatus.Last_IO_Error,
+		LastSQLErrno:        parseErrno(slaveStatus.Last_SQL_Errno),
+		LastSQLError:        slaveStatus.Last_SQL_Error,
+		ExecutedGtidSet:     slaveStatus.Executed_Gtid_Set,
+		SourceGtidSet:       masterExecutedGtidSet,
+	}
+	if "" == slaveStatus.Master_Host && "" == slaveStatus.Slave_IO_Running {
+		health.State = Repl_Not_Replica
+		health.Reason = "SHOW SLAVE STATUS returns no rows"
+		return health
+	}
+	if "" == health.SourceGtidSet {
+		health.SourceGtidSet = slaveStatus.Retrieved_Gtid_Set
+	}
+	gap, gapTrx, err := gtidGap(health.SourceGtidSet, health.ExecutedGtidSet)
+	if nil != err {
+		log.Log.Warning("Fail to compute gtid gap. source=[%v] executed=[%v] reason=[%v]",
+			health.SourceGtidSet, health.ExecutedGtidSet, err)
+	}
+	health.GtidGap, health.GtidGapTrx = gap, gapTrx
+
+	if "Yes" != slaveStatus.Slave_SQL_Running {
+		health.State = Repl_SQL_Broken
+		health.Reason = fmt.Sprintf("Slave_SQL_Running=[%v] Last_SQL_Errno=[%v] Last_SQL_Error=[%v]",
+			slaveStatus.Slave_SQL_Running, health.LastSQLErrno, health.LastSQLError)
+		return health
+	}
+	if "Yes" != slaveStatus.Slave_IO_Running {
+		health.State = Repl_IO_Broken
+		health.Reason = fmt.Sprintf("Slave_IO_Running=[%v] Last_IO_Errno=[%v] Last_IO_Error=[%v]",
+			slaveStatus.Slave_IO_Running, health.LastIOErrno, health.LastIOError)
+		return health
+	}
+	if threshold.MaxLagSeconds > 0 && health.SecondsBehindMaster > threshold.MaxLagSeconds {
+		health.State = Repl_Lagging
+		health.Reason = fmt.Sprintf("Seconds_Behind_Master=[%v] exceeds threshold=[%v]",
+			health.SecondsBehindMaster, threshold.MaxLagSeconds)
+		return health
+	}
+	if threshold.MaxGtidGap > 0 && health.GtidGapTrx > threshold.MaxGtidGap {
+		health.State = Repl_Lagging
+		health.Reason = fmt.Sprintf("gtid gap=[%v] trx=[%v] exceeds threshold=[%v]",
+			health.GtidGap, health.GtidGapTrx, threshold.MaxGtidGap)
+		return health
+	}
+	health.State = Repl_Healthy
+	return health
+}
+
+/*
+ * 查询并评估当前实例的复制健康状态
+ * master不为nil时，使用主库的Executed_Gtid_Set计算gtid差距
+ */
+func (db *DBPool) QueryReplicationHealth(master *DBPool, threshold ReplicationThreshold) (health ReplicationHealth, err error) {
+	slaveStatus, err := db.QuerySlaveStatus(nil)
+	if nil != err {
+		log.Log.Warning("Fail to evaluate replication health. reason=[%v]", err)
+		return health, err
+	}
+	var masterExecutedGtidSet string
+	if nil != master {
+		masterStatus, err := master.QueryMasterStatus(nil)
+		if nil != err {
+			log.Log.Warning("Fail to evaluate replication health. reason=[%v]", err)
+			return health, err
+		}
+		masterExecutedGtidSet = masterStatus.Executed_Gtid_Set
+	}
+	return EvaluateReplicationHealth(slaveStatus, masterExecutedGtidSet, threshold), nil
+}
+
+// Last_IO_Errno、Last_SQL_Errno字符串转换为数字，无法解析时返回0
+func parseErrno(errno string) int {
+	num, err := strconv.Atoi(strings.TrimSpace(errno))
+	if nil != err {
+		return 0
+	}
+	return num
+}
+
+// 计算source中target尚未包含的gtid及事务数
+func gtidGap(source string, target string) (gap string, trx int64, err error) {
+	sourceSet, err := ParseGTIDSet(source)
+	if nil != err {
+		return "", 0, err
+	}
+	targetSet, err := ParseGTIDSet(target)
+	if nil != err {
+		return "", 0, err
+	}
+	missing := targetSet.Missing(sourceSet)
+	return missing.String(), missing.Count(), nil
+}
@@ -0,0 +1,88 @@
+package mysql
+
+import (
+	"testing"
+)
+
+// 构造健康从库的show slave status结果
+func newHealthySlaveStatus() QuerySlaveStatus {
+	return QuerySlaveStatus{
+		Master_Host:           "10.0.0.1",
+		Master_Port:           3306,
+		Slave_IO_Running:      "Yes",
+		Slave_SQL_Running:     "Yes",
+		Last_IO_Errno:         "0",
+		Last_SQL_Errno:        "0",
+		Seconds_Behind_Master: 0,
+		Retrieved_Gtid_Set:    "aaaaaaaa-0000-0000-0000-000000000001:1-100",
+		Executed_Gtid_Set:     "aaaaaaaa-0000-0000-0000-000000000001:1-100",
+	}
+}
+
+func TestEvaluateReplicationHealth(t *testing.T) {
+	threshold := ReplicationThreshold{MaxLagSeconds: 10, MaxGtidGap: 50}
+
+	cases := []struct {
+		name      string
+		modify    func(s *QuerySlaveStatus)
+		master    string
+		wantState ReplicationState
+		wantGap   int64
+	}{
+		{"healthy", func(s *QuerySlaveStatus) {}, "", Repl_Healthy, 0},
+		{"not a replica", func(s *QuerySlaveStatus) { *s = QuerySlaveStatus{} }, "", Repl_Not_Replica, 0},
+		{"io broken", func(s *QuerySlaveStatus) {
+			s.Slave_IO_Running = "Connecting"
+			s.Last_IO_Errno = "2003"
+			s.Last_IO_Error = "error connecting to master"
+		}, "", Repl_IO_Broken, 0},
+		{"sql broken", func(s *QuerySlaveStatus) {
+			s.Slave_SQL_Running = "No"
+			s.Last_SQL_Errno = "1062"
+			s.Retrieved_Gtid_Set = "aaaaaaaa-0000-0000-0000-000000000001:1-120"
+		}, "", Repl_SQL_Broken, 20},
+		{"lag by seconds", func(s *QuerySlaveStatus) { s.Seconds_Behind_Master = 11 }, "", Repl_Lagging, 0},
+		{"lag by gtid gap", func(s *QuerySlaveStatus) {},
+			"aaaaaaaa-0000-0000-0000-000000000001:1-200", Repl_Lagging, 100},
+		{"gap under threshold", func(s *QuerySlaveStatus) {},
+			"aaaaaaaa-0000-0000-0000-000000000001:1-120,\nbbbbbbbb-0000-0000-0000-000000000002:1", Repl_Healthy, 21},
+	}
+	for _, c := range cases {
+		status := newHealthySlaveStatus()
+		c.modify(&status)
+		health := EvaluateReplicationHealth(status, c.master, threshold)
+		if health.State != c.wantState {
+			t.Errorf("%v: state=[%v] want=[%v] reason=[%v]", c.name, health.State, c.wantState, health.Reason)
+		}
+		if health.GtidGapTrx != c.wantGap {
+			t.Errorf("%v: gtid gap trx=[%v] want=[%v] gap=[%v]", c.name, health.GtidGapTrx, c.wantGap, health.GtidGap)
+		}
+	}
+}
+
+func TestEvaluateReplicationHealthErrno(t *testing.T) {
+	status := newHealthySlaveStatus()
+	status.Slave_SQL_Running = "No"
+	status.Last_SQL_Errno = "1032"
+	status.Last_SQL_Error = "Could not execute Delete_rows event"
+	health := EvaluateReplicationHealth(status, "", DefaultReplicationThreshold)
+	if health.LastSQLErrno != 1032 || health.LastSQLError != status.Last_SQL_Error {
+		t.Errorf("unexpected sql error. health=[%+v]", health)
+	}
+	if health.IsHealthy() {
+		t.Errorf("sql broken replica should not be healthy")
+	}
+}
+
+func TestGtidGap(t *testing.T) {
+	gap, trx, err := gtidGap(uuid1+":1-10:20-30,"+uuid2+":1-5", uuid1+":1-5:25,"+uuid2+":1-5")
+	if nil != err {
+		t.Fatalf("gtidGap fail. err=[%v]", err)
+	}
+	if gap != uuid1+":6-10:20-24:26-30" || trx != 15 {
+		t.Errorf("gap=[%v] trx=[%v]", gap, trx)
+	}
+	if _, _, err := gtidGap(uuid1+":x-3", ""); nil == err {
+		t.Errorf("gtidGap should fail on bad interval")
+	}
+}
@@ -0,0 +1,310 @@
+package mysql
+
+/*
+ * 连接池监控
+ * 1、EnableMetrics开启后统计语句数、按错误分类的错误数及按语句指纹(Fingerprint)的耗时分布
+ * 2、耗时超过慢查询阈值的语句记录慢查询日志，查询语句的耗时包含读取结果集的时间，在Rows读完或关闭时记录
+ * 3、Metrics()返回快照，MetricsHandler以Prometheus文本格式输出
+ *
+ * Demo：
+ *	pool.EnableMetrics(200 * time.Millisecond)
+ *	http.Handle("/metrics", MetricsHandler(map[string]*DBPool{"monitor": pool}))
+ *	go http.ListenAndServe("127.0.0.1:9104", nil)
+ */
+import (
+	"database/sql"
+	"fmt"
+	"go-tools/log"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 耗时分布的桶上限
+var LatencyBuckets = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+}
+
+// 最多统计的语句数，超出后合并到指纹为STATEMENT_OVERFLOW的统计
+const (
+	MAX_METRICS_STATEMENTS = 1000
+	STATEMENT_OVERFLOW     = "<other>"
+)
+
+// 单类语句的统计
+type StatementMetrics struct {
+	Fingerprint string        // 语句指纹，Prometheus标签使用指纹
+	Statement   string        // 首次出现时归一化后的SQL
+	Count       int64         // 执行次数
+	Errors      int64         // 失败次数
+	Slow        int64         // 慢查询次数
+	TotalTime   time.Duration // 累计耗时
+	Buckets     []int64       // 耗时<=LatencyBuckets[i]的次数(累计)，最后一个为全部
+}
+
+// 连接池监控快照
+type MetricsSnapshot struct {
+	Stats       sql.DBStats
+	Statements  int64                // 执行的语句总数
+	Errors      map[ErrorClass]int64 // 按分类的错误数
+	SlowQueries int64                // 慢查询总数
+	ByStatement []StatementMetrics   // 按Fingerprint排序
+}
+
+// 连接池监控数据
+type poolMetrics struct {
+	lock          sync.Mutex
+	slowThreshold time.Duration
+	statements    int64
+	errors        map[ErrorClass]int64
+	slowQueries   int64
+	byStatement   map[string]*StatementMetrics // key为语句指纹
+}
+
+/*
+ * 开启监控，slowThreshold为慢查询阈值，<=0时不记录慢查询
+ * 需要在连接池初始化时调用，重复调用会清空已有数据
+ */
+func (db *DBPool) EnableMetrics(slowThreshold time.Duration) {
+	db.metrics = &poolMetrics{
+		slowThreshold: slowThreshold,
+		errors:        make(map[ErrorClass]int64),
+		byStatement:   make(map[string]*StatementMetrics),
+	}
+}
+
+// 监控快照，未开启监控时只包含sql.DBStats
+func (db *DBPool) Metrics() MetricsSnapshot {
+	snapshot := MetricsSnapshot{Stats: db.Stats(), Errors: make(map[ErrorClass]int64)}
+	m := db.metrics
+	if nil == m {
+		return snapshot
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	snapshot.Statements = m.statements
+	snapshot.SlowQueries = m.slowQueries
+	for class, count := range m.errors {
+		snapshot.Errors[class] = count
+	}
+	for _, stat := range m.byStatement {
+		copied := *stat
+		copied.Buckets = append([]int64(nil), stat.Buckets...)
+		snapshot.ByStatement = append(snapshot.ByStatement, copied)
+	}
+	sort.Slice(snapshot.ByStatement, func(i, j int) bool {
+		return snapshot.ByStatement[i].Fingerprint < snapshot.ByStatement[j].Fingerprint
+	})
+	return snapshot
+}
+
+/*
+ * 记录一次语句执行，rowsAffected<0表示未知(查询语句)
+ * 未开启监控时不做任何事
+ */
+func (db *DBPool) observe(sqlText string, start time.Time, rowsAffected int64, err error) {
+	m := db.metrics
+	if nil == m {
+		return
+	}
+	elapsed := time.Since(start)
+	statement := NormalizeSQL(sqlText)
+	fingerprint := normalizedFingerprint(statement)
+	slow := m.slowThreshold > 0 && elapsed >= m.slowThreshold
+
+	m.lock.Lock()
+	m.statements++
+	if nil != err {
+		m.errors[ClassifyError(err)]++
+	}
+	if slow {
+		m.slowQueries++
+	}
+	stat, ok := m.byStatement[fingerprint]
+	if !ok {
+		key := fingerprint
+		if len(m.byStatement) >= MAX_METRICS_STATEMENTS {
+			key = STATEMENT_OVERFLOW
+			stat, ok = m.byStatement[key]
+		}
+		if !ok {
+			stat = &StatementMetrics{Fingerprint: key, Statement: statement, Buckets: make([]int64, len(LatencyBuckets)+1)}
+			if STATEMENT_OVERFLOW == key {
+				stat.Statement = STATEMENT_OVERFLOW
+			}
+			m.byStatement[key] = stat
+		}
+	}
+	stat.Count++
+	stat.TotalTime += elapsed
+	if nil != err {
+		stat.Errors++
+	}
+	if slow {
+		stat.Slow++
+	}
+	for i, bucket := range LatencyBuckets {
+		if elapsed <= bucket {
+			stat.Buckets[i]++
+		}
+	}
+	stat.Buckets[len(LatencyBuckets)]++
+	m.lock.Unlock()
+
+	if slow {
+		log.Log.Warning("Slow query. duration=[%v] rows_affected=[%v] fingerprint=[%s] sql=[%s] err=[%v]",
+			elapsed, rowsAffected, fingerprint, statement, err)
+	}
+}
+
+// 执行结果影响的行数，未知时返回-1
+func resultRowsAffected(result sql.Result) int64 {
+	if nil == result {
+		return -1
+	}
+	rows, err := result.RowsAffected()
+	if nil != err {
+		return -1
+	}
+	return rows
+}
+
+/*
+ * Prometheus文本格式的监控接口，pools的key作为pool标签
+ */
+func MetricsHandler(pools map[string]*DBPool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if err := WritePrometheus(w, pools); nil != err {
+			log.Log.Warning("Fail to write metrics. reason=[%v]", err)
+		}
+	})
+}
+
+// 以Prometheus文本格式输出监控数据
+func WritePrometheus(w io.Writer, pools map[string]*DBPool) error {
+	names := make([]string, 0, len(pools))
+	for name := range pools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	snapshots := make([]MetricsSnapshot, len(names))
+	for i, name := range names {
+		snapshots[i] = pools[name].Metrics()
+	}
+
+	p := &promWriter{w: w}
+	gauges := []struct {
+		name  string
+		help  string
+		kind  string
+		value func(s sql.DBStats) float64
+	}{
+		{"mysql_pool_max_open_connections", "Maximum number of open connections.", "gauge",
+			func(s sql.DBStats) float64 { return float64(s.MaxOpenConnections) }},
+		{"mysql_pool_open_connections", "Number of established connections.", "gauge",
+			func(s sql.DBStats) float64 { return float64(s.OpenConnections) }},
+		{"mysql_pool_in_use_connections", "Number of connections currently in use.", "gauge",
+			func(s sql.DBStats) float64 { return float64(s.InUse) }},
+		{"mysql_pool_idle_connections", "Number of idle connections.", "gauge",
+			func(s sql.DBStats) float64 { return float64(s.Idle) }},
+		{"mysql_pool_wait_count_total", "Total number of connections waited for.", "counter",
+			func(s sql.DBStats) float64 { return float64(s.WaitCount) }},
+		{"mysql_pool_wait_duration_seconds_total", "Total time blocked waiting for a new connection.", "counter",
+			func(s sql.DBStats) float64 { return s.WaitDuration.Seconds() }},
+		{"mysql_pool_max_idle_closed_total", "Total number of connections closed due to SetMaxIdleConns.", "counter",
+			func(s sql.DBStats) float64 { return float64(s.MaxIdleClosed) }},
+		{"mysql_pool_max_lifetime_closed_total", "Total number of connections closed due to SetConnMaxLifetime.", "counter",
+			func(s sql.DBStats) float64 { return float64(s.MaxLifetimeClosed) }},
+	}
+	for _, g := range gauges {
+		p.header(g.name, g.help, g.kind)
+		for i, name := range names {
+			p.sample(g.name, g.value(snapshots[i].Stats), "pool", name)
+		}
+	}
+
+	p.header("mysql_pool_statements_total", "Total number of executed statements.", "counter")
+	for i, name := range names {
+		p.sample("mysql_pool_statements_total", float64(snapshots[i].Statements), "pool", name)
+	}
+	p.header("mysql_pool_slow_queries_total", "Total number of slow statements.", "counter")
+	for i, name := range names {
+		p.sample("mysql_pool_slow_queries_total", float64(snapshots[i].SlowQueries), "pool", name)
+	}
+	p.header("mysql_pool_errors_total", "Total number of failed statements by error class.", "counter")
+	for i, name := range names {
+		classes := make([]ErrorClass, 0, len(snapshots[i].Errors))
+		for class := range snapshots[i].Errors {
+			classes = append(classes, class)
+		}
+		sort.Slice(classes, func(a, b int) bool { return classes[a] < classes[b] })
+		for _, class := range classes {
+			p.sample("mysql_pool_errors_total", float64(snapshots[i].Errors[class]), "pool", name, "class", class.String())
+		}
+	}
+	// 归一化后的SQL可能很长，标签只使用指纹，指纹对应的语句见慢查询日志或Metrics()
+	p.header("mysql_pool_statement_duration_seconds", "Statement latency by SQL fingerprint.", "histogram")
+	for i, name := range names {
+		for _, stat := range snapshots[i].ByStatement {
+			for b, bucket := range LatencyBuckets {
+				p.sample("mysql_pool_statement_duration_seconds_bucket", float64(stat.Buckets[b]),
+					"pool", name, "fingerprint", stat.Fingerprint, "le", formatFloat(bucket.Seconds()))
+			}
+			p.sample("mysql_pool_statement_duration_seconds_bucket", float64(stat.Buckets[len(LatencyBuckets)]),
+				"pool", name, "fingerprint", stat.Fingerprint, "le", "+Inf")
+			p.sample("mysql_pool_statement_duration_seconds_sum", stat.TotalTime.Seconds(),
+				"pool", name, "fingerprint", stat.Fingerprint)
+			p.sample("mysql_pool_statement_duration_seconds_count", float64(stat.Count),
+				"pool", name, "fingerprint", stat.Fingerprint)
+		}
+	}
+	return p.err
+}
+
+// Prometheus文本格式输出，记录第一个写入错误
+type promWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (p *promWriter) header(name string, help string, kind string) {
+	p.printf("# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// labels为key、value交替的标签列表
+func (p *promWriter) sample(name string, value float64, labels ...string) {
+	pairs := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", labels[i], escapeLabel(labels[i+1])))
+	}
+	p.printf("%s{%s} %s\n", name, strings.Join(pairs, ","), formatFloat(value))
+}
+
+func (p *promWriter) printf(format string, args ...interface{}) {
+	if nil != p.err {
+		return
+	}
+	_, p.err = fmt.Fprintf(p.w, format, args...)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
@@ -0,0 +1,113 @@
+package mysql
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	mysqlDriver "github.com/go-sql-driver/mysql"
+)
+
+func newMetricsPool(t *testing.T) *DBPool {
+	pool, _ := newFakePool(t, map[string]fakeResult{
+		"update  a\n where id = 1": {rowsAffected: 1},
+		"select slow":              {columns: []string{"id"}, delay: 20 * time.Millisecond},
+		"insert dup":               {err: &mysqlDriver.MySQLError{Number: ER_DUP_ENTRY}},
+		"select broken":            {columns: []string{"id"}, rowsErr: &mysqlDriver.MySQLError{Number: ER_LOCK_WAIT_TIMEOUT}},
+	})
+	pool.EnableMetrics(10 * time.Millisecond)
+	for i := 0; i < 2; i++ {
+		if _, err := pool.DBExec(nil, nil, 3, "update  a\n where id = 1"); nil != err {
+			t.Fatalf("DBExec fail. err=[%v]", err)
+		}
+	}
+	mustQuery(t, pool, nil, "select slow")
+	pool.DBExec(nil, nil, 3, "insert dup")
+	return pool
+}
+
+// 按归一化后的SQL查找语句的统计
+func findStatementMetrics(snapshot MetricsSnapshot, statement string) StatementMetrics {
+	for _, stat := range snapshot.ByStatement {
+		if statement == stat.Statement {
+			return stat
+		}
+	}
+	return StatementMetrics{}
+}
+
+func TestPoolMetrics(t *testing.T) {
+	snapshot := newMetricsPool(t).Metrics()
+	if 4 != snapshot.Statements || 1 != snapshot.SlowQueries || 1 != snapshot.Errors[ErrClass_Duplicate] {
+		t.Errorf("unexpected snapshot. snapshot=[%+v]", snapshot)
+	}
+	if 3 != len(snapshot.ByStatement) {
+		t.Fatalf("unexpected statements. statements=[%+v]", snapshot.ByStatement)
+	}
+	update := findStatementMetrics(snapshot, "update a where id = ?")
+	if Fingerprint("update a where id = 2") != update.Fingerprint || 2 != update.Count || 2 != update.Buckets[len(LatencyBuckets)] {
+		t.Errorf("unexpected update metrics. metrics=[%+v]", update)
+	}
+	slow := findStatementMetrics(snapshot, "select slow")
+	if 1 != slow.Count || 1 != slow.Slow || 0 != slow.Buckets[0] {
+		t.Errorf("unexpected slow query metrics. metrics=[%+v]", slow)
+	}
+
+	pool, _ := newFakePool(t, map[string]fakeResult{"select a": fakeSequenceRows("id", 1)})
+	mustQuery(t, pool, nil, "select a")
+	if snapshot = pool.Metrics(); 0 != snapshot.Statements {
+		t.Errorf("metrics should be disabled by default. snapshot=[%+v]", snapshot)
+	}
+}
+
+func TestQueryMetricsOnRowsEnd(t *testing.T) {
+	pool := newMetricsPool(t)
+	res, err := pool.QueryWithExecutor(nil, 3, "select broken")
+	if nil != err {
+		t.Fatalf("Query fail. err=[%v]", err)
+	}
+	// 结果集读完之前不记录
+	if snapshot := pool.Metrics(); 4 != snapshot.Statements {
+		t.Errorf("query should be observed after rows end. snapshot=[%+v]", snapshot)
+	}
+	for res.Rows.Next() {
+	}
+	res.Close()
+	snapshot := pool.Metrics()
+	if 5 != snapshot.Statements || 1 != snapshot.Errors[ErrClass_Retryable] {
+		t.Errorf("rows error should be observed once. snapshot=[%+v]", snapshot)
+	}
+	if broken := findStatementMetrics(snapshot, "select broken"); 1 != broken.Count || 1 != broken.Errors {
+		t.Errorf("unexpected query metrics. metrics=[%+v]", broken)
+	}
+}
+
+func TestMetricsHandler(t *testing.T) {
+	pool := newMetricsPool(t)
+	recorder := httptest.NewRecorder()
+	MetricsHandler(map[string]*DBPool{"monitor": pool}).ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	body := recorder.Body.String()
+	for _, want := range []string{
+		"# TYPE mysql_pool_statements_total counter\n",
+		`mysql_pool_statements_total{pool="monitor"} 4`,
+		`mysql_pool_slow_queries_total{pool="monitor"} 1`,
+		`mysql_pool_errors_total{pool="monitor",class="duplicate"} 1`,
+		`mysql_pool_statement_duration_seconds_bucket{pool="monitor",fingerprint="` + Fingerprint("update a where id = 1") + `",le="+Inf"} 2`,
+		`mysql_pool_statement_duration_seconds_count{pool="monitor",fingerprint="` + Fingerprint("select slow") + `"} 1`,
+		`mysql_pool_open_connections{pool="monitor"} `,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics output does not contain [%v]. body=[%v]", want, body)
+		}
+	}
+	if !strings.HasPrefix(recorder.Header().Get("Content-Type"), "text/plain") {
+		t.Errorf("unexpected content type. type=[%v]", recorder.Header().Get("Content-Type"))
+	}
+}
+
+func TestEscapeLabel(t *testing.T) {
+	if got := escapeLabel("a\"b\\c\nd"); `a\"b\\c\nd` != got {
+		t.Errorf("escapeLabel=[%v]", got)
+	}
+}
@@ -0,0 +1,161 @@
+package mysql
+
+/*
+ * 连接池构造
+ * 1、NewDBPoolFromConfig读取log.Config，使用第一个未禁用的online-dsn/test-dsn
+ * 2、NewDBPool使用显式配置，设置连接数及连接生命周期
+ * 3、PingTimeout>0时启动时检查连通性，失败时关闭连接池并返回错误，成功后识别数据库分支
+ * 4、配置错误返回*log.ConfigError，Field为出错的配置项
+ *
+ * Demo：
+ *	pool, err := NewDBPoolFromConfig(log.Config)
+ *	if nil != err {
+ *		log.Log.Error("Fail to init mysql pool. reason=[%v]", err)
+ *	}
+ *	defer pool.Close()
+ */
+import (
+	"context"
+	"database/sql"
+	"go-tools/log"
+	"time"
+)
+
+// 连接生命周期的默认值
+const (
+	DEFAULT_CONN_MAX_LIFETIME  = time.Hour
+	DEFAULT_CONN_MAX_IDLE_TIME = 10 * time.Minute
+)
+
+// 连接池配置
+type PoolOptions struct {
+	DSN             *log.DSN      // 数据库连接配置
+	MaxOpenConns    int           // 最大连接数，0为不限制
+	MaxIdleConns    int           // 最大空闲连接数，0为驱动默认值
+	ConnMaxLifetime time.Duration // 连接最长使用时间，0为不限制
+	ConnMaxIdleTime time.Duration // 连接最长空闲时间，0为不限制
+	PingTimeout     time.Duration // 启动时ping的超时时间，0为不检查
+	RWTimeOutSec    int           // 内部查询的读写超时，单位秒，0为DEFAULT_RW_TIMEOUT_SEC
+	Flavor          Flavor        // 数据库分支，Flavor_Unknown时在ping成功后自动识别
+}
+
+/*
+ * 从全局配置生成连接池配置
+ * conn-time-out作为连接及ping超时，query-time-out作为内部查询超时及未配置读写超时时dsn的读写超时
+ */
+func PoolOptionsFromConfig(conf *log.Configuration) (opts PoolOptions, err error) {
+	if nil == conf {
+		return opts, &log.ConfigError{Field: "config", Reason: "config is nil"}
+	}
+	var dsn log.DSN
+	switch {
+	case nil != conf.OnlineDSN && !conf.OnlineDSN.Disable:
+		dsn = *conf.OnlineDSN
+	case nil != conf.TestDSN && !conf.TestDSN.Disable:
+		dsn = *conf.TestDSN
+	default:
+		return opts, &log.ConfigError{Field: "online-dsn", Reason: "online-dsn and test-dsn are all disabled"}
+	}
+	if conf.MysqlConnTimeOut < 0 {
+		return opts, &log.ConfigError{Field: "conn-time-out", Value: conf.MysqlConnTimeOut, Reason: "timeout must not be negative"}
+	}
+	if conf.QueryTimeOut < 0 {
+		return opts, &log.ConfigError{Field: "query-time-out", Value: conf.QueryTimeOut, Reason: "timeout must not be negative"}
+	}
+	if 0 == dsn.ConnectTimeout {
+		dsn.ConnectTimeout = conf.MysqlConnTimeOut
+	}
+	if 0 == dsn.ReadTimeout {
+		dsn.ReadTimeout = conf.QueryTimeOut
+	}
+	if 0 == dsn.WriteTimeout {
+		dsn.WriteTimeout = conf.QueryTimeOut
+	}
+	return PoolOptions{
+		DSN:             &dsn,
+		MaxOpenConns:    conf.MaxOpenConns,
+		MaxIdleConns:    conf.MaxIdleConns,
+		ConnMaxLifetime: DEFAULT_CONN_MAX_LIFETIME,
+		ConnMaxIdleTime: DEFAULT_CONN_MAX_IDLE_TIME,
+		PingTimeout:     time.Duration(conf.MysqlConnTimeOut) * time.Second,
+		RWTimeOutSec:    conf.QueryTimeOut,
+	}, nil
+}
+
+// 校验连接池配置
+func (opts PoolOptions) Validate() error {
+	if nil == opts.DSN {
+		return &log.ConfigError{Field: "dsn", Reason: "dsn is required"}
+	}
+	if err := opts.DSN.Validate(); nil != err {
+		return err
+	}
+	switch {
+	case opts.MaxOpenConns < 0:
+		return &log.ConfigError{Field: "max-open-conns", Value: opts.MaxOpenConns, Reason: "must not be negative"}
+	case opts.MaxIdleConns < 0:
+		return &log.ConfigError{Field: "max-idle-conns", Value: opts.MaxIdleConns, Reason: "must not be negative"}
+	case opts.MaxOpenConns > 0 && opts.MaxIdleConns > opts.MaxOpenConns:
+		return &log.ConfigError{Field: "max-idle-conns", Value: opts.MaxIdleConns, Reason: "greater than max-open-conns"}
+	case opts.ConnMaxLifetime < 0:
+		return &log.ConfigError{Field: "conn-max-lifetime", Value: opts.ConnMaxLifetime, Reason: "must not be negative"}
+	case opts.ConnMaxIdleTime < 0:
+		return &log.ConfigError{Field: "conn-max-idle-time", Value: opts.ConnMaxIdleTime, Reason: "must not be negative"}
+	case opts.PingTimeout < 0:
+		return &log.ConfigError{Field: "ping-timeout", Value: opts.PingTimeout, Reason: "must not be negative"}
+	case opts.RWTimeOutSec < 0:
+		return &log.ConfigError{Field: "rw-timeout", Value: opts.RWTimeOutSec, Reason: "must not be negative"}
+	case opts.Flavor < Flavor_Unknown || opts.Flavor > Flavor_FDB:
+		return &log.ConfigError{Field: "flavor", Value: opts.Flavor, Reason: "unknown flavor"}
+	}
+	return nil
+}
+
+// 使用全局配置创建连接池
+func NewDBPoolFromConfig(conf *log.Configuration) (*DBPool, error) {
+	opts, err := PoolOptionsFromConfig(conf)
+	if nil != err {
+		log.Log.Warning("Fail to read mysql pool config. reason=[%v]", err)
+		return nil, err
+	}
+	return NewDBPool(opts)
+}
+
+// 创建连接池
+func NewDBPool(opts PoolOptions) (*DBPool, error) {
+	if err := opts.Validate(); nil != err {
+		log.Log.Warning("Invalid mysql pool config. reason=[%v]", err)
+		return nil, err
+	}
+	dataSource, err := opts.DSN.FormatDSN()
+	if nil != err {
+		return nil, err
+	}
+	db, err := sql.Open("mysql", dataSource)
+	if nil != err {
+		log.Log.Warning("Fail to open mysql pool. addr=[%v] reason=[%v]", opts.DSN.Addr, err)
+		return nil, err
+	}
+	db.SetMaxOpenConns(opts.MaxOpenConns)
+	if opts.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(opts.MaxIdleConns)
+	}
+	db.SetConnMaxLifetime(opts.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(opts.ConnMaxIdleTime)
+
+	pool := &DBPool{DB: db, RWTimeOutSec: opts.RWTimeOutSec, Flavor: opts.Flavor}
+	if opts.PingTimeout > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), opts.PingTimeout)
+		defer cancel()
+		if err = db.PingContext(ctx); nil != err {
+			db.Close()
+			log.Log.Warning("Fail to ping mysql. addr=[%v] reason=[%v]", opts.DSN.Addr, err)
+			return nil, err
+		}
+		// 识别失败不影响使用，按MySQL处理
+		if Flavor_Unknown == pool.Flavor {
+			pool.DetectFlavor(nil)
+		}
+	}
+	return pool, nil
+}
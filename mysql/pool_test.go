@@ -0,0 +1,87 @@
+package mysql
+
+import (
+	"go-tools/log"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestPoolOptionsFromConfig(t *testing.T) {
+	conf := &log.Configuration{
+		OnlineDSN:        &log.DSN{Disable: true},
+		TestDSN:          &log.DSN{Addr: "127.0.0.1:3306", User: "root", ReadTimeout: 5},
+		MysqlConnTimeOut: 3,
+		QueryTimeOut:     30,
+		MaxIdleConns:     2,
+		MaxOpenConns:     10,
+	}
+	opts, err := PoolOptionsFromConfig(conf)
+	if nil != err {
+		t.Fatalf("PoolOptionsFromConfig fail. err=[%v]", err)
+	}
+	if 3 != opts.DSN.ConnectTimeout || 5 != opts.DSN.ReadTimeout || 30 != opts.DSN.WriteTimeout {
+		t.Errorf("unexpected dsn timeouts. dsn=[%+v]", opts.DSN)
+	}
+	if 10 != opts.MaxOpenConns || 2 != opts.MaxIdleConns || 3*time.Second != opts.PingTimeout {
+		t.Errorf("unexpected options. opts=[%+v]", opts)
+	}
+	if 0 != conf.TestDSN.ConnectTimeout {
+		t.Errorf("global dsn should not be modified. dsn=[%+v]", conf.TestDSN)
+	}
+
+	conf.TestDSN.Disable = true
+	if _, err = NewDBPoolFromConfig(conf); !isConfigError(err, "online-dsn") {
+		t.Errorf("expect online-dsn config error. err=[%v]", err)
+	}
+}
+
+func TestNewDBPoolValidate(t *testing.T) {
+	dsn := &log.DSN{Addr: "127.0.0.1:3306", User: "root"}
+	cases := map[string]PoolOptions{
+		"dsn":                {},
+		"user":               {DSN: &log.DSN{Addr: "127.0.0.1:3306"}},
+		"max-open-conns":     {DSN: dsn, MaxOpenConns: -1},
+		"max-idle-conns":     {DSN: dsn, MaxOpenConns: 2, MaxIdleConns: 3},
+		"conn-max-lifetime":  {DSN: dsn, ConnMaxLifetime: -time.Second},
+		"conn-max-idle-time": {DSN: dsn, ConnMaxIdleTime: -time.Second},
+		"ping-timeout":       {DSN: dsn, PingTimeout: -time.Second},
+	}
+	for field, opts := range cases {
+		if _, err := NewDBPool(opts); !isConfigError(err, field) {
+			t.Errorf("expect config error of [%v]. err=[%v]", field, err)
+		}
+	}
+
+	pool, err := NewDBPool(PoolOptions{DSN: dsn, MaxOpenConns: 4, MaxIdleConns: 2})
+	if nil != err {
+		t.Fatalf("NewDBPool without ping fail. err=[%v]", err)
+	}
+	defer pool.Close()
+	if 4 != pool.Stats().MaxOpenConnections {
+		t.Errorf("unexpected max open conns. stats=[%+v]", pool.Stats())
+	}
+}
+
+func TestNewDBPoolPingFail(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if nil != err {
+		t.Skipf("listen fail. err=[%v]", err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	_, err = NewDBPool(PoolOptions{DSN: &log.DSN{Addr: addr, User: "root"}, PingTimeout: time.Second})
+	if nil == err {
+		t.Fatalf("ping to closed port should fail")
+	}
+	if isConfigError(err, "") {
+		t.Errorf("ping failure should not be a config error. err=[%v]", err)
+	}
+}
+
+// err是否为Field=field的配置错误，field为空时只判断类型
+func isConfigError(err error, field string) bool {
+	configErr, ok := err.(*log.ConfigError)
+	return ok && ("" == field || field == configErr.Field)
+}
@@ -0,0 +1,310 @@
+package mysql
+
+/*
+ * 日志中的SQL展示
+ * 1、将?占位符替换为参数值，仅用于展示，执行时仍使用占位符
+ * 2、敏感列(如password)对应的参数及常量、Secret()包装的参数显示为'***'
+ * 3、超长的字符串及二进制参数截断展示
+ * 4、LogSQL返回的值只在日志实际输出时才渲染，日志级别关闭时没有额外开销
+ *
+ * Demo：
+ *	log.Log.Debug("Execute SQL. sql=[%s]", LogSQL("update user set password = ? where id = ?", pwd, 1))
+ *	// Execute SQL. sql=[update user set password = '***' where id = 1]
+ *	pool.DBExec(nil, nil, 3, "insert into t(name, token) values(?, ?)", name, Secret(token))
+ */
+import (
+	"database/sql/driver"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// 脱敏后的展示内容
+const REDACTED_VALUE = "'***'"
+
+// SQL展示配置
+type SQLRenderOptions struct {
+	SensitiveColumns []string // 列名包含其中任一关键字(大小写不敏感)时，对应的值脱敏
+	MaxValueLength   int      // 单个值最多展示的字节数，<=0时不截断
+	MaxSQLLength     int      // 整条SQL最多展示的字节数，<=0时不截断
+}
+
+// LogSQL使用的展示配置，需在初始化时修改
+var DefaultSQLRenderOptions = SQLRenderOptions{
+	SensitiveColumns: []string{"password", "passwd", "pwd", "secret", "token", "credential"},
+	MaxValueLength:   128,
+	MaxSQLLength:     4096,
+}
+
+// 日志中需要脱敏的参数，执行时按原值传给驱动
+type SecretValue struct {
+	V interface{}
+}
+
+// 包装需要在日志中脱敏的参数
+func Secret(v interface{}) SecretValue {
+	return SecretValue{V: v}
+}
+
+// 实现driver.Valuer，执行时使用原值
+func (s SecretValue) Value() (driver.Value, error) {
+	return driver.DefaultParameterConverter.ConvertValue(s.V)
+}
+
+func (s SecretValue) String() string {
+	return REDACTED_VALUE
+}
+
+// 延迟渲染的SQL，作为日志参数时只在输出时渲染
+type SQLLog struct {
+	sqlText string
+	params  []interface{}
+}
+
+// 返回用于日志展示的SQL
+func LogSQL(sqlText string, params ...interface{}) SQLLog {
+	return SQLLog{sqlText: sqlText, params: params}
+}
+
+func (l SQLLog) String() string {
+	return DefaultSQLRenderOptions.Render(l.sqlText, l.params...)
+}
+
+// 延迟计算的SQL指纹
+type fingerprintLog string
+
+func (f fingerprintLog) String() string {
+	return Fingerprint(string(f))
+}
+
+// 渲染用于展示的SQL
+func (o SQLRenderOptions) Render(sqlText string, params ...interface{}) string {
+	r := sqlRenderer{opts: o, sqlText: sqlText, params: params}
+	return truncateForLog(r.render(), o.MaxSQLLength)
+}
+
+// 单次渲染的状态
+type sqlRenderer struct {
+	opts    SQLRenderOptions
+	sqlText string
+	params  []interface{}
+	out     strings.Builder
+
+	paramIndex int
+	sensitive  bool // 下一个值是否需要脱敏
+
+	insertColumns []string // INSERT/REPLACE语句的列名
+	inValues      bool     // 是否已进入VALUES部分
+	depth         int      // VALUES部分的括号深度
+	columnIndex   int      // 当前值在行内的位置
+}
+
+func (r *sqlRenderer) render() string {
+	r.insertColumns = insertColumns(r.sqlText)
+	text := r.sqlText
+	for i := 0; i < len(text); {
+		c := text[i]
+		switch {
+		case '\'' == c || '"' == c:
+			end := skipQuoted(text, i, c)
+			if r.valueSensitive() {
+				r.out.WriteString(REDACTED_VALUE)
+			} else {
+				r.out.WriteString(truncateLiteral(text[i:end], r.opts.MaxValueLength))
+			}
+			r.sensitive = false
+			i = end
+		case '?' == c:
+			r.writeParam()
+			r.sensitive = false
+			i++
+		case '`' == c:
+			end := skipQuoted(text, i, c)
+			r.word(strings.Trim(text[i:end], "`"))
+			r.out.WriteString(text[i:end])
+			i = end
+		case isWordByte(c):
+			start := i
+			for i < len(text) && isWordByte(text[i]) {
+				i++
+			}
+			r.word(text[start:i])
+			r.out.WriteString(text[start:i])
+		case '/' == c && i+1 < len(text) && '*' == text[i+1]:
+			end := strings.Index(text[i+2:], "*/")
+			if -1 == end {
+				end = len(text)
+			} else {
+				end += i + 4
+			}
+			r.out.WriteString(text[i:end])
+			i = end
+		default:
+			r.punct(c)
+			r.out.WriteByte(c)
+			i++
+		}
+	}
+	if r.paramIndex < len(r.params) {
+		fmt.Fprintf(&r.out, " /* %d extra params */", len(r.params)-r.paramIndex)
+	}
+	return r.out.String()
+}
+
+// 处理单词，敏感列名或IDENTIFIED之后的值需要脱敏
+func (r *sqlRenderer) word(word string) {
+	lower := strings.ToLower(word)
+	switch {
+	case r.isSensitiveColumn(lower) || "identified" == lower:
+		r.sensitive = true
+	case "by" == lower || "like" == lower:
+		// IDENTIFIED BY 'x'、password LIKE 'x'，保持状态
+	case "values" == lower || "value" == lower:
+		r.sensitive = false
+		r.inValues = len(r.insertColumns) > 0
+	default:
+		r.sensitive = false
+	}
+}
+
+// 处理符号，比较及赋值运算符、左括号不改变脱敏状态
+func (r *sqlRenderer) punct(c byte) {
+	if r.inValues {
+		switch c {
+		case '(':
+			r.depth++
+			if 1 == r.depth {
+				r.columnIndex = 0
+			}
+		case ')':
+			r.depth--
+		case ',':
+			if 1 == r.depth {
+				r.columnIndex++
+			}
+		}
+	}
+	if !strings.ContainsRune("=<>!:( \t\r\n", rune(c)) {
+		r.sensitive = false
+	}
+}
+
+// 当前值是否需要脱敏
+func (r *sqlRenderer) valueSensitive() bool {
+	if r.sensitive {
+		return true
+	}
+	if r.inValues && 1 == r.depth && r.columnIndex < len(r.insertColumns) {
+		return r.isSensitiveColumn(r.insertColumns[r.columnIndex])
+	}
+	return false
+}
+
+func (r *sqlRenderer) writeParam() {
+	if r.paramIndex >= len(r.params) {
+		r.out.WriteByte('?')
+		return
+	}
+	param := r.params[r.paramIndex]
+	r.paramIndex++
+	if _, ok := param.(SecretValue); ok || r.valueSensitive() {
+		r.out.WriteString(REDACTED_VALUE)
+		return
+	}
+	r.out.WriteString(r.formatValue(param))
+}
+
+// 格式化参数值
+func (r *sqlRenderer) formatValue(param interface{}) string {
+	if valuer, ok := param.(driver.Valuer); ok {
+		value, err := valuer.Value()
+		if nil != err {
+			return fmt.Sprintf("'<%v>'", err)
+		}
+		param = value
+	}
+	switch v := param.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		return quoteForLog(truncateForLog(v, r.opts.MaxValueLength))
+	case []byte:
+		if utf8.Valid(v) {
+			return quoteForLog(truncateForLog(string(v), r.opts.MaxValueLength))
+		}
+		n := len(v)
+		if r.opts.MaxValueLength > 0 && n > r.opts.MaxValueLength/2 {
+			return fmt.Sprintf("0x%s...(len=%d)", hex.EncodeToString(v[:r.opts.MaxValueLength/2]), n)
+		}
+		return "0x" + hex.EncodeToString(v)
+	case time.Time:
+		return quoteForLog(v.Format("2006-01-02 15:04:05.999999"))
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return fmt.Sprintf("%v", v)
+	}
+	return quoteForLog(truncateForLog(fmt.Sprintf("%v", param), r.opts.MaxValueLength))
+}
+
+func (r *sqlRenderer) isSensitiveColumn(column string) bool {
+	column = strings.ToLower(column)
+	if dot := strings.LastIndexByte(column, '.'); -1 != dot {
+		column = column[dot+1:]
+	}
+	for _, keyword := range r.opts.SensitiveColumns {
+		if "" != keyword && strings.Contains(column, strings.ToLower(keyword)) {
+			return true
+		}
+	}
+	return false
+}
+
+// 解析INSERT/REPLACE语句的列名列表，不是此类语句或未指定列名时返回nil
+func insertColumns(sqlText string) []string {
+	normalized := strings.ToLower(sqlText)
+	trimmed := strings.TrimSpace(normalized)
+	if !strings.HasPrefix(trimmed, "insert") && !strings.HasPrefix(trimmed, "replace") {
+		return nil
+	}
+	start := strings.IndexByte(sqlText, '(')
+	end := strings.IndexByte(sqlText, ')')
+	values := strings.Index(normalized, "value")
+	if -1 == start || end < start || (-1 != values && values < start) {
+		return nil
+	}
+	var columns []string
+	for _, column := range strings.Split(sqlText[start+1:end], ",") {
+		columns = append(columns, strings.Trim(strings.TrimSpace(column), "`"))
+	}
+	return columns
+}
+
+// 超过maxLength字节时截断，并注明原长度
+func truncateForLog(s string, maxLength int) string {
+	if maxLength <= 0 || len(s) <= maxLength {
+		return s
+	}
+	cut := maxLength
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return fmt.Sprintf("%s...(len=%d)", s[:cut], len(s))
+}
+
+// 截断带引号的常量，保留首尾引号
+func truncateLiteral(literal string, maxLength int) string {
+	if maxLength <= 0 || len(literal) < maxLength+2 || literal[0] != literal[len(literal)-1] {
+		return truncateForLog(literal, maxLength)
+	}
+	return literal[:1] + truncateForLog(literal[1:len(literal)-1], maxLength) + literal[:1]
+}
+
+func quoteForLog(s string) string {
+	return "'" + strings.ReplaceAll(strings.ReplaceAll(s, `\`, `\\`), "'", `\'`) + "'"
+}
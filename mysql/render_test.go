@@ -0,0 +1,66 @@
+package mysql
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRenderSQL(t *testing.T) {
+	opts := DefaultSQLRenderOptions
+	opts.MaxValueLength = 8
+	cases := []struct {
+		sqlText string
+		params  []interface{}
+		want    string
+	}{
+		{"select * from t where id = ? and name = ?", []interface{}{5, "a'b"},
+			`select * from t where id = 5 and name = 'a\'b'`},
+		{"update user set password = ?, name = ? where id = ?", []interface{}{"pwd", "bob", 1},
+			"update user set password = '***', name = 'bob' where id = 1"},
+		{"  insert into user(`name`, user_token, age) values (?, ?, ?), (?, ?, ?)", []interface{}{"a", "t1", 1, "b", "t2", nil},
+			"  insert into user(`name`, user_token, age) values ('a', '***', 1), ('b', '***', NULL)"},
+		{"select * from t where u.Passwd like 'x%' and c = 'abcdefghijk'", nil,
+			"select * from t where u.Passwd like '***' and c = 'abcdefgh...(len=11)'"},
+		{"CREATE USER 'u'@'%' IDENTIFIED BY 'secret'", nil,
+			"CREATE USER 'u'@'%' IDENTIFIED BY '***'"},
+		{"select ? from t where a = '?' /* ? */", []interface{}{true, 2},
+			"select 1 from t where a = '?' /* ? */ /* 1 extra params */"},
+		{"select ?, ?", []interface{}{Secret("k")}, "select '***', ?"},
+		{"insert into t values (?)", []interface{}{[]byte{0xff, 0x00, 0x01, 0x02, 0x03, 0x04}},
+			"insert into t values (0xff000102...(len=6))"},
+		{"select ?", []interface{}{time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)}, "select '2020-01-02 03:04:05'"},
+		{"select ?", []interface{}{"中文中文中"}, "select '中文...(len=15)'"},
+	}
+	for _, c := range cases {
+		if got := opts.Render(c.sqlText, c.params...); c.want != got {
+			t.Errorf("Render(%q)=[%v], want [%v]", c.sqlText, got, c.want)
+		}
+	}
+
+	opts.MaxSQLLength = 10
+	if got := opts.Render("select * from long_table"); "select * f...(len=24)" != got {
+		t.Errorf("sql should be truncated. got=[%v]", got)
+	}
+}
+
+func TestLogSQL(t *testing.T) {
+	got := fmt.Sprintf("sql=[%s]", LogSQL("select * from t where token = ? and id = ?", "abc", 1))
+	if "sql=[select * from t where token = '***' and id = 1]" != got {
+		t.Errorf("unexpected log. got=[%v]", got)
+	}
+	if strings.Contains(got, "%!") {
+		t.Errorf("log should not contain format errors. got=[%v]", got)
+	}
+
+	value, err := Secret("pwd").Value()
+	if nil != err || "pwd" != value {
+		t.Errorf("Secret should pass the raw value to the driver. value=[%v] err=[%v]", value, err)
+	}
+
+	pool, _ := newFakePool(t, map[string]fakeResult{"update t set password = ? where id = ?": {rowsAffected: 1}})
+	if _, err := pool.DBExec(nil, nil, 3, "update t set password = ? where id = ?", Secret("pwd"), 1); nil != err {
+		t.Errorf("DBExec with Secret param fail. err=[%v]", err)
+	}
+}
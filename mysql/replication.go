@@ -0,0 +1,130 @@
+package mysql
+
+/*
+ * SHOW MASTER STATUS / SHOW SLAVE STATUS / SHOW REPLICA STATUS 按列名解析
+ * 1、通过rows.Columns()获取列名，按列名而非列位置赋值，兼容MySQL 5.6/5.7/8.0及FDB的列差异
+ * 2、所有列先以sql.NullString读取，NULL值不会中断后续列的赋值
+ * 3、8.0.22之后的Source_*、Replica_*列名统一转换为Master_*、Slave_*后再匹配结构体字段
+ * 4、结构体中不存在的列直接忽略
+ */
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// 按列名读取的单行结果
+type statusRow struct {
+	Columns []string
+	Values  []sql.NullString
+}
+
+// 读取结果集中的所有行，所有列均以sql.NullString接收
+func scanStatusRows(rows *Rows) (records []statusRow, err error) {
+	if nil == rows {
+		return nil, errors.New("No result for query. rows is nil")
+	}
+	columns, err := rows.Columns()
+	if nil != err {
+		return nil, err
+	}
+	for rows.Next() {
+		values := make([]sql.NullString, len(columns))
+		dest := make([]interface{}, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err = rows.Scan(dest...); nil != err {
+			return records, err
+		}
+		records = append(records, statusRow{Columns: columns, Values: values})
+	}
+	return records, rows.Err()
+}
+
+// 将8.0.22之后的新术语列名转换为旧术语，如Source_Host -> Master_Host、Replica_IO_Running -> Slave_IO_Running
+// 按"_"切分后整词替换，避免误改Replicate_Do_DB之类的列
+func normalizeStatusColumn(column string) string {
+	words := strings.Split(column, "_")
+	for i, word := range words {
+		switch strings.ToLower(word) {
+		case "source":
+			words[i] = "Master"
+		case "replica":
+			words[i] = "Slave"
+		}
+	}
+	return strings.ToLower(strings.Join(words, "_"))
+}
+
+// 按列名为结构体字段赋值，字段名与列名大小写不敏感匹配，未知列忽略
+// ptrStruct 必须为结构体指针，字段类型支持string及各类整型
+func assignStatusRow(ptrStruct interface{}, row statusRow) error {
+	value := reflect.ValueOf(ptrStruct)
+	if value.Kind() != reflect.Ptr || value.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("assignStatusRow need a pointer to struct. type=[%T]", ptrStruct)
+	}
+	elem := value.Elem()
+	fields := make(map[string]int, elem.NumField())
+	for i := 0; i < elem.NumField(); i++ {
+		fields[normalizeStatusColumn(elem.Type().Field(i).Name)] = i
+	}
+	for i, column := range row.Columns {
+		index, ok := fields[normalizeStatusColumn(column)]
+		if !ok {
+			continue
+		}
+		if !row.Values[i].Valid {
+			continue
+		}
+		field := elem.Field(index)
+		raw := row.Values[i].String
+		switch field.Kind() {
+		case reflect.String:
+			field.SetString(raw)
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if "" == raw {
+				continue
+			}
+			num, err := strconv.ParseInt(raw, 10, field.Type().Bits())
+			if nil != err {
+				return fmt.Errorf("Fail to parse column=[%v] value=[%v] reason=[%v]", column, raw, err)
+			}
+			field.SetInt(num)
+		default:
+			return fmt.Errorf("Unsupported field type. column=[%v] type=[%v]", column, field.Type())
+		}
+	}
+	return nil
+}
+
+// 判断某列是否为NULL，列不存在时同样视为NULL
+func (row statusRow) isNull(column string) bool {
+	for i, name := range row.Columns {
+		if normalizeStatusColumn(name) == normalizeStatusColumn(column) {
+			return !row.Values[i].Valid
+		}
+	}
+	return true
+}
+
+// 解析单行show master status结果
+func parseMasterStatus(row statusRow) (masterStatus QueryMasterStatus, err error) {
+	err = assignStatusRow(&masterStatus, row)
+	return masterStatus, err
+}
+
+// 解析单行show slave status结果
+// Seconds_Behind_Master为NULL时(IO或SQL线程未运行)，置为SECONDS_BEHIND_MASTER_UNKNOWN
+func parseSlaveStatus(row statusRow) (slaveStatus QuerySlaveStatus, err error) {
+	if err = assignStatusRow(&slaveStatus, row); nil != err {
+		return slaveStatus, err
+	}
+	if row.isNull("Seconds_Behind_Master") {
+		slaveStatus.Seconds_Behind_Master = SECONDS_BEHIND_MASTER_UNKNOWN
+	}
+	return slaveStatus, nil
+}
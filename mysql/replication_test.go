@@ -0,0 +1,145 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+)
+
+// 构造按列名解析的测试行，nil表示NULL
+func newStatusRow(kv ...interface{}) statusRow {
+	var row statusRow
+	for i := 0; i+1 < len(kv); i += 2 {
+		row.Columns = append(row.Columns, kv[i].(string))
+		if nil == kv[i+1] {
+			row.Values = append(row.Values, sql.NullString{})
+		} else {
+			row.Values = append(row.Values, sql.NullString{String: kv[i+1].(string), Valid: true})
+		}
+	}
+	return row
+}
+
+func TestParseSlaveStatus57(t *testing.T) {
+	row := newStatusRow(
+		"Slave_IO_State", "Waiting for master to send event",
+		"Master_Host", "10.0.0.1",
+		"Master_Port", "3306",
+		"Read_Master_Log_Pos", "154",
+		"Slave_IO_Running", "Yes",
+		"Slave_SQL_Running", "Yes",
+		"Exec_Master_Log_Pos", "154",
+		"Seconds_Behind_Master", "3",
+		"SQL_Remaining_Delay", nil,
+		"Executed_Gtid_Set", "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5",
+		"Channel_Name", "",
+	)
+	status, err := parseSlaveStatus(row)
+	if nil != err {
+		t.Fatalf("parseSlaveStatus fail. err=[%v]", err)
+	}
+	if status.Master_Host != "10.0.0.1" || status.Master_Port != 3306 || status.Read_Master_Log_Pos != 154 {
+		t.Errorf("unexpected master info. status=[%+v]", status)
+	}
+	if status.Seconds_Behind_Master != 3 {
+		t.Errorf("Seconds_Behind_Master=[%v], want 3", status.Seconds_Behind_Master)
+	}
+	// SQL_Remaining_Delay为NULL时不能影响后续列
+	if status.Executed_Gtid_Set != "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5" {
+		t.Errorf("Executed_Gtid_Set=[%v] lost after NULL column", status.Executed_Gtid_Set)
+	}
+}
+
+func TestParseSlaveStatus80(t *testing.T) {
+	row := newStatusRow(
+		"Replica_IO_State", "Waiting for source to send event",
+		"Source_Host", "10.0.0.2",
+		"Source_Port", "3307",
+		"Read_Source_Log_Pos", "2048",
+		"Relay_Source_Log_File", "binlog.000003",
+		"Replica_IO_Running", "Yes",
+		"Replica_SQL_Running", "No",
+		"Replicate_Do_DB", "db1",
+		"Seconds_Behind_Source", nil,
+		"Source_UUID", "uuid-2",
+		"Network_Namespace", "",
+		"Channel_Name", "ch1",
+	)
+	status, err := parseSlaveStatus(row)
+	if nil != err {
+		t.Fatalf("parseSlaveStatus fail. err=[%v]", err)
+	}
+	if status.Master_Host != "10.0.0.2" || status.Master_Port != 3307 || status.Read_Master_Log_Pos != 2048 {
+		t.Errorf("unexpected source info. status=[%+v]", status)
+	}
+	if status.Slave_IO_Running != "Yes" || status.Slave_SQL_Running != "No" {
+		t.Errorf("unexpected running state. status=[%+v]", status)
+	}
+	if status.Relay_Master_Log_File != "binlog.000003" || status.Master_UUID != "uuid-2" {
+		t.Errorf("unexpected renamed columns. status=[%+v]", status)
+	}
+	if status.Replicate_Do_DB != "db1" {
+		t.Errorf("Replicate_Do_DB=[%v], want db1", status.Replicate_Do_DB)
+	}
+	if status.Seconds_Behind_Master != SECONDS_BEHIND_MASTER_UNKNOWN {
+		t.Errorf("Seconds_Behind_Master=[%v], want unknown", status.Seconds_Behind_Master)
+	}
+	if status.Channel_Name != "ch1" {
+		t.Errorf("Channel_Name=[%v], want ch1", status.Channel_Name)
+	}
+}
+
+func TestParseSlaveStatusBadNumber(t *testing.T) {
+	row := newStatusRow("Master_Port", "abc")
+	if _, err := parseSlaveStatus(row); nil == err {
+		t.Errorf("parseSlaveStatus should fail on bad Master_Port")
+	}
+}
+
+func TestParseMasterStatusFDB(t *testing.T) {
+	row := newStatusRow(
+		"File", "mysql-bin.000010",
+		"Position", "4567",
+		"Binlog_Do_DB", "",
+		"Binlog_Ignore_DB", "",
+		"Executed_Gtid_Set", "uuid-1:1-100",
+		"Xa_Cid", "12",
+	)
+	status, err := parseMasterStatus(row)
+	if nil != err {
+		t.Fatalf("parseMasterStatus fail. err=[%v]", err)
+	}
+	if status.File != "mysql-bin.000010" || status.Position != 4567 || status.Executed_Gtid_Set != "uuid-1:1-100" {
+		t.Errorf("unexpected master status. status=[%+v]", status)
+	}
+}
+
+func TestQueryStatusContext(t *testing.T) {
+	pool, server := newFakePool(t, map[string]fakeResult{
+		"SHOW SLAVE STATUS": {
+			columns: []string{"Master_Host", "Master_Port", "Channel_Name"},
+			rows:    [][]driver.Value{{"10.0.0.1", "3306", ""}},
+		},
+		"SHOW MASTER STATUS": {columns: []string{"File", "Position"}, rows: [][]driver.Value{{"mysql-bin.000001", "4"}}},
+	})
+	status, err := pool.QuerySlaveStatusContext(context.Background(), nil)
+	if nil != err || "10.0.0.1" != status.Master_Host {
+		t.Fatalf("QuerySlaveStatusContext fail. status=[%+v] err=[%v]", status, err)
+	}
+
+	// 已取消的ctx不再发送查询
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	executed := len(server.executedSQL())
+	if _, err = pool.QuerySlaveStatusContext(ctx, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("QuerySlaveStatusContext should return ctx error. err=[%v]", err)
+	}
+	if _, err = pool.QueryMasterStatusContext(ctx, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("QueryMasterStatusContext should return ctx error. err=[%v]", err)
+	}
+	if executed != len(server.executedSQL()) {
+		t.Errorf("cancelled query should not be sent. executed=[%v]", server.executedSQL())
+	}
+}
@@ -0,0 +1,278 @@
+package mysql
+
+/*
+ * MySQL错误分类及重试
+ * 1、ClassifyError按*mysql.MySQLError的错误码及驱动错误区分：可重试、连接、主键冲突、语法、权限错误
+ * 2、RetryPolicy提供指数退避加随机抖动的重试，需调用方显式使用
+ *    - 可重试错误(死锁、锁等待超时)：语句未生效或事务已回滚，总是重试
+ *    - 连接错误：无法确定语句是否已执行，仅对幂等语句重试
+ *    - 事务提交时的连接错误无法确定是否已提交，不重试
+ *
+ * Demo：
+ *	err := pool.TrxWithRetry(ctx, DefaultRetryPolicy, nil, func(trx *sql.Tx) error {
+ *		_, err := pool.DBExecContext(ctx, trx, "update t set n = n + 1 where id = ?", id)
+ *		return err
+ *	})
+ */
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"go-tools/log"
+	"math/rand"
+	"net"
+	"strings"
+	"time"
+
+	mysqlDriver "github.com/go-sql-driver/mysql"
+)
+
+// 错误分类
+type ErrorClass int
+
+const (
+	// 无错误
+	ErrClass_None ErrorClass = iota
+	// 死锁、锁等待超时等重试即可恢复的错误
+	ErrClass_Retryable
+	// 连接断开、服务端不可用
+	ErrClass_Connection
+	// 主键或唯一键冲突
+	ErrClass_Duplicate
+	// SQL语法错误
+	ErrClass_Syntax
+	// 权限不足或认证失败
+	ErrClass_Permission
+	// 其他错误
+	ErrClass_Other
+)
+
+func (c ErrorClass) String() string {
+	switch c {
+	case ErrClass_None:
+		return "none"
+	case ErrClass_Retryable:
+		return "retryable"
+	case ErrClass_Connection:
+		return "connection"
+	case ErrClass_Duplicate:
+		return "duplicate"
+	case ErrClass_Syntax:
+		return "syntax"
+	case ErrClass_Permission:
+		return "permission"
+	case ErrClass_Other:
+		return "other"
+	}
+	return fmt.Sprintf("unknown(%d)", int(c))
+}
+
+// MySQL错误码与分类的对应关系
+var mysqlErrorClasses = map[uint16]ErrorClass{
+	ER_LOCK_WAIT_TIMEOUT:     ErrClass_Retryable,
+	ER_LOCK_DEADLOCK:         ErrClass_Retryable,
+	ER_CON_COUNT_ERROR:       ErrClass_Connection,
+	ER_SERVER_SHUTDOWN:       ErrClass_Connection,
+	ER_NET_READ_ERROR:        ErrClass_Connection,
+	ER_NET_READ_INTERRUPTED:  ErrClass_Connection,
+	ER_NET_ERROR_ON_WRITE:    ErrClass_Connection,
+	ER_NET_WRITE_INTERRUPTED: ErrClass_Connection,
+	CR_SERVER_GONE_ERROR:     ErrClass_Connection,
+	CR_SERVER_LOST:           ErrClass_Connection,
+	ER_DUP_ENTRY:             ErrClass_Duplicate,
+	ER_DUP_ENTRY_WITH_KEY:    ErrClass_Duplicate,
+	ER_PARSE_ERROR:           ErrClass_Syntax,
+	ER_SYNTAX_ERROR:          ErrClass_Syntax,
+	ER_DBACCESS_DENIED:       ErrClass_Permission,
+	ER_ACCESS_DENIED:         ErrClass_Permission,
+	ER_TABLEACCESS_DENIED:    ErrClass_Permission,
+	ER_COLUMNACCESS_DENIED:   ErrClass_Permission,
+	ER_SPECIFIC_ACCESS:       ErrClass_Permission,
+	ER_PROCACCESS_DENIED:     ErrClass_Permission,
+}
+
+// 判断err是否为指定错误码的MySQL服务端错误
+func isMySQLError(err error, number uint16) bool {
+	var mysqlErr *mysqlDriver.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == number
+	}
+	return false
+}
+
+// 对错误进行分类
+func ClassifyError(err error) ErrorClass {
+	if nil == err {
+		return ErrClass_None
+	}
+	var mysqlErr *mysqlDriver.MySQLError
+	if errors.As(err, &mysqlErr) {
+		if class, ok := mysqlErrorClasses[mysqlErr.Number]; ok {
+			return class
+		}
+		return ErrClass_Other
+	}
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, mysqlDriver.ErrInvalidConn) || errors.Is(err, sql.ErrConnDone) {
+		return ErrClass_Connection
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return ErrClass_Connection
+	}
+	if strings.Contains(strings.ToLower(err.Error()), "gone away") {
+		return ErrClass_Connection
+	}
+	return ErrClass_Other
+}
+
+// 是否为死锁、锁等待超时等可直接重试的错误
+func IsRetryableError(err error) bool {
+	return ErrClass_Retryable == ClassifyError(err)
+}
+
+// 是否为连接错误
+func IsConnectionError(err error) bool {
+	return ErrClass_Connection == ClassifyError(err)
+}
+
+// 是否为主键或唯一键冲突
+func IsDuplicateError(err error) bool {
+	return ErrClass_Duplicate == ClassifyError(err)
+}
+
+// 重试策略，第n次重试前等待BaseDelay*2^(n-1)，不超过MaxDelay，并增加±Jitter比例的随机抖动
+type RetryPolicy struct {
+	MaxAttempts int           // 最多执行次数，包含第一次，<=1时不重试
+	BaseDelay   time.Duration // 第一次重试前的等待时间
+	MaxDelay    time.Duration // 等待时间上限，<=0时不设上限
+	Jitter      float64       // 随机抖动比例，取值[0, 1]
+}
+
+// 默认重试策略
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   50 * time.Millisecond,
+	MaxDelay:    2 * time.Second,
+	Jitter:      0.2,
+}
+
+// 第attempt次重试前的等待时间，attempt从1开始
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	if attempt < 1 || p.BaseDelay <= 0 {
+		return 0
+	}
+	delay := p.BaseDelay
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if p.MaxDelay > 0 && delay >= p.MaxDelay {
+			delay = p.MaxDelay
+			break
+		}
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if p.Jitter > 0 {
+		jitter := p.Jitter
+		if jitter > 1 {
+			jitter = 1
+		}
+		delay = time.Duration(float64(delay) * (1 - jitter + 2*jitter*rand.Float64()))
+	}
+	return delay
+}
+
+/*
+ * 执行fn，失败且可以重试时按策略等待后重试，返回最后一次的错误
+ * idempotent为true时连接错误也会重试；ctx结束后不再重试
+ */
+func (p RetryPolicy) Do(ctx context.Context, idempotent bool, fn func(attempt int) error) (err error) {
+	for attempt := 1; ; attempt++ {
+		err = fn(attempt)
+		if nil == err {
+			return nil
+		}
+		class := ClassifyError(err)
+		retryable := ErrClass_Retryable == class || (idempotent && ErrClass_Connection == class)
+		if !retryable || attempt >= p.MaxAttempts {
+			return err
+		}
+		delay := p.Backoff(attempt)
+		log.Log.Warning("Retry after transient error. attempt=[%v] class=[%v] delay=[%v] reason=[%v]",
+			attempt, class, delay, err)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+/*
+ * 在连接池上查询，失败时按策略重试，查询语句视为幂等
+ * 只重试获取结果集之前的错误，读取结果集过程中的错误由调用方处理
+ */
+func (db *DBPool) QueryWithRetry(ctx context.Context, policy RetryPolicy, sqlText string, params ...interface{}) (res *QueryResult, err error) {
+	err = policy.Do(ctx, true, func(attempt int) error {
+		res, err = db.DBQueryContext(ctx, nil, sqlText, params...)
+		if nil != err {
+			res.Close()
+		}
+		return err
+	})
+	return res, err
+}
+
+/*
+ * 在连接池上执行ddl或dml语句，失败时按策略重试
+ * idempotent为true表示语句可重复执行(如按主键的UPDATE ... SET col = 常量)，此时连接错误也会重试
+ */
+func (db *DBPool) ExecWithRetry(ctx context.Context, policy RetryPolicy, idempotent bool,
+	sqlText string, params ...interface{}) (res *QueryResult, err error) {
+
+	err = policy.Do(ctx, idempotent, func(attempt int) error {
+		res, err = db.DBExecContext(ctx, nil, sqlText, params...)
+		return err
+	})
+	return res, err
+}
+
+/*
+ * 在事务中执行fn并提交，fn返回错误时回滚，整个事务失败且可以重试时按策略重新执行
+ * fn可能被执行多次，不能包含事务外的副作用；opts为nil时使用REPEATABLE READ
+ */
+func (db *DBPool) TrxWithRetry(ctx context.Context, policy RetryPolicy, opts *sql.TxOptions,
+	fn func(trx *sql.Tx) error) error {
+
+	if nil == opts {
+		opts = &sql.TxOptions{Isolation: sql.LevelRepeatableRead}
+	}
+	var commitErr error
+	err := policy.Do(ctx, true, func(attempt int) error {
+		commitErr = nil
+		trx, err := db.BeginTx(ctx, opts)
+		if nil != err {
+			return err
+		}
+		if err = fn(trx); nil != err {
+			if rollbackErr := trx.Rollback(); nil != rollbackErr && !errors.Is(rollbackErr, sql.ErrTxDone) {
+				log.Log.Warning("Fail to rollback trx. reason=[%v]", rollbackErr)
+			}
+			return err
+		}
+		if err = trx.Commit(); nil != err && IsConnectionError(err) {
+			// 无法确定是否已提交，不重试
+			commitErr = err
+			return nil
+		}
+		return err
+	})
+	if nil != commitErr {
+		return fmt.Errorf("Commit trx with unknown result. reason=[%w]", commitErr)
+	}
+	return err
+}
@@ -0,0 +1,149 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	mysqlDriver "github.com/go-sql-driver/mysql"
+)
+
+// 不等待的重试策略
+var testRetryPolicy = RetryPolicy{MaxAttempts: 3}
+
+func TestClassifyError(t *testing.T) {
+	cases := []struct {
+		err  error
+		want ErrorClass
+	}{
+		{nil, ErrClass_None},
+		{&mysqlDriver.MySQLError{Number: ER_LOCK_DEADLOCK}, ErrClass_Retryable},
+		{fmt.Errorf("wrapped. reason=[%w]", &mysqlDriver.MySQLError{Number: ER_LOCK_WAIT_TIMEOUT}), ErrClass_Retryable},
+		{driver.ErrBadConn, ErrClass_Connection},
+		{mysqlDriver.ErrInvalidConn, ErrClass_Connection},
+		{errors.New("MySQL server has gone away"), ErrClass_Connection},
+		{&mysqlDriver.MySQLError{Number: ER_DUP_ENTRY}, ErrClass_Duplicate},
+		// 重复的索引名(ER_DUP_KEYNAME)是DDL错误，不是唯一键冲突
+		{&mysqlDriver.MySQLError{Number: 1061}, ErrClass_Other},
+		{&mysqlDriver.MySQLError{Number: ER_PARSE_ERROR}, ErrClass_Syntax},
+		{&mysqlDriver.MySQLError{Number: ER_TABLEACCESS_DENIED}, ErrClass_Permission},
+		{&mysqlDriver.MySQLError{Number: 1146}, ErrClass_Other},
+		{errors.New("unknown"), ErrClass_Other},
+	}
+	for _, c := range cases {
+		if got := ClassifyError(c.err); got != c.want {
+			t.Errorf("ClassifyError(%v)=%v, want %v", c.err, got, c.want)
+		}
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 5, BaseDelay: 10 * time.Millisecond, MaxDelay: 30 * time.Millisecond}
+	want := []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 30 * time.Millisecond, 30 * time.Millisecond}
+	for i, w := range want {
+		if got := policy.Backoff(i + 1); got != w {
+			t.Errorf("Backoff(%v)=%v, want %v", i+1, got, w)
+		}
+	}
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if got := policy.Backoff(1); got < 5*time.Millisecond || got > 15*time.Millisecond {
+			t.Fatalf("Backoff with jitter out of range. delay=[%v]", got)
+		}
+	}
+}
+
+func TestRetryDo(t *testing.T) {
+	deadlock := &mysqlDriver.MySQLError{Number: ER_LOCK_DEADLOCK}
+	cases := []struct {
+		name       string
+		err        error
+		idempotent bool
+		want       int
+	}{
+		{"deadlock", deadlock, false, 3},
+		{"connection not idempotent", mysqlDriver.ErrInvalidConn, false, 1},
+		{"connection idempotent", mysqlDriver.ErrInvalidConn, true, 3},
+		{"duplicate", &mysqlDriver.MySQLError{Number: ER_DUP_ENTRY}, true, 1},
+	}
+	for _, c := range cases {
+		attempts := 0
+		err := testRetryPolicy.Do(context.Background(), c.idempotent, func(attempt int) error {
+			attempts = attempt
+			return c.err
+		})
+		if err != c.err || attempts != c.want {
+			t.Errorf("%v: attempts=[%v] err=[%v], want %v attempts", c.name, attempts, err, c.want)
+		}
+	}
+
+	// ctx结束后不再重试
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	attempts := 0
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Hour}
+	policy.Do(ctx, true, func(attempt int) error {
+		attempts = attempt
+		return deadlock
+	})
+	if 1 != attempts {
+		t.Errorf("retry should stop after ctx is done. attempts=[%v]", attempts)
+	}
+}
+
+func TestExecWithRetry(t *testing.T) {
+	pool, server := newFakePool(t, map[string]fakeResult{
+		"update a": {err: &mysqlDriver.MySQLError{Number: ER_LOCK_DEADLOCK}},
+		"insert a": {err: &mysqlDriver.MySQLError{Number: ER_DUP_ENTRY}},
+		"select a": {err: mysqlDriver.ErrInvalidConn},
+	})
+	ctx := context.Background()
+	if _, err := pool.ExecWithRetry(ctx, testRetryPolicy, false, "update a"); !IsRetryableError(err) {
+		t.Errorf("ExecWithRetry err=[%v], want deadlock", err)
+	}
+	if _, err := pool.ExecWithRetry(ctx, testRetryPolicy, false, "insert a"); !IsDuplicateError(err) {
+		t.Errorf("ExecWithRetry err=[%v], want duplicate", err)
+	}
+	if _, err := pool.QueryWithRetry(ctx, testRetryPolicy, "select a"); !IsConnectionError(err) {
+		t.Errorf("QueryWithRetry err=[%v], want connection error", err)
+	}
+	counts := map[string]int{}
+	for _, query := range server.executedSQL() {
+		counts[query]++
+	}
+	if 3 != counts["update a"] || 1 != counts["insert a"] || 3 != counts["select a"] {
+		t.Errorf("unexpected attempts. executed=[%v]", counts)
+	}
+	if 0 != server.openRows() {
+		t.Errorf("rows are not closed. open=[%v]", server.openRows())
+	}
+}
+
+func TestTrxWithRetry(t *testing.T) {
+	pool, _ := newFakePool(t, map[string]fakeResult{})
+	calls := 0
+	err := pool.TrxWithRetry(context.Background(), testRetryPolicy, nil, func(trx *sql.Tx) error {
+		calls++
+		if 1 == calls {
+			return &mysqlDriver.MySQLError{Number: ER_LOCK_DEADLOCK}
+		}
+		return nil
+	})
+	if nil != err || 2 != calls {
+		t.Errorf("TrxWithRetry calls=[%v] err=[%v], want 2 calls", calls, err)
+	}
+
+	calls = 0
+	syntaxErr := &mysqlDriver.MySQLError{Number: ER_PARSE_ERROR}
+	err = pool.TrxWithRetry(context.Background(), testRetryPolicy, nil, func(trx *sql.Tx) error {
+		calls++
+		return syntaxErr
+	})
+	if err != syntaxErr || 1 != calls {
+		t.Errorf("TrxWithRetry calls=[%v] err=[%v], want no retry", calls, err)
+	}
+}
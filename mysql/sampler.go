@@ -0,0 +1,250 @@
+package mysql
+
+/*
+ * 状态计数器采样
+ * 1、周期执行SHOW GLOBAL STATUS，与上一次快照比较得到各计数器的增量及每秒速率
+ * 2、Uptime变小时判定为实例重启，增量按重启后的累计值计算；单个计数器变小(如FLUSH STATUS)同样处理
+ *   Threads_running、Open_tables等瞬时值(statusGauges)及上一次快照中不存在的计数器不计算增量
+ * 3、StatusSummary给出QPS、TPS、运行线程数、Buffer Pool命中率及复制延迟
+ *
+ * Demo：
+ *	sampler := NewStatusSampler(pool)
+ *	sampler.Replication = true
+ *	go sampler.Run(ctx, 10*time.Second, func(delta *StatusDelta) {
+ *		log.Log.Info("qps=[%.1f] tps=[%.1f] lag=[%v]", delta.Summary.QPS, delta.Summary.TPS, delta.Summary.ReplicationLag)
+ *	})
+ */
+import (
+	"context"
+	"fmt"
+	"go-tools/log"
+	"sync"
+	"time"
+)
+
+// 状态汇总
+type StatusSummary struct {
+	QPS                float64 // Questions每秒增量
+	TPS                float64 // Com_commit+Com_rollback每秒增量
+	ThreadsRunning     int64   // 采样时的Threads_running
+	ThreadsConnected   int64   // 采样时的Threads_connected
+	BufferPoolHitRatio float64 // 区间内Buffer Pool读命中率，区间内没有逻辑读时为-1
+	IsReplica          bool    // 是否为从库，仅开启Replication时有效
+	ReplicationLag     int32   // Seconds_Behind_Master，非从库或未知时为SECONDS_BEHIND_MASTER_UNKNOWN
+}
+
+// 两次采样之间的增量
+type StatusDelta struct {
+	Start    time.Time
+	End      time.Time
+	Interval time.Duration      // 计算速率使用的区间，重启时为重启后的运行时间
+	Restart  bool               // 区间内实例是否重启
+	Deltas   map[string]uint64  // 计数器增量，不含瞬时值
+	Rates    map[string]float64 // 计数器每秒增量
+	Summary  StatusSummary
+}
+
+// 瞬时值状态，不是单调递增的计数器，不计算增量及速率
+var statusGauges = map[string]bool{
+	"Threads_running":                        true,
+	"Threads_connected":                      true,
+	"Threads_cached":                         true,
+	"Max_used_connections":                   true,
+	"Open_files":                             true,
+	"Open_streams":                           true,
+	"Open_tables":                            true,
+	"Open_table_definitions":                 true,
+	"Prepared_stmt_count":                    true,
+	"Slave_open_temp_tables":                 true,
+	"Replica_open_temp_tables":               true,
+	"Key_blocks_not_flushed":                 true,
+	"Key_blocks_unused":                      true,
+	"Key_blocks_used":                        true,
+	"Qcache_free_blocks":                     true,
+	"Qcache_free_memory":                     true,
+	"Qcache_queries_in_cache":                true,
+	"Qcache_total_blocks":                    true,
+	"Innodb_buffer_pool_bytes_data":          true,
+	"Innodb_buffer_pool_bytes_dirty":         true,
+	"Innodb_buffer_pool_pages_data":          true,
+	"Innodb_buffer_pool_pages_dirty":         true,
+	"Innodb_buffer_pool_pages_free":          true,
+	"Innodb_buffer_pool_pages_latched":       true,
+	"Innodb_buffer_pool_pages_misc":          true,
+	"Innodb_buffer_pool_pages_total":         true,
+	"Innodb_data_pending_fsyncs":             true,
+	"Innodb_data_pending_reads":              true,
+	"Innodb_data_pending_writes":             true,
+	"Innodb_os_log_pending_fsyncs":           true,
+	"Innodb_os_log_pending_writes":           true,
+	"Innodb_num_open_files":                  true,
+	"Innodb_page_size":                       true,
+	"Innodb_row_lock_current_waits":          true,
+	"Innodb_row_lock_time_avg":               true,
+	"Innodb_row_lock_time_max":               true,
+	"Innodb_undo_tablespaces_active":         true,
+	"Innodb_undo_tablespaces_explicit":       true,
+	"Innodb_undo_tablespaces_implicit":       true,
+	"Innodb_undo_tablespaces_total":          true,
+	"Rpl_semi_sync_master_clients":           true,
+	"Rpl_semi_sync_master_avg_net_wait_time": true,
+	"Rpl_semi_sync_master_avg_tx_wait_time":  true,
+	"Rpl_semi_sync_source_clients":           true,
+	"Tc_log_max_pages_used":                  true,
+	"Tc_log_page_size":                       true,
+}
+
+// 速率，计数器不存在时返回0
+func (d *StatusDelta) Rate(name string) float64 {
+	return d.Rates[name]
+}
+
+// 状态采样器，同一采样器不能并发调用Sample
+type StatusSampler struct {
+	Replication bool // 为true时每次采样同时查询SHOW SLAVE STATUS获取复制延迟
+
+	db     *DBPool
+	lock   sync.Mutex
+	last   *Snapshot
+	latest *StatusDelta
+}
+
+func NewStatusSampler(db *DBPool) *StatusSampler {
+	return &StatusSampler{db: db}
+}
+
+/*
+ * 采样一次，返回与上一次采样之间的增量
+ * 第一次采样只记录快照，返回nil
+ */
+func (s *StatusSampler) Sample() (*StatusDelta, error) {
+	current, err := s.db.ShowSnapshot(nil, Show_Status, Scope_Global)
+	if nil != err {
+		return nil, err
+	}
+	lag := SECONDS_BEHIND_MASTER_UNKNOWN
+	isReplica := false
+	if s.Replication {
+		slaveStatus, err := s.db.QuerySlaveStatus(nil)
+		if nil != err {
+			log.Log.Warning("Fail to sample replication lag. reason=[%v]", err)
+		} else if "" != slaveStatus.Master_Host {
+			isReplica = true
+			lag = slaveStatus.Seconds_Behind_Master
+		}
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	previous := s.last
+	s.last = current
+	if nil == previous {
+		return nil, nil
+	}
+	delta, err := ComputeStatusDelta(previous, current)
+	if nil != err {
+		return nil, err
+	}
+	delta.Summary.IsReplica = isReplica
+	delta.Summary.ReplicationLag = lag
+	s.latest = delta
+	return delta, nil
+}
+
+// 最近一次采样的增量，尚未得到增量时返回nil
+func (s *StatusSampler) Latest() *StatusDelta {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.latest
+}
+
+// 按interval周期采样，得到增量后调用handler，直到ctx被取消
+func (s *StatusSampler) Run(ctx context.Context, interval time.Duration, handler func(delta *StatusDelta)) error {
+	if interval <= 0 {
+		return fmt.Errorf("Invalid status sample interval=[%v]", interval)
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		delta, err := s.Sample()
+		if nil != err {
+			log.Log.Warning("Fail to sample status. reason=[%v]", err)
+		} else if nil != delta && nil != handler {
+			handler(delta)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+/*
+ * 计算两次快照之间的增量
+ * 非数字的状态、瞬时值及previous中不存在的计数器忽略，Uptime变小时判定为重启
+ */
+func ComputeStatusDelta(previous *Snapshot, current *Snapshot) (*StatusDelta, error) {
+	if !current.Time.After(previous.Time) {
+		return nil, fmt.Errorf("snapshots are out of order. previous=[%v] current=[%v]",
+			previous.Time.Format(log.TIME_FORMAT), current.Time.Format(log.TIME_FORMAT))
+	}
+	delta := &StatusDelta{
+		Start:    previous.Time,
+		End:      current.Time,
+		Interval: current.Time.Sub(previous.Time),
+		Deltas:   make(map[string]uint64, len(current.Values)),
+		Rates:    make(map[string]float64, len(current.Values)),
+	}
+	previousUptime, err1 := previous.Uint("Uptime")
+	currentUptime, err2 := current.Uint("Uptime")
+	if nil == err1 && nil == err2 && currentUptime < previousUptime {
+		delta.Restart = true
+		// 重启后的计数器从0开始，速率按重启后的运行时间计算
+		if uptime := time.Duration(currentUptime) * time.Second; uptime > 0 && uptime < delta.Interval {
+			delta.Interval = uptime
+		}
+	}
+
+	seconds := delta.Interval.Seconds()
+	for name := range current.Values {
+		if statusGauges[name] {
+			continue
+		}
+		value, err := current.Uint(name)
+		if nil != err {
+			continue
+		}
+		// 新出现的计数器(如新加载的插件)无法确定区间内的增量
+		old, err := previous.Uint(name)
+		if nil != err {
+			continue
+		}
+		var diff uint64
+		switch {
+		case delta.Restart || value < old:
+			diff = value
+		default:
+			diff = value - old
+		}
+		delta.Deltas[name] = diff
+		delta.Rates[name] = float64(diff) / seconds
+	}
+
+	delta.Summary = StatusSummary{
+		QPS:                delta.Rates["Questions"],
+		TPS:                delta.Rates["Com_commit"] + delta.Rates["Com_rollback"],
+		BufferPoolHitRatio: -1,
+		ReplicationLag:     SECONDS_BEHIND_MASTER_UNKNOWN,
+	}
+	delta.Summary.ThreadsRunning, _ = current.Int("Threads_running")
+	delta.Summary.ThreadsConnected, _ = current.Int("Threads_connected")
+	if requests := delta.Deltas["Innodb_buffer_pool_read_requests"]; requests > 0 {
+		reads := delta.Deltas["Innodb_buffer_pool_reads"]
+		if reads > requests {
+			reads = requests
+		}
+		delta.Summary.BufferPoolHitRatio = 1 - float64(reads)/float64(requests)
+	}
+	return delta, nil
+}
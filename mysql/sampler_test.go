@@ -0,0 +1,104 @@
+package mysql
+
+import (
+	"database/sql/driver"
+	"math"
+	"testing"
+	"time"
+)
+
+func statusSnapshot(at time.Time, values map[string]string) *Snapshot {
+	snapshot := NewSnapshot(Show_Status, Scope_Global, values)
+	snapshot.Time = at
+	return snapshot
+}
+
+func TestComputeStatusDelta(t *testing.T) {
+	start := time.Now()
+	previous := statusSnapshot(start, map[string]string{
+		"Uptime": "100", "Questions": "1000", "Com_commit": "50", "Com_rollback": "10",
+		"Innodb_buffer_pool_read_requests": "10000", "Innodb_buffer_pool_reads": "100",
+		"Threads_running": "8", "Innodb_buffer_pool_dump_status": "not started",
+	})
+	current := statusSnapshot(start.Add(10*time.Second), map[string]string{
+		"Uptime": "110", "Questions": "3000", "Com_commit": "150", "Com_rollback": "10",
+		"Innodb_buffer_pool_read_requests": "20000", "Innodb_buffer_pool_reads": "200",
+		"Threads_running": "3", "Threads_connected": "20", "Innodb_buffer_pool_dump_status": "not started",
+		"Com_select": "500",
+	})
+	delta, err := ComputeStatusDelta(previous, current)
+	if nil != err {
+		t.Fatalf("ComputeStatusDelta fail. err=[%v]", err)
+	}
+	summary := delta.Summary
+	if delta.Restart || 200 != summary.QPS || 10 != summary.TPS || 3 != summary.ThreadsRunning || 20 != summary.ThreadsConnected {
+		t.Errorf("unexpected summary. delta=[%+v]", delta)
+	}
+	if math.Abs(summary.BufferPoolHitRatio-0.99) > 1e-9 {
+		t.Errorf("unexpected hit ratio. ratio=[%v]", summary.BufferPoolHitRatio)
+	}
+	if _, ok := delta.Deltas["Innodb_buffer_pool_dump_status"]; ok {
+		t.Errorf("non numeric status should be ignored")
+	}
+	// 瞬时值及上一次快照中不存在的计数器不计算增量
+	for _, name := range []string{"Threads_running", "Threads_connected", "Com_select"} {
+		if _, ok := delta.Rates[name]; ok {
+			t.Errorf("status should have no delta. name=[%v] delta=[%v]", name, delta.Deltas[name])
+		}
+	}
+
+	// 重启后Uptime变小，增量为重启后的累计值
+	restarted := statusSnapshot(start.Add(20*time.Second), map[string]string{
+		"Uptime": "4", "Questions": "40", "Com_commit": "8", "Com_rollback": "0",
+	})
+	delta, err = ComputeStatusDelta(current, restarted)
+	if nil != err {
+		t.Fatalf("ComputeStatusDelta fail. err=[%v]", err)
+	}
+	if !delta.Restart || 4*time.Second != delta.Interval || 40 != delta.Deltas["Questions"] || 10 != delta.Summary.QPS {
+		t.Errorf("unexpected delta after restart. delta=[%+v]", delta)
+	}
+	if -1 != delta.Summary.BufferPoolHitRatio {
+		t.Errorf("hit ratio should be unknown. ratio=[%v]", delta.Summary.BufferPoolHitRatio)
+	}
+
+	if _, err = ComputeStatusDelta(restarted, current); nil == err {
+		t.Errorf("out of order snapshots should be rejected")
+	}
+}
+
+func TestStatusSampler(t *testing.T) {
+	status := func(questions string) fakeResult {
+		return fakeResult{
+			columns: []string{"Variable_name", "Value"},
+			rows:    [][]driver.Value{{"Uptime", "100"}, {"Questions", questions}},
+		}
+	}
+	pool, server := newFakePool(t, map[string]fakeResult{
+		"SHOW GLOBAL STATUS": status("100"),
+		"SHOW SLAVE STATUS": {
+			columns: []string{"Master_Host", "Seconds_Behind_Master", "Channel_Name"},
+			rows:    [][]driver.Value{{"10.0.0.1", int64(7), ""}},
+		},
+	})
+	sampler := NewStatusSampler(pool)
+	sampler.Replication = true
+	if delta, err := sampler.Sample(); nil != err || nil != delta {
+		t.Fatalf("first sample should only record snapshot. delta=[%+v] err=[%v]", delta, err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	server.setResult("SHOW GLOBAL STATUS", status("150"))
+	delta, err := sampler.Sample()
+	if nil != err || nil == delta {
+		t.Fatalf("second sample fail. err=[%v]", err)
+	}
+	if 50 != delta.Deltas["Questions"] || delta.Rate("Questions") <= 0 {
+		t.Errorf("unexpected delta. delta=[%+v]", delta)
+	}
+	if !delta.Summary.IsReplica || 7 != delta.Summary.ReplicationLag {
+		t.Errorf("unexpected replication summary. summary=[%+v]", delta.Summary)
+	}
+	if sampler.Latest() != delta {
+		t.Errorf("Latest should return the last delta")
+	}
+}
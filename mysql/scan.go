@@ -0,0 +1,240 @@
+package mysql
+
+/*
+ * 查询结果按列名映射到结构体
+ * 1、字段通过db标签匹配列名，未设置标签时按字段名大小写不敏感匹配，db:"-"的字段忽略
+ * 2、可能为NULL的列需使用指针或sql.Null*类型的字段接收
+ * 3、结果集中的列找不到对应字段、结构体字段找不到对应列时均返回错误
+ * 4、无论成功与否，都会关闭QueryResult，关闭时提升为错误的warning同样会返回
+ *
+ * Demo：
+ *	type instance struct {
+ *		Id              int64
+ *		Ip              string
+ *		ExecutedGtidSet *string `db:"executed_gtid_set"`
+ *	}
+ *	res, err := pool.DBQuery(nil, nil, 3, "select id, ip, executed_gtid_set from db_instances")
+ *	if nil != err {
+ *		return err
+ *	}
+ *	instances, err := ScanAll[instance](res)
+ */
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// 结构体的列名与字段位置映射，按类型缓存
+var structFieldsCache sync.Map
+
+// 将第一行映射为T，结果集为空时返回sql.ErrNoRows
+func ScanOne[T any](res *QueryResult) (result T, err error) {
+	defer closeResult(res, &err)
+	rows, err := resultRows(res)
+	if nil != err {
+		return result, err
+	}
+	scanner, err := newStructScanner(rows, reflect.TypeOf(result))
+	if nil != err {
+		return result, err
+	}
+	if !rows.Next() {
+		if err = rows.Err(); nil != err {
+			return result, err
+		}
+		return result, sql.ErrNoRows
+	}
+	if err = scanner.scan(rows, reflect.ValueOf(&result).Elem()); nil != err {
+		return result, err
+	}
+	return result, rows.Err()
+}
+
+// 将所有行映射为[]T
+func ScanAll[T any](res *QueryResult) (results []T, err error) {
+	defer closeResult(res, &err)
+	rows, err := resultRows(res)
+	if nil != err {
+		return nil, err
+	}
+	var result T
+	scanner, err := newStructScanner(rows, reflect.TypeOf(result))
+	if nil != err {
+		return nil, err
+	}
+	for rows.Next() {
+		var result T
+		if err = scanner.scan(rows, reflect.ValueOf(&result).Elem()); nil != err {
+			return results, err
+		}
+		results = append(results, result)
+	}
+	return results, rows.Err()
+}
+
+// 将所有行映射为map，key为列名，NULL为nil，[]byte转换为string
+func ScanMap(res *QueryResult) (results []map[string]interface{}, err error) {
+	defer closeResult(res, &err)
+	rows, err := resultRows(res)
+	if nil != err {
+		return nil, err
+	}
+	columns, err := rows.Columns()
+	if nil != err {
+		return nil, err
+	}
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		dest := make([]interface{}, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err = rows.Scan(dest...); nil != err {
+			return results, err
+		}
+		result := make(map[string]interface{}, len(columns))
+		for i, column := range columns {
+			if raw, ok := values[i].([]byte); ok {
+				result[column] = string(raw)
+			} else {
+				result[column] = values[i]
+			}
+		}
+		results = append(results, result)
+	}
+	return results, rows.Err()
+}
+
+// 关闭QueryResult，err为nil时返回关闭过程中写入res.Error的错误(如提升为错误的warning)
+func closeResult(res *QueryResult, err *error) {
+	res.Close()
+	if nil == *err && nil != res && nil != res.Error {
+		*err = res.Error
+	}
+}
+
+// 校验QueryResult并返回其中的Rows
+func resultRows(res *QueryResult) (*Rows, error) {
+	if nil == res {
+		return nil, errors.New("QueryResult is nil")
+	}
+	if nil != res.Error {
+		return nil, res.Error
+	}
+	if nil == res.Rows {
+		return nil, errors.New("No result for query. rows is nil")
+	}
+	return res.Rows, nil
+}
+
+// 结果集列与结构体字段的对应关系
+type structScanner struct {
+	structType reflect.Type
+	indexes    [][]int // 第i列对应的字段位置
+}
+
+// 根据结果集的列生成映射，列与字段无法一一对应时返回错误
+func newStructScanner(rows *Rows, t reflect.Type) (*structScanner, error) {
+	if nil == t || t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("Scan target must be a struct. type=[%v]", t)
+	}
+	columns, err := rows.Columns()
+	if nil != err {
+		return nil, err
+	}
+	fields, err := structFields(t)
+	if nil != err {
+		return nil, err
+	}
+	scanner := &structScanner{structType: t, indexes: make([][]int, len(columns))}
+	matched := make(map[string]bool, len(columns))
+	for i, column := range columns {
+		key := strings.ToLower(column)
+		index, ok := fields[key]
+		if !ok {
+			return nil, fmt.Errorf("Column=[%v] has no matched field in type=[%v]", column, t)
+		}
+		if matched[key] {
+			return nil, fmt.Errorf("Column=[%v] is duplicated in result", column)
+		}
+		matched[key] = true
+		scanner.indexes[i] = index
+	}
+	var unmatched []string
+	for key := range fields {
+		if !matched[key] {
+			unmatched = append(unmatched, key)
+		}
+	}
+	if len(unmatched) > 0 {
+		sort.Strings(unmatched)
+		return nil, fmt.Errorf("Fields for columns=[%v] in type=[%v] have no matched column", unmatched, t)
+	}
+	return scanner, nil
+}
+
+// 将当前行赋值到value
+func (s *structScanner) scan(rows *Rows, value reflect.Value) error {
+	dest := make([]interface{}, len(s.indexes))
+	for i, index := range s.indexes {
+		dest[i] = value.FieldByIndex(index).Addr().Interface()
+	}
+	if err := rows.Scan(dest...); nil != err {
+		return fmt.Errorf("Scan into type=[%v] fail. reason=[%v]", s.structType, err)
+	}
+	return nil
+}
+
+// 解析结构体的列名(小写)与字段位置，支持匿名嵌入结构体
+func structFields(t reflect.Type) (map[string][]int, error) {
+	if cached, ok := structFieldsCache.Load(t); ok {
+		return cached.(map[string][]int), nil
+	}
+	fields := make(map[string][]int)
+	if err := collectStructFields(t, nil, fields); nil != err {
+		return nil, err
+	}
+	structFieldsCache.Store(t, fields)
+	return fields, nil
+}
+
+func collectStructFields(t reflect.Type, parent []int, fields map[string][]int) error {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		index := append(append([]int(nil), parent...), i)
+		tag := field.Tag.Get("db")
+		if "-" == tag {
+			continue
+		}
+		// 未设置标签的匿名结构体展开处理
+		if field.Anonymous && "" == tag && field.Type.Kind() == reflect.Struct && !isScanner(field.Type) {
+			if err := collectStructFields(field.Type, index, fields); nil != err {
+				return err
+			}
+			continue
+		}
+		if "" != field.PkgPath {
+			continue
+		}
+		name := tag
+		if "" == name {
+			name = field.Name
+		}
+		key := strings.ToLower(name)
+		if _, ok := fields[key]; ok {
+			return fmt.Errorf("Column=[%v] is mapped by more than one field in type=[%v]", name, t)
+		}
+		fields[key] = index
+	}
+	return nil
+}
+
+// 是否实现了sql.Scanner，如sql.NullString、sql.NullTime
+func isScanner(t reflect.Type) bool {
+	return reflect.PtrTo(t).Implements(reflect.TypeOf((*sql.Scanner)(nil)).Elem())
+}
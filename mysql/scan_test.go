@@ -0,0 +1,134 @@
+package mysql
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"strings"
+	"testing"
+)
+
+type scanBase struct {
+	Id int64
+}
+
+type scanInstance struct {
+	scanBase
+	Ip              string
+	Port            int32          `db:"port"`
+	ExecutedGtidSet *string        `db:"executed_gtid_set"`
+	Comment         sql.NullString `db:"comment"`
+	Ignored         string         `db:"-"`
+}
+
+func newScanPool(t *testing.T) (*DBPool, *fakeServer) {
+	columns := []string{"id", "IP", "port", "executed_gtid_set", "comment"}
+	return newFakePool(t, map[string]fakeResult{
+		"select instances": {columns: columns, rows: [][]driver.Value{
+			{int64(1), "10.0.0.1", int64(3306), "uuid:1-5", nil},
+			{int64(2), "10.0.0.2", int64(3307), nil, "replica"},
+		}},
+		"select empty":          {columns: columns},
+		"select extra column":   {columns: append(columns, "role"), rows: [][]driver.Value{{int64(1), "", int64(1), nil, nil, int64(1)}}},
+		"select missing column": {columns: columns[:4], rows: [][]driver.Value{{int64(1), "", int64(1), nil}}},
+		"select null string":    {columns: []string{"id", "ip", "port", "executed_gtid_set", "comment"}, rows: [][]driver.Value{{int64(1), nil, int64(1), nil, nil}}},
+		"select map":            {columns: []string{"name", "value"}, rows: [][]driver.Value{{[]byte("a"), int64(1)}, {"b", nil}}},
+	})
+}
+
+// 忽略DBQuery返回的err，错误信息保存在QueryResult.Error中
+func fakeQuery(pool *DBPool, sqlText string) *QueryResult {
+	res, _ := pool.DBQuery(nil, nil, 3, sqlText)
+	return res
+}
+
+func TestScanAll(t *testing.T) {
+	pool, server := newScanPool(t)
+	instances, err := ScanAll[scanInstance](fakeQuery(pool, "select instances"))
+	if nil != err {
+		t.Fatalf("ScanAll fail. err=[%v]", err)
+	}
+	if 2 != len(instances) {
+		t.Fatalf("ScanAll returns %v rows, want 2", len(instances))
+	}
+	first, second := instances[0], instances[1]
+	if first.Id != 1 || first.Ip != "10.0.0.1" || first.Port != 3306 {
+		t.Errorf("unexpected first row. row=[%+v]", first)
+	}
+	if nil == first.ExecutedGtidSet || *first.ExecutedGtidSet != "uuid:1-5" || first.Comment.Valid {
+		t.Errorf("unexpected nullable columns in first row. row=[%+v]", first)
+	}
+	if nil != second.ExecutedGtidSet || !second.Comment.Valid || second.Comment.String != "replica" {
+		t.Errorf("unexpected nullable columns in second row. row=[%+v]", second)
+	}
+	if 0 != server.openRows() {
+		t.Errorf("rows are not closed. open=[%v]", server.openRows())
+	}
+}
+
+func TestScanOne(t *testing.T) {
+	pool, server := newScanPool(t)
+	instance, err := ScanOne[scanInstance](fakeQuery(pool, "select instances"))
+	if nil != err || instance.Id != 1 {
+		t.Errorf("ScanOne fail. row=[%+v] err=[%v]", instance, err)
+	}
+	if _, err = ScanOne[scanInstance](fakeQuery(pool, "select empty")); err != sql.ErrNoRows {
+		t.Errorf("ScanOne on empty result returns err=[%v], want sql.ErrNoRows", err)
+	}
+	if 0 != server.openRows() {
+		t.Errorf("rows are not closed. open=[%v]", server.openRows())
+	}
+}
+
+func TestScanMismatch(t *testing.T) {
+	pool, server := newScanPool(t)
+	cases := map[string]string{
+		"select extra column":   "role",
+		"select missing column": "comment",
+		"select null string":    "ip",
+		"select not exists":     "no result",
+	}
+	for query, want := range cases {
+		_, err := ScanAll[scanInstance](fakeQuery(pool, query))
+		if nil == err || !strings.Contains(strings.ToLower(err.Error()), want) {
+			t.Errorf("ScanAll(%v) err=[%v], want error about %v", query, err, want)
+		}
+	}
+	if _, err := ScanAll[int](fakeQuery(pool, "select instances")); nil == err {
+		t.Errorf("ScanAll into non struct should fail")
+	}
+	if 0 != server.openRows() {
+		t.Errorf("rows are not closed. open=[%v]", server.openRows())
+	}
+}
+
+func TestScanMap(t *testing.T) {
+	pool, _ := newScanPool(t)
+	rows, err := ScanMap(fakeQuery(pool, "select map"))
+	if nil != err {
+		t.Fatalf("ScanMap fail. err=[%v]", err)
+	}
+	if 2 != len(rows) || rows[0]["name"] != "a" || rows[0]["value"] != int64(1) || rows[1]["value"] != nil {
+		t.Errorf("unexpected ScanMap result. rows=[%v]", rows)
+	}
+}
+
+func TestRowsReleaseContext(t *testing.T) {
+	pool, _ := newScanPool(t)
+	// 读到末尾时释放
+	res := fakeQuery(pool, "select instances")
+	for res.Rows.Next() {
+		if nil == res.cancel {
+			t.Fatalf("ctx should not be released before rows end")
+		}
+	}
+	if nil != res.cancel {
+		t.Errorf("ctx should be released when rows end")
+	}
+	// 只调用Rows.Close()时释放
+	res = fakeQuery(pool, "select instances")
+	CloseRows(res.Rows)
+	if nil != res.cancel {
+		t.Errorf("ctx should be released when rows are closed")
+	}
+	res.Close()
+}
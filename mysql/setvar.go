@@ -0,0 +1,395 @@
+package mysql
+
+/*
+ * 修改系统变量
+ * 1、变量名必须在SettableVariables白名单中，值按变量类型校验后生成SQL，不拼接任意字符串
+ * 2、支持SESSION、GLOBAL、PERSIST范围，SESSION必须传入*sql.Conn或*sql.Tx
+ * 3、修改前记录原值，VariableBatch.Rollback按相反顺序恢复整批修改
+ *   PERSIST修改同时记录performance_schema.persisted_variables中的原持久化值，恢复时先SET GLOBAL原值，
+ *   再SET PERSIST_ONLY原持久化值，原来未持久化时RESET PERSIST，不遗留持久化的修改
+ * 4、Dangerous的变量(如sql_log_bin、read_only)需要设置Force才能修改
+ *
+ * Demo：
+ *	batch := pool.NewVariableBatch(conn)
+ *	batch.Force = true
+ *	if err := batch.Set(Set_Session, "sql_log_bin", false); nil != err {
+ *		return err
+ *	}
+ *	defer batch.Rollback()
+ *	if err := batch.Set(Set_Global, "long_query_time", 0.5); nil != err {
+ *		return err
+ *	}
+ */
+import (
+	"database/sql"
+	"fmt"
+	"go-tools/log"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// 修改的范围
+type SetScope int
+
+const (
+	Set_Session SetScope = iota
+	Set_Global
+	Set_Persist // MySQL 8.0及以上，同时修改GLOBAL值并持久化
+)
+
+func (s SetScope) String() string {
+	switch s {
+	case Set_Session:
+		return "SESSION"
+	case Set_Global:
+		return "GLOBAL"
+	case Set_Persist:
+		return "PERSIST"
+	}
+	return fmt.Sprintf("SetScope(%d)", int(s))
+}
+
+// 读取原值使用的范围，PERSIST读取GLOBAL值
+func (s SetScope) readScope() string {
+	if Set_Session == s {
+		return "SESSION"
+	}
+	return "GLOBAL"
+}
+
+// 变量值的类型
+type VariableType int
+
+const (
+	Var_Int    VariableType = iota // 非负整数
+	Var_Float                      // 非负小数
+	Var_Bool                       // ON/OFF
+	Var_Enum                       // Enum中的一个值
+	Var_String                     // 任意字符串，不允许反斜杠及控制字符
+)
+
+// 白名单中变量的规则
+type VariableRule struct {
+	Type      VariableType
+	Enum      []string // Type为Var_Enum时允许的值；Type为Var_Int时不为空则限定允许的值，生成的SQL不加引号
+	Dangerous bool     // 修改可能导致数据不一致或不可写，需要Force
+}
+
+// 允许修改的变量，可在初始化时增加
+var SettableVariables = map[string]VariableRule{
+	"autocommit":                     {Type: Var_Bool},
+	"binlog_expire_logs_seconds":     {Type: Var_Int},
+	"binlog_format":                  {Type: Var_Enum, Enum: []string{"ROW", "STATEMENT", "MIXED"}, Dangerous: true},
+	"foreign_key_checks":             {Type: Var_Bool, Dangerous: true},
+	"general_log":                    {Type: Var_Bool},
+	"innodb_buffer_pool_size":        {Type: Var_Int},
+	"innodb_flush_log_at_trx_commit": {Type: Var_Int, Enum: []string{"0", "1", "2"}, Dangerous: true},
+	"innodb_io_capacity":             {Type: Var_Int},
+	"innodb_lock_wait_timeout":       {Type: Var_Int},
+	"interactive_timeout":            {Type: Var_Int},
+	"lock_wait_timeout":              {Type: Var_Int},
+	"long_query_time":                {Type: Var_Float},
+	"max_allowed_packet":             {Type: Var_Int},
+	"max_connections":                {Type: Var_Int},
+	"max_execution_time":             {Type: Var_Int},
+	"read_only":                      {Type: Var_Bool, Dangerous: true},
+	"replica_parallel_workers":       {Type: Var_Int},
+	"rpl_semi_sync_master_enabled":   {Type: Var_Bool, Dangerous: true},
+	"rpl_semi_sync_master_timeout":   {Type: Var_Int},
+	"slave_parallel_workers":         {Type: Var_Int},
+	"slow_query_log":                 {Type: Var_Bool},
+	"sql_log_bin":                    {Type: Var_Bool, Dangerous: true},
+	"sql_mode":                       {Type: Var_String},
+	"super_read_only":                {Type: Var_Bool, Dangerous: true},
+	"sync_binlog":                    {Type: Var_Int, Dangerous: true},
+	"time_zone":                      {Type: Var_String},
+	"transaction_isolation": {Type: Var_Enum,
+		Enum: []string{"READ-UNCOMMITTED", "READ-COMMITTED", "REPEATABLE-READ", "SERIALIZABLE"}},
+	"unique_checks": {Type: Var_Bool, Dangerous: true},
+	"wait_timeout":  {Type: Var_Int},
+}
+
+var (
+	intValuePattern   = regexp.MustCompile(`^[0-9]+$`)
+	floatValuePattern = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?$`)
+)
+
+// 一次变量修改
+type VariableChange struct {
+	Name     string
+	Scope    SetScope
+	Value    string  // 生成的SQL值，字符串已加引号
+	Previous *string // 修改前的值，NULL时为nil
+	// Scope为Set_Persist时修改前持久化的值，未持久化时为nil
+	PreviousPersisted *string
+}
+
+// 一批变量修改，同一批次不能并发使用
+type VariableBatch struct {
+	Force bool // 为true时允许修改Dangerous的变量
+
+	db      *DBPool
+	exec    Executor
+	changes []VariableChange
+}
+
+// 创建修改批次，exec为nil时使用连接池(只能修改GLOBAL及PERSIST)
+func (db *DBPool) NewVariableBatch(exec Executor) *VariableBatch {
+	return &VariableBatch{db: db, exec: exec}
+}
+
+/*
+ * 修改单个变量，返回修改前的值
+ * 不需要回滚时使用，需要回滚时使用VariableBatch
+ */
+func (db *DBPool) SetVariable(exec Executor, scope SetScope, name string, value interface{}, force bool) (previous *string, err error) {
+	batch := db.NewVariableBatch(exec)
+	batch.Force = force
+	if err = batch.Set(scope, name, value); nil != err {
+		return nil, err
+	}
+	return batch.changes[0].Previous, nil
+}
+
+// 已执行的修改，按执行顺序
+func (b *VariableBatch) Changes() []VariableChange {
+	return append([]VariableChange(nil), b.changes...)
+}
+
+// 修改变量，成功后记录到批次中
+func (b *VariableBatch) Set(scope SetScope, name string, value interface{}) error {
+	name = strings.ToLower(strings.TrimSpace(name))
+	rule, err := b.check(scope, name)
+	if nil != err {
+		log.Log.Warning("Fail to set variable. name=[%v] reason=[%v]", name, err)
+		return err
+	}
+	sqlValue, err := formatVariableValue(rule, value)
+	if nil != err {
+		log.Log.Warning("Fail to set variable. name=[%v] reason=[%v]", name, err)
+		return err
+	}
+	previous, err := b.read(scope, name)
+	if nil != err {
+		log.Log.Warning("Fail to read variable before set. name=[%v] reason=[%v]", name, err)
+		return err
+	}
+	var persisted *string
+	if Set_Persist == scope {
+		if persisted, err = b.readPersisted(name); nil != err {
+			log.Log.Warning("Fail to read persisted variable before set. name=[%v] reason=[%v]", name, err)
+			return err
+		}
+	}
+	if err = b.apply(scope, name, sqlValue); nil != err {
+		return err
+	}
+	b.changes = append(b.changes, VariableChange{Name: name, Scope: scope, Value: sqlValue,
+		Previous: previous, PreviousPersisted: persisted})
+	log.Log.Info("Set variable. scope=[%v] name=[%v] value=[%v] previous=[%v] persisted=[%v]",
+		scope, name, sqlValue, stringOrNull(previous), stringOrNull(persisted))
+	return nil
+}
+
+/*
+ * 按相反顺序恢复批次中的所有修改
+ * 单个变量恢复失败时继续恢复其他变量，返回第一个错误；恢复成功的修改从批次中移除
+ */
+func (b *VariableBatch) Rollback() error {
+	var firstErr error
+	var failed []VariableChange
+	for i := len(b.changes) - 1; i >= 0; i-- {
+		change := b.changes[i]
+		if err := b.restore(change); nil != err {
+			log.Log.Warning("Fail to rollback variable. name=[%v] previous=[%v] reason=[%v]",
+				change.Name, stringOrNull(change.Previous), err)
+			if nil == firstErr {
+				firstErr = err
+			}
+			failed = append([]VariableChange{change}, failed...)
+		}
+	}
+	b.changes = failed
+	return firstErr
+}
+
+// 恢复一次修改，PERSIST修改恢复GLOBAL值及原持久化状态
+func (b *VariableBatch) restore(change VariableChange) error {
+	value := previousVariableValue(change.Name, change.Previous)
+	if Set_Persist != change.Scope {
+		return b.apply(change.Scope, change.Name, value)
+	}
+	if err := b.apply(Set_Global, change.Name, value); nil != err {
+		return err
+	}
+	if nil == change.PreviousPersisted {
+		return b.execute(fmt.Sprintf("RESET PERSIST IF EXISTS %v", change.Name))
+	}
+	return b.execute(fmt.Sprintf("SET PERSIST_ONLY %v = %v",
+		change.Name, previousVariableValue(change.Name, change.PreviousPersisted)))
+}
+
+// 原值生成的SQL值，原值不满足当前规则时按字符串恢复
+func previousVariableValue(name string, previous *string) string {
+	if nil == previous {
+		return "NULL"
+	}
+	value, err := formatVariableValue(SettableVariables[name], *previous)
+	if nil != err {
+		return quoteVariableString(*previous)
+	}
+	return value
+}
+
+// 校验范围、变量名及执行者
+func (b *VariableBatch) check(scope SetScope, name string) (rule VariableRule, err error) {
+	if scope < Set_Session || scope > Set_Persist {
+		return rule, fmt.Errorf("invalid set scope. scope=[%v]", scope)
+	}
+	rule, ok := SettableVariables[name]
+	if !ok {
+		return rule, fmt.Errorf("variable is not in allowlist. name=[%v]", name)
+	}
+	if rule.Dangerous && !b.Force {
+		return rule, fmt.Errorf("variable is dangerous, set Force to modify it. name=[%v]", name)
+	}
+	if Set_Session == scope && !isSessionExecutor(b.exec) {
+		return rule, fmt.Errorf("SESSION scope need a session executor(*sql.Conn or *sql.Tx). type=[%T]", b.exec)
+	}
+	return rule, nil
+}
+
+// 读取修改前的值，name已通过白名单校验
+func (b *VariableBatch) read(scope SetScope, name string) (*string, error) {
+	exec := b.exec
+	if nil == exec {
+		exec = b.db.DB
+	}
+	ctx, cancel := timeoutContext(b.db.rwTimeout())
+	defer cancel()
+	var previous sql.NullString
+	sqlText := fmt.Sprintf("SELECT @@%v.%v", scope.readScope(), name)
+	if err := exec.QueryRowContext(ctx, sqlText).Scan(&previous); nil != err {
+		return nil, err
+	}
+	if !previous.Valid {
+		return nil, nil
+	}
+	return &previous.String, nil
+}
+
+// 读取修改前持久化的值，未持久化时返回nil
+func (b *VariableBatch) readPersisted(name string) (*string, error) {
+	exec := b.exec
+	if nil == exec {
+		exec = b.db.DB
+	}
+	ctx, cancel := timeoutContext(b.db.rwTimeout())
+	defer cancel()
+	var persisted string
+	err := exec.QueryRowContext(ctx, "SELECT VARIABLE_VALUE FROM performance_schema.persisted_variables WHERE VARIABLE_NAME = ?",
+		name).Scan(&persisted)
+	if sql.ErrNoRows == err {
+		return nil, nil
+	}
+	if nil != err {
+		return nil, err
+	}
+	return &persisted, nil
+}
+
+func (b *VariableBatch) apply(scope SetScope, name string, sqlValue string) error {
+	return b.execute(fmt.Sprintf("SET %v %v = %v", scope, name, sqlValue))
+}
+
+func (b *VariableBatch) execute(sqlText string) error {
+	res, err := b.db.ExecWithExecutor(b.exec, b.db.rwTimeout(), sqlText)
+	res.Close()
+	if nil != err {
+		return err
+	}
+	return res.Error
+}
+
+// 按变量类型校验并生成SQL中的值
+func formatVariableValue(rule VariableRule, value interface{}) (string, error) {
+	var text string
+	switch v := value.(type) {
+	case bool:
+		if Var_Bool != rule.Type {
+			return "", fmt.Errorf("bool value for non bool variable. value=[%v]", v)
+		}
+		text = "OFF"
+		if v {
+			text = "ON"
+		}
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		text = fmt.Sprintf("%d", v)
+	case float32:
+		text = strconv.FormatFloat(float64(v), 'f', -1, 32)
+	case float64:
+		text = strconv.FormatFloat(v, 'f', -1, 64)
+	case string:
+		text = strings.TrimSpace(v)
+	default:
+		return "", fmt.Errorf("unsupported value type. type=[%T]", value)
+	}
+
+	switch rule.Type {
+	case Var_Int:
+		if !intValuePattern.MatchString(text) {
+			return "", fmt.Errorf("invalid integer value. value=[%v]", text)
+		}
+		// 数值型变量不能加引号，否则报ER_WRONG_TYPE_FOR_VAR
+		if len(rule.Enum) > 0 {
+			for _, option := range rule.Enum {
+				if option == text {
+					return text, nil
+				}
+			}
+			return "", fmt.Errorf("invalid integer value. value=[%v] options=[%v]", text, rule.Enum)
+		}
+		return text, nil
+	case Var_Float:
+		if !floatValuePattern.MatchString(text) {
+			return "", fmt.Errorf("invalid number value. value=[%v]", text)
+		}
+		return text, nil
+	case Var_Bool:
+		switch strings.ToUpper(text) {
+		case "ON", "1", "TRUE", "YES":
+			return "ON", nil
+		case "OFF", "0", "FALSE", "NO":
+			return "OFF", nil
+		}
+		return "", fmt.Errorf("invalid bool value. value=[%v]", text)
+	case Var_Enum:
+		for _, option := range rule.Enum {
+			if strings.EqualFold(option, text) {
+				return quoteVariableString(option), nil
+			}
+		}
+		return "", fmt.Errorf("invalid enum value. value=[%v] options=[%v]", text, rule.Enum)
+	case Var_String:
+		for _, c := range text {
+			if '\\' == c || c < 0x20 || 0x7f == c {
+				return "", fmt.Errorf("string value contains backslash or control character. value=[%q]", text)
+			}
+		}
+		return quoteVariableString(text), nil
+	}
+	return "", fmt.Errorf("unknown variable type. type=[%v]", rule.Type)
+}
+
+// 单引号加倍转义，不依赖NO_BACKSLASH_ESCAPES
+func quoteVariableString(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+func stringOrNull(value *string) string {
+	if nil == value {
+		return "NULL"
+	}
+	return *value
+}
@@ -0,0 +1,177 @@
+package mysql
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"testing"
+)
+
+func TestFormatVariableValue(t *testing.T) {
+	cases := []struct {
+		name  string
+		value interface{}
+		want  string
+	}{
+		{"wait_timeout", 28800, "28800"},
+		{"wait_timeout", "600", "600"},
+		{"long_query_time", 0.5, "0.5"},
+		{"read_only", true, "ON"},
+		{"read_only", "0", "OFF"},
+		{"transaction_isolation", "read-committed", "'READ-COMMITTED'"},
+		{"sql_mode", "STRICT_TRANS_TABLES,NO_ZERO_DATE", "'STRICT_TRANS_TABLES,NO_ZERO_DATE'"},
+		{"time_zone", "it's", "'it''s'"},
+		{"innodb_flush_log_at_trx_commit", 2, "2"},
+		{"innodb_flush_log_at_trx_commit", "1", "1"},
+	}
+	for _, c := range cases {
+		got, err := formatVariableValue(SettableVariables[c.name], c.value)
+		if nil != err || c.want != got {
+			t.Errorf("formatVariableValue(%v, %v)=[%v] err=[%v], want [%v]", c.name, c.value, got, err, c.want)
+		}
+	}
+	invalid := []struct {
+		name  string
+		value interface{}
+	}{
+		{"wait_timeout", "1; DROP TABLE t"},
+		{"wait_timeout", -1},
+		{"wait_timeout", true},
+		{"read_only", "maybe"},
+		{"transaction_isolation", "CHAOS"},
+		{"innodb_flush_log_at_trx_commit", 3},
+		{"sql_mode", "a\\' OR 1"},
+		{"sql_mode", []byte("x")},
+	}
+	for _, c := range invalid {
+		if got, err := formatVariableValue(SettableVariables[c.name], c.value); nil == err {
+			t.Errorf("formatVariableValue(%v, %v)=[%v] should fail", c.name, c.value, got)
+		}
+	}
+}
+
+const persistedVariableSQL = "SELECT VARIABLE_VALUE FROM performance_schema.persisted_variables WHERE VARIABLE_NAME = ?"
+
+// 原来已持久化的变量恢复为原持久化值
+// 限定取值的数值型变量不加引号
+func TestVariableBatchNumericOptions(t *testing.T) {
+	pool, server := newFakePool(t, map[string]fakeResult{
+		"SELECT @@GLOBAL.innodb_flush_log_at_trx_commit": {columns: []string{"v"}, rows: [][]driver.Value{{"1"}}},
+		"SET GLOBAL innodb_flush_log_at_trx_commit = 2":  {},
+		"SET GLOBAL innodb_flush_log_at_trx_commit = 1":  {},
+	})
+	batch := pool.NewVariableBatch(nil)
+	batch.Force = true
+	if err := batch.Set(Set_Global, "innodb_flush_log_at_trx_commit", 2); nil != err {
+		t.Fatalf("Set fail. err=[%v]", err)
+	}
+	if err := batch.Rollback(); nil != err {
+		t.Fatalf("Rollback fail. err=[%v]", err)
+	}
+	executed := server.executedSQL()
+	if n := len(executed); n < 2 || "SET GLOBAL innodb_flush_log_at_trx_commit = 2" != executed[n-2] ||
+		"SET GLOBAL innodb_flush_log_at_trx_commit = 1" != executed[n-1] {
+		t.Errorf("unexpected sql. executed=[%v]", executed)
+	}
+}
+
+func TestVariableBatchPersisted(t *testing.T) {
+	pool, server := newFakePool(t, map[string]fakeResult{
+		"SELECT @@GLOBAL.wait_timeout":        {columns: []string{"v"}, rows: [][]driver.Value{{"28800"}}},
+		persistedVariableSQL:                  {columns: []string{"VARIABLE_VALUE"}, rows: [][]driver.Value{{"600"}}},
+		"SET PERSIST wait_timeout = 3600":     {},
+		"SET GLOBAL wait_timeout = 28800":     {},
+		"SET PERSIST_ONLY wait_timeout = 600": {},
+	})
+	batch := pool.NewVariableBatch(nil)
+	if err := batch.Set(Set_Persist, "wait_timeout", 3600); nil != err {
+		t.Fatalf("Set fail. err=[%v]", err)
+	}
+	if changes := batch.Changes(); nil == changes[0].PreviousPersisted || "600" != *changes[0].PreviousPersisted {
+		t.Fatalf("unexpected changes. changes=[%+v]", changes)
+	}
+	if err := batch.Rollback(); nil != err {
+		t.Fatalf("Rollback fail. err=[%v]", err)
+	}
+	executed := server.executedSQL()
+	if n := len(executed); n < 2 || "SET GLOBAL wait_timeout = 28800" != executed[n-2] ||
+		"SET PERSIST_ONLY wait_timeout = 600" != executed[n-1] {
+		t.Errorf("unexpected rollback. executed=[%v]", executed)
+	}
+}
+
+func TestVariableBatch(t *testing.T) {
+	pool, server := newFakePool(t, map[string]fakeResult{
+		"SELECT @@GLOBAL.long_query_time":         {columns: []string{"v"}, rows: [][]driver.Value{{"10.000000"}}},
+		"SELECT @@SESSION.sql_log_bin":            {columns: []string{"v"}, rows: [][]driver.Value{{"1"}}},
+		"SELECT @@GLOBAL.max_connections":         {columns: []string{"v"}, rows: [][]driver.Value{{"151"}}},
+		"SET GLOBAL long_query_time = 0.5":        {},
+		"SET SESSION sql_log_bin = OFF":           {},
+		"SET PERSIST max_connections = 2000":      {},
+		"SET GLOBAL max_connections = 151":        {},
+		"RESET PERSIST IF EXISTS max_connections": {err: errors.New("reset persist failed")},
+		persistedVariableSQL:                      {columns: []string{"VARIABLE_VALUE"}},
+		"SET SESSION sql_log_bin = ON":            {},
+		"SET GLOBAL long_query_time = 10.000000":  {},
+	})
+	conn, err := pool.Conn(context.Background())
+	if nil != err {
+		t.Fatalf("get conn fail. err=[%v]", err)
+	}
+	defer conn.Close()
+
+	batch := pool.NewVariableBatch(conn)
+	if err = batch.Set(Set_Session, "sql_log_bin", false); nil == err {
+		t.Errorf("dangerous variable should be refused without Force")
+	}
+	if err = batch.Set(Set_Global, "innodb_page_size", 4096); nil == err {
+		t.Errorf("variable out of allowlist should be refused")
+	}
+	batch.Force = true
+	for _, set := range []struct {
+		scope SetScope
+		name  string
+		value interface{}
+	}{
+		{Set_Global, "long_query_time", 0.5},
+		{Set_Session, "SQL_LOG_BIN", false},
+		{Set_Persist, "max_connections", 2000},
+	} {
+		if err = batch.Set(set.scope, set.name, set.value); nil != err {
+			t.Fatalf("Set fail. name=[%v] err=[%v]", set.name, err)
+		}
+	}
+	changes := batch.Changes()
+	if 3 != len(changes) || "1" != *changes[1].Previous || "OFF" != changes[1].Value {
+		t.Fatalf("unexpected changes. changes=[%+v]", changes)
+	}
+
+	if err = batch.Rollback(); nil == err {
+		t.Errorf("rollback should return the persist failure")
+	}
+	var rollbacks []string
+	for _, query := range server.executedSQL() {
+		switch query {
+		case "SET GLOBAL max_connections = 151", "RESET PERSIST IF EXISTS max_connections",
+			"SET SESSION sql_log_bin = ON", "SET GLOBAL long_query_time = 10.000000":
+			rollbacks = append(rollbacks, query)
+		}
+	}
+	// 原来未持久化的变量恢复GLOBAL值后RESET PERSIST
+	if 4 != len(rollbacks) || "SET GLOBAL max_connections = 151" != rollbacks[0] ||
+		"RESET PERSIST IF EXISTS max_connections" != rollbacks[1] || "SET GLOBAL long_query_time = 10.000000" != rollbacks[3] {
+		t.Errorf("rollback should run in reverse order. rollbacks=[%v]", rollbacks)
+	}
+	if remain := batch.Changes(); 1 != len(remain) || "max_connections" != remain[0].Name {
+		t.Errorf("failed rollback should stay in batch. changes=[%+v]", remain)
+	}
+
+	if remain := batch.Changes(); nil != remain[0].PreviousPersisted {
+		t.Errorf("variable should not be persisted before set. changes=[%+v]", remain)
+	}
+
+	// 连接池不能修改SESSION变量
+	if _, err = pool.SetVariable(nil, Set_Session, "innodb_lock_wait_timeout", 10, false); nil == err {
+		t.Errorf("SESSION scope without session executor should be refused")
+	}
+}
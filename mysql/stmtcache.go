@@ -0,0 +1,287 @@
+package mysql
+
+/*
+ * 预编译语句缓存
+ * 1、按SQL文本缓存连接池上prepare得到的*sql.Stmt，超过容量时淘汰最久未使用的语句
+ * 2、exec为*sql.Tx或*Trx时通过tx.StmtContext绑定到事务；*sql.Conn无法绑定，直接执行不走缓存
+ * 3、执行返回ER_NEED_REPREPARE(表结构变更)时淘汰该语句，并不经缓存重新执行一次
+ * 4、不支持预编译的语句(ER_UNSUPPORTED_PS)直接执行，并记录到容量相同的负缓存中，之后不再prepare
+ *
+ * Demo：
+ *	pool.EnableStmtCache(256)
+ *	res, err := pool.DBQuery(nil, nil, 3, "select id from db_instances where ip = ?", ip)
+ *	...
+ *	stats := pool.StmtCacheStats()
+ *	log.Log.Info("stmt cache hits=[%v] misses=[%v]", stats.Hits, stats.Misses)
+ */
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"errors"
+	"go-tools/log"
+	"sync"
+	"sync/atomic"
+)
+
+// 预编译语句缓存的统计
+type StmtCacheStats struct {
+	Size          int   // 当前缓存的语句数
+	Capacity      int   // 最大缓存的语句数
+	Hits          int64 // 命中次数
+	Misses        int64 // 未命中次数(含prepare失败)
+	Evictions     int64 // 超过容量被淘汰的次数
+	Invalidations int64 // 因ER_NEED_REPREPARE被淘汰的次数
+	Unsupported   int   // 记录的不支持预编译的语句数
+}
+
+// 语句在负缓存中，不支持预编译
+var errStmtUnsupported = errors.New("stmt is unsupported by prepared statement protocol")
+
+// LRU缓存，链表头部为最近使用的语句
+type stmtCache struct {
+	lock     sync.Mutex
+	capacity int
+	entries  map[string]*list.Element
+	lru      *list.List
+	// 不支持预编译的语句，超过容量时淘汰最早加入的语句
+	unsupported     map[string]*list.Element
+	unsupportedList *list.List
+
+	hits          int64
+	misses        int64
+	evictions     int64
+	invalidations int64
+}
+
+// 缓存的语句，refs为正在使用的数量，淘汰时等使用完毕再关闭
+type stmtCacheEntry struct {
+	sqlText string
+	stmt    *sql.Stmt
+	refs    int
+	removed bool
+}
+
+func newStmtCache(capacity int) *stmtCache {
+	return &stmtCache{
+		capacity: capacity,
+		entries:  make(map[string]*list.Element),
+		lru:      list.New(),
+
+		unsupported:     make(map[string]*list.Element),
+		unsupportedList: list.New(),
+	}
+}
+
+/*
+ * 开启预编译语句缓存，capacity为最多缓存的语句数，<=0时关闭缓存并释放已缓存的语句
+ * 需要在连接池初始化时调用，不能与查询并发执行
+ */
+func (db *DBPool) EnableStmtCache(capacity int) {
+	if nil != db.stmtCache {
+		db.stmtCache.close()
+		db.stmtCache = nil
+	}
+	if capacity > 0 {
+		db.stmtCache = newStmtCache(capacity)
+	}
+}
+
+// 预编译语句缓存的统计，未开启缓存时返回零值
+func (db *DBPool) StmtCacheStats() StmtCacheStats {
+	if nil == db.stmtCache {
+		return StmtCacheStats{}
+	}
+	return db.stmtCache.stats()
+}
+
+// 执行查询，开启缓存时使用预编译语句
+func (db *DBPool) queryRows(ctx context.Context, exec Executor, sqlText string, params ...interface{}) (*sql.Rows, error) {
+	entry, stmt := db.cachedStmt(ctx, exec, sqlText)
+	if nil == stmt {
+		return db.executor(exec).QueryContext(ctx, sqlText, params...)
+	}
+	rows, err := stmt.QueryContext(ctx, params...)
+	// 结果集持有对语句的依赖，此处释放引用不会导致语句被提前关闭
+	db.stmtCache.release(entry)
+	if isMySQLError(err, ER_NEED_REPREPARE) {
+		db.stmtCache.invalidate(entry)
+		return db.executor(exec).QueryContext(ctx, sqlText, params...)
+	}
+	return rows, err
+}
+
+// 执行ddl或dml语句，开启缓存时使用预编译语句
+func (db *DBPool) execResult(ctx context.Context, exec Executor, sqlText string, params ...interface{}) (sql.Result, error) {
+	entry, stmt := db.cachedStmt(ctx, exec, sqlText)
+	if nil == stmt {
+		return db.executor(exec).ExecContext(ctx, sqlText, params...)
+	}
+	result, err := stmt.ExecContext(ctx, params...)
+	db.stmtCache.release(entry)
+	if isMySQLError(err, ER_NEED_REPREPARE) {
+		db.stmtCache.invalidate(entry)
+		return db.executor(exec).ExecContext(ctx, sqlText, params...)
+	}
+	return result, err
+}
+
+// 返回可用于exec的缓存语句，无法使用缓存时stmt为nil
+// stmt不为nil时，调用方使用完毕后需要release(entry)
+func (db *DBPool) cachedStmt(ctx context.Context, exec Executor, sqlText string) (entry *stmtCacheEntry, stmt *sql.Stmt) {
+	if nil == db.stmtCache {
+		return nil, nil
+	}
+	var trx *sql.Tx
+	switch e := exec.(type) {
+	case nil:
+	case *sql.DB:
+		if e != db.DB {
+			return nil, nil
+		}
+	case *sql.Tx:
+		trx = e
+	case *Trx:
+		trx = e.Tx
+	default:
+		return nil, nil
+	}
+	entry, err := db.stmtCache.acquire(ctx, db.DB, sqlText)
+	if nil != err {
+		if errStmtUnsupported != err {
+			log.Log.Warning("Fail to prepare stmt. sql=[%s] reason=[%v]", sqlText, err)
+		}
+		return nil, nil
+	}
+	if nil == trx {
+		return entry, entry.stmt
+	}
+	// 事务内的语句在事务结束时自动关闭
+	return entry, trx.StmtContext(ctx, entry.stmt)
+}
+
+// 获取sqlText对应的语句，不存在时prepare并加入缓存
+// 语句不支持预编译时返回errStmtUnsupported
+func (c *stmtCache) acquire(ctx context.Context, db *sql.DB, sqlText string) (*stmtCacheEntry, error) {
+	c.lock.Lock()
+	if _, ok := c.unsupported[sqlText]; ok {
+		c.lock.Unlock()
+		return nil, errStmtUnsupported
+	}
+	if elem, ok := c.entries[sqlText]; ok {
+		c.lru.MoveToFront(elem)
+		entry := elem.Value.(*stmtCacheEntry)
+		entry.refs++
+		c.lock.Unlock()
+		atomic.AddInt64(&c.hits, 1)
+		return entry, nil
+	}
+	c.lock.Unlock()
+	atomic.AddInt64(&c.misses, 1)
+
+	// prepare需要访问数据库，不持有锁
+	stmt, err := db.PrepareContext(ctx, sqlText)
+	if isMySQLError(err, ER_UNSUPPORTED_PS) {
+		c.markUnsupported(sqlText)
+		return nil, errStmtUnsupported
+	}
+	if nil != err {
+		return nil, err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	// 并发prepare了同一条语句时使用先加入缓存的语句
+	if elem, ok := c.entries[sqlText]; ok {
+		c.lru.MoveToFront(elem)
+		entry := elem.Value.(*stmtCacheEntry)
+		entry.refs++
+		closeStmt(stmt)
+		return entry, nil
+	}
+	entry := &stmtCacheEntry{sqlText: sqlText, stmt: stmt, refs: 1}
+	c.entries[sqlText] = c.lru.PushFront(entry)
+	for c.lru.Len() > c.capacity {
+		c.removeLocked(c.lru.Back().Value.(*stmtCacheEntry))
+		atomic.AddInt64(&c.evictions, 1)
+	}
+	return entry, nil
+}
+
+// 记录不支持预编译的语句
+func (c *stmtCache) markUnsupported(sqlText string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if _, ok := c.unsupported[sqlText]; ok {
+		return
+	}
+	c.unsupported[sqlText] = c.unsupportedList.PushBack(sqlText)
+	for c.unsupportedList.Len() > c.capacity {
+		delete(c.unsupported, c.unsupportedList.Remove(c.unsupportedList.Front()).(string))
+	}
+}
+
+// 释放对语句的引用，语句已被淘汰且无人使用时关闭
+func (c *stmtCache) release(entry *stmtCacheEntry) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	entry.refs--
+	if entry.removed && 0 == entry.refs {
+		closeStmt(entry.stmt)
+	}
+}
+
+// 语句失效，从缓存中淘汰
+func (c *stmtCache) invalidate(entry *stmtCacheEntry) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if entry.removed {
+		return
+	}
+	c.removeLocked(entry)
+	atomic.AddInt64(&c.invalidations, 1)
+}
+
+// 关闭缓存，正在使用的语句在使用完毕后关闭
+func (c *stmtCache) close() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for c.lru.Len() > 0 {
+		c.removeLocked(c.lru.Back().Value.(*stmtCacheEntry))
+	}
+}
+
+// 从缓存中移除，需持有锁
+func (c *stmtCache) removeLocked(entry *stmtCacheEntry) {
+	if elem, ok := c.entries[entry.sqlText]; ok && elem.Value == entry {
+		c.lru.Remove(elem)
+		delete(c.entries, entry.sqlText)
+	}
+	entry.removed = true
+	if 0 == entry.refs {
+		closeStmt(entry.stmt)
+	}
+}
+
+func (c *stmtCache) stats() StmtCacheStats {
+	c.lock.Lock()
+	size := c.lru.Len()
+	unsupported := c.unsupportedList.Len()
+	c.lock.Unlock()
+	return StmtCacheStats{
+		Size:          size,
+		Capacity:      c.capacity,
+		Hits:          atomic.LoadInt64(&c.hits),
+		Misses:        atomic.LoadInt64(&c.misses),
+		Evictions:     atomic.LoadInt64(&c.evictions),
+		Invalidations: atomic.LoadInt64(&c.invalidations),
+		Unsupported:   unsupported,
+	}
+}
+
+func closeStmt(stmt *sql.Stmt) {
+	defer DoQueryException(stmt)
+	if err := stmt.Close(); nil != err {
+		log.Log.Warn("Close stmt fail. err=[%v]", err)
+	}
+}
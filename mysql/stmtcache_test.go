@@ -0,0 +1,108 @@
+package mysql
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	mysqlDriver "github.com/go-sql-driver/mysql"
+)
+
+func newStmtCachePool(t *testing.T, capacity int) (*DBPool, *fakeServer) {
+	pool, server := newFakePool(t, map[string]fakeResult{
+		"select a": fakeSequenceRows("id", 1),
+		"select b": fakeSequenceRows("id", 1),
+		"select c": fakeSequenceRows("id", 1),
+		"update a": {rowsAffected: 1},
+		"lock a":   {prepareErr: &mysqlDriver.MySQLError{Number: ER_UNSUPPORTED_PS}},
+	})
+	pool.EnableStmtCache(capacity)
+	return pool, server
+}
+
+func mustQuery(t *testing.T, pool *DBPool, exec Executor, sqlText string) {
+	res, err := pool.QueryWithExecutor(exec, 3, sqlText)
+	if nil != err {
+		t.Fatalf("Query fail. sql=[%v] err=[%v]", sqlText, err)
+	}
+	res.Close()
+}
+
+func TestStmtCacheHitMiss(t *testing.T) {
+	pool, server := newStmtCachePool(t, 2)
+	for i := 0; i < 3; i++ {
+		mustQuery(t, pool, nil, "select a")
+	}
+	if _, err := pool.DBExec(nil, nil, 3, "update a"); nil != err {
+		t.Fatalf("DBExec fail. err=[%v]", err)
+	}
+	stats := pool.StmtCacheStats()
+	if 2 != stats.Hits || 2 != stats.Misses || 2 != stats.Size {
+		t.Errorf("unexpected stats. stats=[%+v]", stats)
+	}
+
+	// 容量为2，select b加入后淘汰最久未使用的select a
+	mustQuery(t, pool, nil, "select b")
+	mustQuery(t, pool, nil, "select a")
+	stats = pool.StmtCacheStats()
+	if 2 != stats.Evictions || 4 != stats.Misses || 2 != stats.Size {
+		t.Errorf("unexpected stats after eviction. stats=[%+v]", stats)
+	}
+	if 0 != server.openRows() {
+		t.Errorf("rows are not closed. open=[%v]", server.openRows())
+	}
+}
+
+func TestStmtCacheRebind(t *testing.T) {
+	pool, _ := newStmtCachePool(t, 4)
+	mustQuery(t, pool, nil, "select a")
+
+	trx, err := pool.BeginTrx()
+	if nil != err {
+		t.Fatalf("BeginTrx fail. err=[%v]", err)
+	}
+	mustQuery(t, pool, trx, "select a")
+	trx.Rollback()
+	if stats := pool.StmtCacheStats(); 1 != stats.Hits {
+		t.Errorf("transaction should reuse cached stmt. stats=[%+v]", stats)
+	}
+
+	// *sql.Conn无法绑定预编译语句，不经过缓存
+	conn, err := pool.Conn(context.Background())
+	if nil != err {
+		t.Fatalf("Get conn fail. err=[%v]", err)
+	}
+	defer conn.Close()
+	mustQuery(t, pool, conn, "select b")
+	if stats := pool.StmtCacheStats(); 1 != stats.Hits || 1 != stats.Misses {
+		t.Errorf("conn should bypass stmt cache. stats=[%+v]", stats)
+	}
+}
+
+func TestStmtCacheInvalidate(t *testing.T) {
+	pool, server := newStmtCachePool(t, 4)
+	mustQuery(t, pool, nil, "select a")
+	server.failStmtOnce("select a", &mysqlDriver.MySQLError{Number: ER_NEED_REPREPARE})
+	mustQuery(t, pool, nil, "select a")
+	stats := pool.StmtCacheStats()
+	if 1 != stats.Invalidations || 0 != stats.Size {
+		t.Errorf("stmt should be invalidated. stats=[%+v]", stats)
+	}
+
+	// 不支持预编译的语句直接执行，再次执行时不再prepare
+	misses, prepared := stats.Misses, atomic.LoadInt32(&server.prepared)
+	mustQuery(t, pool, nil, "lock a")
+	mustQuery(t, pool, nil, "lock a")
+	if stats = pool.StmtCacheStats(); 0 != stats.Size || 1 != stats.Unsupported || misses+1 != stats.Misses {
+		t.Errorf("unsupported stmt should not be cached. stats=[%+v]", stats)
+	}
+	if n := atomic.LoadInt32(&server.prepared); prepared+1 != n {
+		t.Errorf("unsupported stmt should be prepared once. prepared=[%v]", n-prepared)
+	}
+
+	pool.EnableStmtCache(0)
+	mustQuery(t, pool, nil, "select a")
+	if stats = pool.StmtCacheStats(); 0 != stats.Misses {
+		t.Errorf("disabled cache should have no stats. stats=[%+v]", stats)
+	}
+}
@@ -0,0 +1,195 @@
+package mysql
+
+/*
+ * 大结果集流式读取
+ * 1、RowIterator：拉取式迭代器，每次Next()只读取一行，不额外占用内存
+ * 2、StreamQuery：通过有界channel推送，channel满时暂停读取(背压)，ctx取消时终止查询
+ * T为结构体时按列名映射(规则同ScanAll)，否则要求结果集只有一列并直接赋值
+ *
+ * Demo：
+ *	ctx, cancel := context.WithCancel(context.Background())
+ *	defer cancel()
+ *	rows, err := StreamQuery[instance](ctx, pool, nil, 100, "select id, ip from db_instances")
+ *	if nil != err {
+ *		return err
+ *	}
+ *	for row := range rows {
+ *		if nil != row.Err {
+ *			log.Log.Warning("Scan row fail. reason=[%v]", row.Err)
+ *			continue
+ *		}
+ *		...
+ *	}
+ */
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// 拉取式行迭代器，使用完毕后必须调用Close()
+type RowIterator[T any] struct {
+	res     *QueryResult
+	scanner *structScanner // T为标量时为nil
+	value   T
+	scanErr error
+	err     error
+	closed  bool
+}
+
+// 基于查询结果创建迭代器，失败时会关闭res
+func NewRowIterator[T any](res *QueryResult) (*RowIterator[T], error) {
+	rows, err := resultRows(res)
+	if nil != err {
+		res.Close()
+		return nil, err
+	}
+	it := &RowIterator[T]{res: res}
+	t := reflect.TypeOf(it.value)
+	if nil != t && t.Kind() == reflect.Struct && !isScanner(t) {
+		if it.scanner, err = newStructScanner(rows, t); nil != err {
+			res.Close()
+			return nil, err
+		}
+		return it, nil
+	}
+	columns, err := rows.Columns()
+	if nil != err {
+		res.Close()
+		return nil, err
+	}
+	if 1 != len(columns) {
+		res.Close()
+		return nil, fmt.Errorf("Scan into type=[%v] need exactly one column. columns=[%v]", t, columns)
+	}
+	return it, nil
+}
+
+// 读取下一行，结果集结束或出现不可恢复的错误时返回false并自动关闭
+// 单行赋值失败不会终止迭代，通过ScanErr()获取
+func (it *RowIterator[T]) Next() bool {
+	if it.closed {
+		return false
+	}
+	rows := it.res.Rows
+	if !rows.Next() {
+		it.err = rows.Err()
+		it.Close()
+		return false
+	}
+	var value T
+	if nil != it.scanner {
+		it.scanErr = it.scanner.scan(rows, reflect.ValueOf(&value).Elem())
+	} else if err := rows.Scan(&value); nil != err {
+		it.scanErr = fmt.Errorf("Scan into type=[%T] fail. reason=[%v]", value, err)
+	}
+	it.value = value
+	return true
+}
+
+// 当前行的值
+func (it *RowIterator[T]) Value() T {
+	return it.value
+}
+
+// 当前行的赋值错误
+func (it *RowIterator[T]) ScanErr() error {
+	return it.scanErr
+}
+
+// 迭代结束的原因，正常读完时为nil
+func (it *RowIterator[T]) Err() error {
+	return it.err
+}
+
+// 关闭结果集并释放ctx，可重复调用；关闭时提升为错误的warning通过Err()返回
+func (it *RowIterator[T]) Close() {
+	if it.closed {
+		return
+	}
+	it.closed = true
+	closeResult(it.res, &it.err)
+}
+
+// StreamQuery推送的单行结果，Err不为nil时Value无效
+type StreamRow[T any] struct {
+	Value T
+	Err   error
+}
+
+/*
+ * 流式查询，结果通过容量为bufferSize的channel推送，读取完毕、出错或ctx取消后channel关闭
+ * 1、单行赋值失败时推送Err不为nil的StreamRow，并继续读取后续行
+ * 2、读取中途出错(如网络断开、提升为错误的warning)时，阻塞推送一条携带错误的StreamRow后关闭，
+ *    直到消费方读取或ctx结束；ctx取消时在channel有空间的情况下推送ctx的错误
+ * 3、调用方必须读完channel或取消ctx，否则读取协程会一直阻塞
+ * exec为nil时使用连接池
+ */
+func StreamQuery[T any](ctx context.Context, db *DBPool, exec Executor, bufferSize int,
+	sqlText string, params ...interface{}) (<-chan StreamRow[T], error) {
+
+	if nil == db {
+		return nil, errors.New("DBPool is nil")
+	}
+	if bufferSize < 0 {
+		bufferSize = 0
+	}
+	queryCtx, cancel := context.WithCancel(ctx)
+	res, err := db.DBQueryContext(queryCtx, exec, sqlText, params...)
+	res.cancel = cancel
+	if nil != err {
+		res.Close()
+		return nil, err
+	}
+	it, err := NewRowIterator[T](res)
+	if nil != err {
+		return nil, err
+	}
+
+	ch := make(chan StreamRow[T], bufferSize)
+	go func() {
+		defer DoQueryException(sqlText)
+		defer close(ch)
+		defer it.Close()
+		for it.Next() {
+			// 优先响应取消，避免消费方继续读取时仍在推送
+			if nil != ctx.Err() {
+				trySendStreamErr(ch, ctx.Err())
+				return
+			}
+			select {
+			case ch <- StreamRow[T]{Value: it.Value(), Err: it.ScanErr()}:
+			case <-ctx.Done():
+				trySendStreamErr(ch, ctx.Err())
+				return
+			}
+		}
+		if err := it.Err(); nil != err {
+			sendStreamErr(ctx, ch, err)
+		}
+	}()
+	return ch, nil
+}
+
+// 推送结果集的最终错误，channel满时等待消费方读取，ctx结束后放弃
+// 不能丢弃该错误，否则消费方会把被截断的结果当作正常结束
+func sendStreamErr[T any](ctx context.Context, ch chan StreamRow[T], err error) {
+	select {
+	case ch <- StreamRow[T]{Err: err}:
+		return
+	default:
+	}
+	select {
+	case ch <- StreamRow[T]{Err: err}:
+	case <-ctx.Done():
+	}
+}
+
+// channel有空间时推送错误，不阻塞
+func trySendStreamErr[T any](ch chan StreamRow[T], err error) {
+	select {
+	case ch <- StreamRow[T]{Err: err}:
+	default:
+	}
+}
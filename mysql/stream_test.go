@@ -0,0 +1,143 @@
+package mysql
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+)
+
+type streamRow struct {
+	Id   int64
+	Name string
+}
+
+func newStreamPool(t *testing.T) (*DBPool, *fakeServer) {
+	return newFakePool(t, map[string]fakeResult{
+		"select seq": fakeSequenceRows("id", 100),
+		"select rows": {columns: []string{"id", "name"}, rows: [][]driver.Value{
+			{int64(1), "a"}, {int64(2), nil}, {int64(3), "c"},
+		}},
+		"select fail": {err: errors.New("query fail")},
+		"select broken": {columns: []string{"id"}, rows: [][]driver.Value{{int64(1)}, {int64(2)}},
+			rowsErr: errors.New("invalid connection")},
+	})
+}
+
+// 等待读取协程关闭结果集
+func waitRowsClosed(t *testing.T, server *fakeServer) {
+	deadline := time.Now().Add(2 * time.Second)
+	for 0 != server.openRows() {
+		if time.Now().After(deadline) {
+			t.Fatalf("rows are not closed. open=[%v]", server.openRows())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestRowIterator(t *testing.T) {
+	pool, server := newStreamPool(t)
+	it, err := NewRowIterator[int64](fakeQuery(pool, "select seq"))
+	if nil != err {
+		t.Fatalf("NewRowIterator fail. err=[%v]", err)
+	}
+	var sum int64
+	for it.Next() {
+		if nil != it.ScanErr() {
+			t.Fatalf("unexpected scan error. err=[%v]", it.ScanErr())
+		}
+		sum += it.Value()
+	}
+	if nil != it.Err() || 5050 != sum {
+		t.Errorf("RowIterator sum=[%v] err=[%v], want 5050", sum, it.Err())
+	}
+	if 0 != server.openRows() {
+		t.Errorf("rows are not closed. open=[%v]", server.openRows())
+	}
+
+	if _, err = NewRowIterator[int64](fakeQuery(pool, "select rows")); nil == err {
+		t.Errorf("NewRowIterator into scalar with two columns should fail")
+	}
+	if 0 != server.openRows() {
+		t.Errorf("rows are not closed. open=[%v]", server.openRows())
+	}
+}
+
+func TestStreamQuery(t *testing.T) {
+	pool, server := newStreamPool(t)
+	rows, err := StreamQuery[streamRow](context.Background(), pool, nil, 1, "select rows")
+	if nil != err {
+		t.Fatalf("StreamQuery fail. err=[%v]", err)
+	}
+	var results []StreamRow[streamRow]
+	for row := range rows {
+		results = append(results, row)
+	}
+	if 3 != len(results) {
+		t.Fatalf("StreamQuery returns %v rows, want 3", len(results))
+	}
+	// NULL无法赋值给string，仅该行报错
+	if nil != results[0].Err || nil == results[1].Err || nil != results[2].Err {
+		t.Errorf("unexpected row errors. rows=[%+v]", results)
+	}
+	if "c" != results[2].Value.Name {
+		t.Errorf("unexpected last row. row=[%+v]", results[2])
+	}
+	waitRowsClosed(t, server)
+
+	if _, err = StreamQuery[streamRow](context.Background(), pool, nil, 1, "select fail"); nil == err {
+		t.Errorf("StreamQuery on failed query should return error")
+	}
+}
+
+func TestStreamQueryRowsErr(t *testing.T) {
+	pool, server := newStreamPool(t)
+	rows, err := StreamQuery[int64](context.Background(), pool, nil, 0, "select broken")
+	if nil != err {
+		t.Fatalf("StreamQuery fail. err=[%v]", err)
+	}
+	var values []int64
+	var streamErr error
+	for {
+		// 消费方读取较慢，读取协程推送错误时channel没有空间
+		time.Sleep(20 * time.Millisecond)
+		row, ok := <-rows
+		if !ok {
+			break
+		}
+		if nil != row.Err {
+			streamErr = row.Err
+			continue
+		}
+		values = append(values, row.Value)
+	}
+	if 2 != len(values) || nil == streamErr || "invalid connection" != streamErr.Error() {
+		t.Errorf("truncated stream should end with error. values=[%v] err=[%v]", values, streamErr)
+	}
+	waitRowsClosed(t, server)
+}
+
+func TestStreamQueryCancel(t *testing.T) {
+	pool, server := newStreamPool(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	rows, err := StreamQuery[int64](ctx, pool, nil, 2, "select seq")
+	if nil != err {
+		t.Fatalf("StreamQuery fail. err=[%v]", err)
+	}
+	for i := 0; i < 3; i++ {
+		if row := <-rows; nil != row.Err || int64(i+1) != row.Value {
+			t.Fatalf("unexpected row. row=[%+v] want=[%v]", row, i+1)
+		}
+	}
+	cancel()
+	// 取消后channel会被关闭，剩余数据不超过缓冲区、正在推送的一行与一条错误
+	count := 0
+	for range rows {
+		count++
+	}
+	if count > 4 {
+		t.Errorf("stream does not stop after cancel. remain=[%v]", count)
+	}
+	waitRowsClosed(t, server)
+}
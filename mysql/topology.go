@@ -0,0 +1,670 @@
+package mysql
+
+/*
+ * 复制拓扑发现
+ * 1、从一个实例出发，通过SHOW SLAVE STATUS的Master_Host/Master_Port向上、SHOW SLAVE HOSTS(SHOW REPLICAS)向下递归发现实例
+ * 2、每个实例记录server_id、server_uuid、read_only、延迟及角色，连接失败的实例保留在拓扑中并记录原因
+ * 3、同一实例通过不同地址发现时(如report_host与Master_Host不一致)，按server_uuid合并，没有uuid时按server_id合并
+ * 4、检测环形复制(如双主)及多源复制
+ * 5、可输出为文本树或Graphviz DOT
+ * SHOW SLAVE HOSTS只包含设置了report_host的从库，未设置时只能通过从库自身的Master_Host发现
+ *
+ * Demo：
+ *	crawler := NewTopologyCrawler(func(host string, port int32) (*DBPool, error) {
+ *		return getPool(host, port)
+ *	})
+ *	topology, err := crawler.Discover(pool, "10.0.0.1", 3306)
+ *	if nil != err {
+ *		return err
+ *	}
+ *	fmt.Print(topology.Text())
+ */
+import (
+	"errors"
+	"fmt"
+	"go-tools/log"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	DEFAULT_TOPOLOGY_MAX_NODES = 256 // 单次发现的最大实例数
+)
+
+// 实例在拓扑中的角色
+type TopologyRole int
+
+const (
+	Topology_Unknown      TopologyRole = iota // 无法连接且没有已知的复制关系
+	Topology_Standalone                       // 没有上游及下游
+	Topology_Master                           // 只有下游
+	Topology_Intermediate                     // 既有上游又有下游
+	Topology_Replica                          // 只有上游
+	Topology_Co_Master                        // 处于环形复制中
+)
+
+func (r TopologyRole) String() string {
+	switch r {
+	case Topology_Unknown:
+		return "unknown"
+	case Topology_Standalone:
+		return "standalone"
+	case Topology_Master:
+		return "master"
+	case Topology_Intermediate:
+		return "intermediate"
+	case Topology_Replica:
+		return "replica"
+	case Topology_Co_Master:
+		return "co-master"
+	}
+	return fmt.Sprintf("TopologyRole(%d)", int(r))
+}
+
+// SHOW SLAVE HOSTS / SHOW REPLICAS的一行，Host为从库的report_host，未设置时为空
+type ReplicaHost struct {
+	Server_id  int64
+	Host       string
+	Port       int32
+	Master_id  int64
+	Slave_UUID string // MariaDB没有该列
+}
+
+// 一条复制关系
+type TopologyEdge struct {
+	Master     string // 上游地址
+	Replica    string // 下游地址
+	Channel    string // 复制通道，默认通道为空
+	Lag        int32  // Seconds_Behind_Master，未知时为SECONDS_BEHIND_MASTER_UNKNOWN
+	IORunning  bool
+	SQLRunning bool
+	Reported   bool // 为true时关系只来自上游的SHOW SLAVE HOSTS，下游未连接成功，Lag及线程状态未知
+}
+
+// 拓扑中的实例
+type TopologyNode struct {
+	Addr       string // host:port，作为实例在拓扑中的标识
+	Host       string
+	Port       int32
+	ServerId   int64
+	ServerUUID string
+	ReadOnly   bool
+	Flavor     Flavor
+	Version    ServerVersion
+	Role       TopologyRole
+	Lag        int32    // 各复制通道中最大的延迟，任一通道未知时为SECONDS_BEHIND_MASTER_UNKNOWN，非从库为0
+	Masters    []string // 上游地址，按地址排序
+	Replicas   []string // 下游地址，按地址排序
+	Error      error    // 连接或查询失败的原因，为nil时表示已成功探测
+}
+
+// 实例身份，用于合并通过不同地址发现的同一实例
+func (n *TopologyNode) identity() string {
+	if "" != n.ServerUUID {
+		return "uuid:" + strings.ToLower(n.ServerUUID)
+	}
+	if n.ServerId > 0 {
+		return "server_id:" + strconv.FormatInt(n.ServerId, 10)
+	}
+	return ""
+}
+
+// 复制拓扑
+type Topology struct {
+	Seed        string                   // 发现的起点
+	Nodes       map[string]*TopologyNode // 按Addr索引
+	Edges       []TopologyEdge           // 按上游、下游、通道排序
+	Cycles      [][]string               // 环形复制中的实例，每个环内按地址排序
+	MultiSource []string                 // 有多个上游的实例
+	Truncated   bool                     // 实例数达到上限，部分实例未发现
+
+	order   []string          // 发现顺序，合并同一实例时保留先发现的地址
+	aliases map[string]string // 被合并的地址 -> 保留的地址
+}
+
+// 按地址查找实例，被合并的地址返回合并后的实例
+func (t *Topology) Node(addr string) *TopologyNode {
+	if canonical, ok := t.aliases[addr]; ok {
+		addr = canonical
+	}
+	return t.Nodes[addr]
+}
+
+// 没有上游的实例，按地址排序；完全处于环中的实例没有根
+func (t *Topology) Roots() []*TopologyNode {
+	var roots []*TopologyNode
+	for _, addr := range t.addrs() {
+		if node := t.Nodes[addr]; 0 == len(node.Masters) {
+			roots = append(roots, node)
+		}
+	}
+	return roots
+}
+
+func (t *Topology) addrs() []string {
+	addrs := make([]string, 0, len(t.Nodes))
+	for addr := range t.Nodes {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	return addrs
+}
+
+// 拓扑发现器
+// Connect根据地址返回连接池，由调用方负责连接池的创建、复用及关闭
+type TopologyCrawler struct {
+	Connect  func(host string, port int32) (*DBPool, error)
+	MaxNodes int // 最多发现的实例数，<=0时使用DEFAULT_TOPOLOGY_MAX_NODES
+}
+
+func NewTopologyCrawler(connect func(host string, port int32) (*DBPool, error)) *TopologyCrawler {
+	return &TopologyCrawler{Connect: connect, MaxNodes: DEFAULT_TOPOLOGY_MAX_NODES}
+}
+
+// 单个实例探测到的复制关系
+type topologyLinks struct {
+	edges []TopologyEdge
+	found []*TopologyNode // 新发现的上下游实例
+}
+
+/*
+ * 从seed出发发现拓扑，host、port为seed的地址
+ * seed探测失败时返回错误，其他实例失败时记录在TopologyNode.Error中并继续发现
+ */
+func (c *TopologyCrawler) Discover(seed *DBPool, host string, port int32) (*Topology, error) {
+	if nil == seed {
+		return nil, errors.New("seed pool is nil")
+	}
+	maxNodes := c.MaxNodes
+	if maxNodes <= 0 {
+		maxNodes = DEFAULT_TOPOLOGY_MAX_NODES
+	}
+	seedNode := newTopologyNode(host, port)
+	topology := &Topology{
+		Seed:    seedNode.Addr,
+		Nodes:   map[string]*TopologyNode{seedNode.Addr: seedNode},
+		order:   []string{seedNode.Addr},
+		aliases: map[string]string{},
+	}
+
+	var edges []TopologyEdge
+	for i := 0; i < len(topology.order); i++ {
+		node := topology.Nodes[topology.order[i]]
+		if nil != node.Error {
+			continue
+		}
+		pool := seed
+		if 0 != i {
+			var err error
+			if nil == c.Connect {
+				err = errors.New("TopologyCrawler need Connect")
+			} else {
+				pool, err = c.Connect(node.Host, node.Port)
+			}
+			if nil != err {
+				node.Error = err
+				log.Log.Warning("Fail to connect replication topology node. addr=[%v] reason=[%v]", node.Addr, err)
+				continue
+			}
+		}
+		links, err := probeTopologyNode(pool, node)
+		if nil != err {
+			node.Error = err
+			log.Log.Warning("Fail to probe replication topology node. addr=[%v] reason=[%v]", node.Addr, err)
+			if 0 == i {
+				return topology, err
+			}
+			continue
+		}
+		edges = append(edges, links.edges...)
+		for _, found := range links.found {
+			if _, ok := topology.Nodes[found.Addr]; ok {
+				continue
+			}
+			if len(topology.Nodes) >= maxNodes {
+				topology.Truncated = true
+				continue
+			}
+			topology.Nodes[found.Addr] = found
+			topology.order = append(topology.order, found.Addr)
+		}
+	}
+	topology.build(edges)
+	log.Log.Info("Discover replication topology. seed=[%v] nodes=[%v] edges=[%v] cycles=[%v] multi_source=[%v] truncated=[%v]",
+		topology.Seed, len(topology.Nodes), len(topology.Edges), topology.Cycles, topology.MultiSource, topology.Truncated)
+	return topology, nil
+}
+
+func newTopologyNode(host string, port int32) *TopologyNode {
+	return &TopologyNode{
+		Addr: net.JoinHostPort(host, strconv.Itoa(int(port))),
+		Host: host,
+		Port: port,
+	}
+}
+
+// 查询实例身份及上下游
+func probeTopologyNode(pool *DBPool, node *TopologyNode) (links topologyLinks, err error) {
+	snapshot, err := pool.ShowSnapshot(nil, Show_Variables, Scope_Global, "server_id", "server_uuid", "read_only")
+	if nil != err {
+		return links, err
+	}
+	if node.ServerId, err = snapshot.Int("server_id"); nil != err {
+		return links, err
+	}
+	node.ServerUUID, _ = snapshot.Get("server_uuid")
+	node.ReadOnly, _ = snapshot.Bool("read_only")
+	node.Flavor = pool.Flavor
+	node.Version = pool.Version
+
+	channels, err := pool.QuerySlaveStatusChannels(nil)
+	if nil != err {
+		return links, err
+	}
+	for _, channel := range channels {
+		if "" == channel.Master_Host {
+			continue
+		}
+		master := newTopologyNode(channel.Master_Host, channel.Master_Port)
+		master.ServerUUID = channel.Master_UUID
+		master.ServerId, _ = strconv.ParseInt(channel.Master_Server_Id, 10, 64)
+		links.found = append(links.found, master)
+		links.edges = append(links.edges, TopologyEdge{
+			Master:     master.Addr,
+			Replica:    node.Addr,
+			Channel:    channel.Channel_Name,
+			Lag:        channel.Seconds_Behind_Master,
+			IORunning:  "Yes" == channel.Slave_IO_Running,
+			SQLRunning: "Yes" == channel.Slave_SQL_Running,
+		})
+	}
+
+	// 没有权限查询下游时只记录日志，下游仍可能通过其他实例发现
+	hosts, err := pool.ShowReplicaHosts(nil)
+	if nil != err {
+		return links, nil
+	}
+	for _, host := range hosts {
+		replica := newTopologyNode(host.Host, host.Port)
+		if "" == host.Host {
+			// 未设置report_host的从库无法连接，以server_id作为地址，找到同一实例后合并
+			replica.Addr = fmt.Sprintf("server_id=%v", host.Server_id)
+			replica.Error = errors.New("replica has no report_host")
+		}
+		replica.ServerId = host.Server_id
+		replica.ServerUUID = host.Slave_UUID
+		links.found = append(links.found, replica)
+		links.edges = append(links.edges, TopologyEdge{
+			Master:   node.Addr,
+			Replica:  replica.Addr,
+			Lag:      SECONDS_BEHIND_MASTER_UNKNOWN,
+			Reported: true,
+		})
+	}
+	return links, nil
+}
+
+/*
+ * show slave hosts 语句执行接口，按db.Flavor及版本选择SHOW REPLICAS或SHOW SLAVE HOSTS，语法不支持时自动改用另一种
+ * exec为nil时使用连接池
+ */
+func (db *DBPool) ShowReplicaHosts(exec Executor) (hosts []ReplicaHost, err error) {
+	sqlText, fallback := "SHOW SLAVE HOSTS", "SHOW REPLICAS"
+	if db.preferReplicaSyntax() {
+		sqlText, fallback = fallback, sqlText
+	}
+	res, err := db.QueryWithExecutor(exec, db.rwTimeout(), sqlText)
+	if nil != err && isMySQLError(err, ER_PARSE_ERROR) {
+		res.Close()
+		sqlText = fallback
+		res, err = db.QueryWithExecutor(exec, db.rwTimeout(), sqlText)
+	}
+
+	defer DoQueryException(res.Rows)
+	defer res.Close()
+	if nil != err {
+		log.Log.Warning("Fail to exec %v. reason=[%v]", sqlText, err)
+		return nil, err
+	}
+	records, err := scanStatusRows(res.Rows)
+	if nil != err {
+		log.Log.Warning("Fail to exec %v. reason=[%v]", sqlText, err)
+		return nil, err
+	}
+	for _, record := range records {
+		var host ReplicaHost
+		if err = assignStatusRow(&host, record); nil != err {
+			log.Log.Warning("Fail to exec %v. reason=[%v]", sqlText, err)
+			return nil, err
+		}
+		hosts = append(hosts, host)
+	}
+	return hosts, nil
+}
+
+// 合并同一实例，整理复制关系并计算角色、环及多源复制
+func (t *Topology) build(edges []TopologyEdge) {
+	t.mergeNodes()
+
+	resolve := func(addr string) string {
+		if canonical, ok := t.aliases[addr]; ok {
+			return canonical
+		}
+		return addr
+	}
+	// 同一对实例既有从库上报的关系又有上游SHOW SLAVE HOSTS中的关系时，只保留从库上报的关系
+	replicated := make(map[[2]string]bool)
+	for i := range edges {
+		edges[i].Master, edges[i].Replica = resolve(edges[i].Master), resolve(edges[i].Replica)
+		if !edges[i].Reported {
+			replicated[[2]string{edges[i].Master, edges[i].Replica}] = true
+		}
+	}
+	seen := make(map[[3]string]bool)
+	t.Edges = nil
+	for _, edge := range edges {
+		key := [3]string{edge.Master, edge.Replica, edge.Channel}
+		if edge.Master == edge.Replica || seen[key] || (edge.Reported && replicated[[2]string{edge.Master, edge.Replica}]) {
+			continue
+		}
+		// 达到MaxNodes后未加入的实例
+		if nil == t.Nodes[edge.Master] || nil == t.Nodes[edge.Replica] {
+			continue
+		}
+		seen[key] = true
+		t.Edges = append(t.Edges, edge)
+	}
+	sort.Slice(t.Edges, func(i, j int) bool {
+		a, b := t.Edges[i], t.Edges[j]
+		if a.Master != b.Master {
+			return a.Master < b.Master
+		}
+		if a.Replica != b.Replica {
+			return a.Replica < b.Replica
+		}
+		return a.Channel < b.Channel
+	})
+
+	for _, node := range t.Nodes {
+		node.Masters, node.Replicas, node.Lag = nil, nil, 0
+	}
+	for _, edge := range t.Edges {
+		master, replica := t.Nodes[edge.Master], t.Nodes[edge.Replica]
+		master.Replicas = appendUnique(master.Replicas, edge.Replica)
+		replica.Masters = appendUnique(replica.Masters, edge.Master)
+		if SECONDS_BEHIND_MASTER_UNKNOWN == replica.Lag || SECONDS_BEHIND_MASTER_UNKNOWN == edge.Lag {
+			replica.Lag = SECONDS_BEHIND_MASTER_UNKNOWN
+		} else if edge.Lag > replica.Lag {
+			replica.Lag = edge.Lag
+		}
+	}
+
+	t.Cycles = t.findCycles()
+	inCycle := make(map[string]bool)
+	for _, cycle := range t.Cycles {
+		for _, addr := range cycle {
+			inCycle[addr] = true
+		}
+	}
+	t.MultiSource = nil
+	for _, addr := range t.addrs() {
+		node := t.Nodes[addr]
+		sort.Strings(node.Masters)
+		sort.Strings(node.Replicas)
+		if len(node.Masters) > 1 {
+			t.MultiSource = append(t.MultiSource, addr)
+		}
+		switch {
+		case inCycle[addr]:
+			node.Role = Topology_Co_Master
+		case len(node.Masters) > 0 && len(node.Replicas) > 0:
+			node.Role = Topology_Intermediate
+		case len(node.Masters) > 0:
+			node.Role = Topology_Replica
+		case len(node.Replicas) > 0:
+			node.Role = Topology_Master
+		case nil != node.Error:
+			node.Role = Topology_Unknown
+		default:
+			node.Role = Topology_Standalone
+		}
+	}
+}
+
+// 按发现顺序合并身份相同的实例，优先保留探测成功的地址
+func (t *Topology) mergeNodes() {
+	canonical := make(map[string]string)
+	for _, probed := range []bool{true, false} {
+		for _, addr := range t.order {
+			node, ok := t.Nodes[addr]
+			if !ok || (nil == node.Error) != probed || "" == node.identity() {
+				continue
+			}
+			id := node.identity()
+			if first, ok := canonical[id]; ok && first != addr {
+				t.aliases[addr] = first
+				delete(t.Nodes, addr)
+				continue
+			}
+			canonical[id] = addr
+		}
+	}
+	order := t.order[:0]
+	for _, addr := range t.order {
+		if _, ok := t.Nodes[addr]; ok {
+			order = append(order, addr)
+		}
+	}
+	t.order = order
+}
+
+// Tarjan强连通分量，包含多个实例的分量即为环形复制
+func (t *Topology) findCycles() (cycles [][]string) {
+	index := make(map[string]int)
+	lowLink := make(map[string]int)
+	onStack := make(map[string]bool)
+	var stack []string
+	var visit func(addr string)
+	visit = func(addr string) {
+		index[addr] = len(index)
+		lowLink[addr] = index[addr]
+		stack = append(stack, addr)
+		onStack[addr] = true
+		for _, next := range t.Nodes[addr].Replicas {
+			if _, ok := index[next]; !ok {
+				visit(next)
+				if lowLink[next] < lowLink[addr] {
+					lowLink[addr] = lowLink[next]
+				}
+			} else if onStack[next] && index[next] < lowLink[addr] {
+				lowLink[addr] = index[next]
+			}
+		}
+		if lowLink[addr] != index[addr] {
+			return
+		}
+		var component []string
+		for {
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[top] = false
+			component = append(component, top)
+			if top == addr {
+				break
+			}
+		}
+		if len(component) > 1 {
+			sort.Strings(component)
+			cycles = append(cycles, component)
+		}
+	}
+	for _, addr := range t.addrs() {
+		if _, ok := index[addr]; !ok {
+			visit(addr)
+		}
+	}
+	sort.Slice(cycles, func(i, j int) bool { return cycles[i][0] < cycles[j][0] })
+	return cycles
+}
+
+func appendUnique(values []string, value string) []string {
+	for _, v := range values {
+		if v == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
+
+/*
+ * 以文本树输出拓扑，从没有上游的实例开始，环中的实例从地址最小的开始
+ * 已输出过的实例(多源复制、环形复制)只输出地址并标记(see above)
+ */
+func (t *Topology) Text() string {
+	var builder strings.Builder
+	printed := make(map[string]bool)
+	edges := make(map[string][]TopologyEdge)
+	for _, edge := range t.Edges {
+		edges[edge.Master] = append(edges[edge.Master], edge)
+	}
+
+	var write func(addr string, edge *TopologyEdge, prefix string, branch string)
+	write = func(addr string, edge *TopologyEdge, prefix string, branch string) {
+		builder.WriteString(prefix + branch + addr)
+		if printed[addr] {
+			builder.WriteString(" (see above)")
+		} else {
+			builder.WriteString(t.Nodes[addr].describe())
+		}
+		if nil != edge {
+			builder.WriteString(edge.describe())
+		}
+		builder.WriteString("\n")
+		if printed[addr] {
+			return
+		}
+		printed[addr] = true
+
+		switch branch {
+		case "|-- ":
+			prefix += "|   "
+		case "`-- ":
+			prefix += "    "
+		}
+		children := edges[addr]
+		for i := range children {
+			next := "|-- "
+			if len(children)-1 == i {
+				next = "`-- "
+			}
+			write(children[i].Replica, &children[i], prefix, next)
+		}
+	}
+
+	for _, root := range t.Roots() {
+		write(root.Addr, nil, "", "")
+	}
+	for _, addr := range t.addrs() {
+		if !printed[addr] {
+			write(addr, nil, "", "")
+		}
+	}
+	for _, cycle := range t.Cycles {
+		builder.WriteString("cycle: " + strings.Join(cycle, ", ") + "\n")
+	}
+	if len(t.MultiSource) > 0 {
+		builder.WriteString("multi-source: " + strings.Join(t.MultiSource, ", ") + "\n")
+	}
+	if t.Truncated {
+		builder.WriteString("truncated: node limit reached, nodes=" + strconv.Itoa(len(t.Nodes)) + "\n")
+	}
+	return builder.String()
+}
+
+func (n *TopologyNode) describe() string {
+	text := fmt.Sprintf(" [%v]", n.Role)
+	if n.ServerId > 0 {
+		text += fmt.Sprintf(" server_id=%v", n.ServerId)
+	}
+	if "" != n.ServerUUID {
+		text += " uuid=" + n.ServerUUID
+	}
+	if nil == n.Error && n.ReadOnly {
+		text += " read_only"
+	}
+	if nil != n.Error {
+		text += fmt.Sprintf(" error=%q", n.Error.Error())
+	}
+	return text
+}
+
+func (e *TopologyEdge) describe() string {
+	var text string
+	if "" != e.Channel {
+		text += " channel=" + e.Channel
+	}
+	if e.Reported {
+		return text + " (reported by master)"
+	}
+	if SECONDS_BEHIND_MASTER_UNKNOWN == e.Lag {
+		text += " lag=unknown"
+	} else {
+		text += fmt.Sprintf(" lag=%vs", e.Lag)
+	}
+	if !e.IORunning || !e.SQLRunning {
+		text += fmt.Sprintf(" io_running=%v sql_running=%v", e.IORunning, e.SQLRunning)
+	}
+	return text
+}
+
+/*
+ * 以Graphviz DOT输出拓扑，边的方向为上游指向下游
+ * 环中的实例标红，连接失败的实例为虚线
+ */
+func (t *Topology) DOT() string {
+	var builder strings.Builder
+	builder.WriteString("digraph replication {\n")
+	builder.WriteString("\tnode [shape=box];\n")
+	inCycle := make(map[string]bool)
+	for _, cycle := range t.Cycles {
+		for _, addr := range cycle {
+			inCycle[addr] = true
+		}
+	}
+	for _, addr := range t.addrs() {
+		node := t.Nodes[addr]
+		label := []string{addr, node.Role.String()}
+		if node.ServerId > 0 {
+			label = append(label, fmt.Sprintf("server_id=%v", node.ServerId))
+		}
+		var attrs []string
+		attrs = append(attrs, "label="+dotQuote(strings.Join(label, "\n")))
+		if inCycle[addr] {
+			attrs = append(attrs, "color=red")
+		}
+		if nil != node.Error {
+			attrs = append(attrs, "style=dashed")
+		}
+		builder.WriteString(fmt.Sprintf("\t%v [%v];\n", dotQuote(addr), strings.Join(attrs, ", ")))
+	}
+	for i := range t.Edges {
+		edge := &t.Edges[i]
+		attrs := "label=" + dotQuote(strings.TrimSpace(edge.describe()))
+		if edge.Reported {
+			attrs += ", style=dashed"
+		}
+		builder.WriteString(fmt.Sprintf("\t%v -> %v [%v];\n", dotQuote(edge.Master), dotQuote(edge.Replica), attrs))
+	}
+	builder.WriteString("}\n")
+	return builder.String()
+}
+
+// DOT中的字符串，换行输出为\n
+func dotQuote(text string) string {
+	text = strings.ReplaceAll(text, `\`, `\\`)
+	text = strings.ReplaceAll(text, `"`, `\"`)
+	text = strings.ReplaceAll(text, "\n", `\n`)
+	return `"` + text + `"`
+}
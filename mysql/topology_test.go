@@ -0,0 +1,142 @@
+package mysql
+
+import (
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+)
+
+const topologyVariablesSQL = "SHOW GLOBAL VARIABLES WHERE Variable_name LIKE 'server_id' OR " +
+	"Variable_name LIKE 'server_uuid' OR Variable_name LIKE 'read_only'"
+
+var (
+	slaveStatusColumns = []string{"Master_Host", "Master_Port", "Master_Server_Id", "Master_UUID",
+		"Slave_IO_Running", "Slave_SQL_Running", "Seconds_Behind_Master", "Channel_Name"}
+	slaveHostsColumns = []string{"Server_id", "Host", "Port", "Master_id", "Slave_UUID"}
+)
+
+// 创建一个拓扑实例，slaveStatus及slaveHosts为SHOW SLAVE STATUS、SHOW SLAVE HOSTS的结果
+func newTopologyPool(t *testing.T, serverId string, uuid string, readOnly string,
+	slaveStatus [][]driver.Value, slaveHosts [][]driver.Value) *DBPool {
+	pool, _ := newFakePool(t, map[string]fakeResult{
+		topologyVariablesSQL: {
+			columns: []string{"Variable_name", "Value"},
+			rows:    [][]driver.Value{{"server_id", serverId}, {"server_uuid", uuid}, {"read_only", readOnly}},
+		},
+		"SHOW SLAVE STATUS": {columns: slaveStatusColumns, rows: slaveStatus},
+		"SHOW SLAVE HOSTS":  {columns: slaveHostsColumns, rows: slaveHosts},
+	})
+	return pool
+}
+
+func connectTopology(pools map[string]*DBPool) func(host string, port int32) (*DBPool, error) {
+	return func(host string, port int32) (*DBPool, error) {
+		pool, ok := pools[host]
+		if !ok {
+			return nil, errors.New("connection refused")
+		}
+		return pool, nil
+	}
+}
+
+func TestDiscoverTopology(t *testing.T) {
+	master := newTopologyPool(t, "1", "uuid-a", "OFF", nil, [][]driver.Value{
+		{"2", "db-b", "3306", "1", "uuid-b"},
+		{"3", "", "3306", "1", "uuid-c"},
+	})
+	// 从库B通过ip连接主库，与发现起点的地址不同，两者按uuid合并
+	pools := map[string]*DBPool{
+		"db-b": newTopologyPool(t, "2", "uuid-b", "ON",
+			[][]driver.Value{{"10.0.0.1", "3306", "1", "uuid-a", "Yes", "Yes", "5", ""}},
+			[][]driver.Value{{"4", "10.0.0.4", "3306", "2", "uuid-d"}}),
+		"10.0.0.1": master,
+	}
+	topology, err := NewTopologyCrawler(connectTopology(pools)).Discover(master, "db-a", 3306)
+	if nil != err {
+		t.Fatalf("Discover fail. err=[%v]", err)
+	}
+	if 4 != len(topology.Nodes) || 0 != len(topology.Cycles) || 0 != len(topology.MultiSource) {
+		t.Fatalf("unexpected topology. nodes=[%v] cycles=[%v]", topology.addrs(), topology.Cycles)
+	}
+	roles := map[string]TopologyRole{
+		"10.0.0.1:3306": Topology_Master,
+		"db-b:3306":     Topology_Intermediate,
+		"server_id=3":   Topology_Replica,
+		"10.0.0.4:3306": Topology_Replica,
+	}
+	for addr, role := range roles {
+		if node := topology.Node(addr); nil == node || role != node.Role {
+			t.Errorf("unexpected node. addr=[%v] node=[%+v]", addr, node)
+		}
+	}
+	if b := topology.Node("db-b:3306"); 5 != b.Lag || !b.ReadOnly || 2 != b.ServerId {
+		t.Errorf("unexpected replica. node=[%+v]", b)
+	}
+	if nil == topology.Node("10.0.0.4:3306").Error || SECONDS_BEHIND_MASTER_UNKNOWN != topology.Node("10.0.0.4:3306").Lag {
+		t.Errorf("unreachable replica should keep the error")
+	}
+
+	text := topology.Text()
+	for _, want := range []string{
+		"db-a:3306 [master] server_id=1 uuid=uuid-a\n",
+		"|-- db-b:3306 [intermediate] server_id=2 uuid=uuid-b read_only lag=5s\n",
+		"|   `-- 10.0.0.4:3306 [replica] server_id=4 uuid=uuid-d error=\"connection refused\" (reported by master)\n",
+		"`-- server_id=3 [replica]",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("text should contain [%v]. text=\n%v", want, text)
+		}
+	}
+	dot := topology.DOT()
+	if !strings.Contains(dot, `"db-a:3306" -> "db-b:3306" [label="lag=5s"];`) ||
+		!strings.Contains(dot, `"10.0.0.4:3306" [label="10.0.0.4:3306\nreplica\nserver_id=4", style=dashed];`) {
+		t.Errorf("unexpected dot. dot=\n%v", dot)
+	}
+}
+
+func TestDiscoverTopologyCycle(t *testing.T) {
+	// A、B互为主从，C同时从A、B复制
+	a := newTopologyPool(t, "1", "uuid-a", "OFF",
+		[][]driver.Value{{"b", "3306", "2", "uuid-b", "Yes", "Yes", "0", ""}},
+		[][]driver.Value{{"2", "b", "3306", "1", "uuid-b"}, {"3", "c", "3306", "1", "uuid-c"}})
+	pools := map[string]*DBPool{
+		"a": a,
+		"b": newTopologyPool(t, "2", "uuid-b", "ON",
+			[][]driver.Value{{"a", "3306", "1", "uuid-a", "Yes", "No", nil, ""}}, nil),
+		"c": newTopologyPool(t, "3", "uuid-c", "ON", [][]driver.Value{
+			{"a", "3306", "1", "uuid-a", "Yes", "Yes", "1", "from_a"},
+			{"b", "3306", "2", "uuid-b", "Yes", "Yes", "2", "from_b"},
+		}, nil),
+	}
+	topology, err := NewTopologyCrawler(connectTopology(pools)).Discover(a, "a", 3306)
+	if nil != err {
+		t.Fatalf("Discover fail. err=[%v]", err)
+	}
+	if 1 != len(topology.Cycles) || "a:3306,b:3306" != strings.Join(topology.Cycles[0], ",") {
+		t.Errorf("unexpected cycles. cycles=[%v]", topology.Cycles)
+	}
+	if 1 != len(topology.MultiSource) || "c:3306" != topology.MultiSource[0] || 2 != topology.Node("c:3306").Lag {
+		t.Errorf("unexpected multi source. multi_source=[%v]", topology.MultiSource)
+	}
+	if Topology_Co_Master != topology.Node("a:3306").Role || Topology_Replica != topology.Node("c:3306").Role {
+		t.Errorf("unexpected roles. a=[%v] c=[%v]", topology.Node("a:3306").Role, topology.Node("c:3306").Role)
+	}
+	if SECONDS_BEHIND_MASTER_UNKNOWN != topology.Node("b:3306").Lag || 0 != len(topology.Roots()) {
+		t.Errorf("unexpected co-master. node=[%+v]", topology.Node("b:3306"))
+	}
+	text := topology.Text()
+	if 1 != strings.Count(text, "c:3306 [replica]") || !strings.Contains(text, "a:3306 (see above)") ||
+		!strings.Contains(text, "cycle: a:3306, b:3306\n") || !strings.Contains(text, "multi-source: c:3306\n") {
+		t.Errorf("unexpected text. text=\n%v", text)
+	}
+
+	crawler := NewTopologyCrawler(connectTopology(pools))
+	crawler.MaxNodes = 2
+	if topology, err = crawler.Discover(a, "a", 3306); nil != err || !topology.Truncated || 2 != len(topology.Nodes) {
+		t.Errorf("discover should stop at MaxNodes. err=[%v] nodes=[%v]", err, len(topology.Nodes))
+	}
+	if _, err = crawler.Discover(newTopologyPool(t, "x", "", "OFF", nil, nil), "x", 3306); nil == err {
+		t.Errorf("seed probe failure should be returned")
+	}
+}
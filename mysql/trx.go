@@ -0,0 +1,139 @@
+package mysql
+
+/*
+ * 闭包式事务
+ * 1、fn返回nil时提交，返回错误或panic时回滚，panic在回滚后继续抛出
+ * 2、opts可指定隔离级别及只读，为nil时使用REPEATABLE READ，与BeginTrx一致
+ * 3、在fn中调用trx.WithTx开启嵌套事务，通过SAVEPOINT实现，失败时只回滚到对应的SAVEPOINT
+ * 4、trx.AfterCommit注册的函数在最外层事务提交成功后按注册顺序执行，回滚的嵌套事务中注册的函数不会执行
+ *
+ * Demo：
+ *	err := pool.WithTx(ctx, nil, func(trx *Trx) error {
+ *		if _, err := pool.DBExecContext(ctx, trx, "update t set n = n - 1 where id = ?", id); nil != err {
+ *			return err
+ *		}
+ *		trx.AfterCommit(func() { cache.Delete(id) })
+ *		// 嵌套事务失败不影响外层
+ *		if err := trx.WithTx(ctx, func(trx *Trx) error {
+ *			_, err := pool.DBExecContext(ctx, trx, "insert into t_log(id) values(?)", id)
+ *			return err
+ *		}); nil != err {
+ *			log.Log.Warning("Fail to write log. reason=[%v]", err)
+ *		}
+ *		return nil
+ *	})
+ */
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"go-tools/log"
+)
+
+// WithTx传给闭包的事务，实现了Executor
+type Trx struct {
+	*sql.Tx
+	state     *trxState
+	savepoint string // 嵌套事务的SAVEPOINT名，最外层为空
+}
+
+// 同一个事务内各层共享的状态
+type trxState struct {
+	savepointSeq int
+	hooks        []func()
+}
+
+/*
+ * 在事务中执行fn，fn返回nil时提交，否则回滚
+ * opts为nil时使用REPEATABLE READ
+ */
+func (db *DBPool) WithTx(ctx context.Context, opts *sql.TxOptions, fn func(trx *Trx) error) (err error) {
+	if nil == opts {
+		opts = &sql.TxOptions{Isolation: sql.LevelRepeatableRead}
+	}
+	tx, err := db.BeginTx(ctx, opts)
+	if nil != err {
+		log.Log.Warning("Start trx fail. reason=[%v]", err)
+		return err
+	}
+	trx := &Trx{Tx: tx, state: &trxState{}}
+	defer func() {
+		if ri := recover(); nil != ri {
+			trx.rollback()
+			panic(ri)
+		}
+	}()
+	if err = fn(trx); nil != err {
+		trx.rollback()
+		return err
+	}
+	if err = tx.Commit(); nil != err {
+		log.Log.Warning("Commit trx fail. reason=[%v]", err)
+		return err
+	}
+	trx.runHooks()
+	return nil
+}
+
+/*
+ * 嵌套事务，通过SAVEPOINT实现
+ * fn返回nil时RELEASE SAVEPOINT，返回错误或panic时ROLLBACK TO SAVEPOINT
+ */
+func (trx *Trx) WithTx(ctx context.Context, fn func(trx *Trx) error) (err error) {
+	trx.state.savepointSeq++
+	nested := &Trx{
+		Tx:        trx.Tx,
+		state:     trx.state,
+		savepoint: fmt.Sprintf("sp_%d", trx.state.savepointSeq),
+	}
+	if _, err = trx.ExecContext(ctx, "SAVEPOINT "+nested.savepoint); nil != err {
+		log.Log.Warning("Create savepoint fail. savepoint=[%v] reason=[%v]", nested.savepoint, err)
+		return err
+	}
+	hookNum := len(trx.state.hooks)
+	defer func() {
+		if ri := recover(); nil != ri {
+			nested.rollbackTo(ctx, hookNum)
+			panic(ri)
+		}
+	}()
+	if err = fn(nested); nil != err {
+		nested.rollbackTo(ctx, hookNum)
+		return err
+	}
+	if _, err = trx.ExecContext(ctx, "RELEASE SAVEPOINT "+nested.savepoint); nil != err {
+		log.Log.Warning("Release savepoint fail. savepoint=[%v] reason=[%v]", nested.savepoint, err)
+		return err
+	}
+	return nil
+}
+
+// 注册在最外层事务提交成功后执行的函数
+func (trx *Trx) AfterCommit(hook func()) {
+	trx.state.hooks = append(trx.state.hooks, hook)
+}
+
+// 回滚最外层事务
+func (trx *Trx) rollback() {
+	if err := trx.Rollback(); nil != err && sql.ErrTxDone != err {
+		log.Log.Warning("Rollback trx fail. reason=[%v]", err)
+	}
+}
+
+// 回滚到SAVEPOINT，并丢弃嵌套事务中注册的函数
+func (trx *Trx) rollbackTo(ctx context.Context, hookNum int) {
+	trx.state.hooks = trx.state.hooks[:hookNum]
+	if _, err := trx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+trx.savepoint); nil != err {
+		log.Log.Warning("Rollback to savepoint fail. savepoint=[%v] reason=[%v]", trx.savepoint, err)
+	}
+}
+
+// 执行提交后的函数，单个函数panic不影响后续函数
+func (trx *Trx) runHooks() {
+	for _, hook := range trx.state.hooks {
+		func() {
+			defer DoQueryException(hook)
+			hook()
+		}()
+	}
+}
@@ -0,0 +1,113 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"sync/atomic"
+	"testing"
+)
+
+func newTrxPool(t *testing.T) (*DBPool, *fakeServer) {
+	return newFakePool(t, map[string]fakeResult{
+		"update a":                   {rowsAffected: 1},
+		"update b":                   {rowsAffected: 1},
+		"SAVEPOINT sp_1":             {},
+		"RELEASE SAVEPOINT sp_1":     {},
+		"SAVEPOINT sp_2":             {},
+		"ROLLBACK TO SAVEPOINT sp_2": {},
+	})
+}
+
+func TestWithTxCommit(t *testing.T) {
+	pool, server := newTrxPool(t)
+	ctx := context.Background()
+	var hooks []string
+	errNested := errors.New("nested fail")
+	err := pool.WithTx(ctx, &sql.TxOptions{Isolation: sql.LevelReadCommitted, ReadOnly: true}, func(trx *Trx) error {
+		if _, err := pool.DBExecContext(ctx, trx, "update a"); nil != err {
+			return err
+		}
+		trx.AfterCommit(func() { hooks = append(hooks, "outer") })
+		if err := trx.WithTx(ctx, func(trx *Trx) error {
+			trx.AfterCommit(func() { hooks = append(hooks, "sp_1") })
+			return nil
+		}); nil != err {
+			return err
+		}
+		// 嵌套事务失败只回滚到SAVEPOINT，其中注册的函数不会执行
+		if err := trx.WithTx(ctx, func(trx *Trx) error {
+			trx.AfterCommit(func() { hooks = append(hooks, "sp_2") })
+			pool.DBExecContext(ctx, trx, "update b")
+			return errNested
+		}); err != errNested {
+			t.Errorf("nested WithTx err=[%v], want [%v]", err, errNested)
+		}
+		return nil
+	})
+	if nil != err {
+		t.Fatalf("WithTx fail. err=[%v]", err)
+	}
+	want := []string{"update a", "SAVEPOINT sp_1", "RELEASE SAVEPOINT sp_1", "SAVEPOINT sp_2", "update b", "ROLLBACK TO SAVEPOINT sp_2"}
+	if got := server.executedSQL(); !reflect.DeepEqual(want, got) {
+		t.Errorf("executed=[%v], want [%v]", got, want)
+	}
+	if !reflect.DeepEqual([]string{"outer", "sp_1"}, hooks) {
+		t.Errorf("unexpected after commit hooks. hooks=[%v]", hooks)
+	}
+	if 1 != atomic.LoadInt32(&server.commits) || 0 != atomic.LoadInt32(&server.rollbacks) {
+		t.Errorf("commits=[%v] rollbacks=[%v], want 1 commit", server.commits, server.rollbacks)
+	}
+	if !server.txOpts.ReadOnly || driver.IsolationLevel(sql.LevelReadCommitted) != server.txOpts.Isolation {
+		t.Errorf("unexpected tx options. opts=[%+v]", server.txOpts)
+	}
+}
+
+func TestWithTxRollback(t *testing.T) {
+	pool, server := newTrxPool(t)
+	ctx := context.Background()
+	hookCalled := false
+	errFail := errors.New("fail")
+	err := pool.WithTx(ctx, nil, func(trx *Trx) error {
+		trx.AfterCommit(func() { hookCalled = true })
+		return errFail
+	})
+	if err != errFail || hookCalled {
+		t.Errorf("WithTx err=[%v] hookCalled=[%v], want rollback", err, hookCalled)
+	}
+
+	func() {
+		defer func() {
+			if ri := recover(); nil == ri {
+				t.Errorf("panic should be rethrown after rollback")
+			}
+		}()
+		pool.WithTx(ctx, nil, func(trx *Trx) error {
+			panic("boom")
+		})
+	}()
+	if 0 != atomic.LoadInt32(&server.commits) || 2 != atomic.LoadInt32(&server.rollbacks) {
+		t.Errorf("commits=[%v] rollbacks=[%v], want 2 rollbacks", server.commits, server.rollbacks)
+	}
+}
+
+func TestNilExecutor(t *testing.T) {
+	pool, server := newTrxPool(t)
+	for _, exec := range []Executor{(*sql.Tx)(nil), (*sql.Conn)(nil), (*sql.DB)(nil), (*Trx)(nil), &Trx{}} {
+		res, err := pool.DBQueryContext(context.Background(), exec, "select 1")
+		if nil == err || nil != res.Rows {
+			t.Errorf("query with nil executor should fail. type=[%T] err=[%v]", exec, err)
+		}
+		if _, err = pool.DBExecContext(context.Background(), exec, "update a"); nil == err {
+			t.Errorf("exec with nil executor should fail. type=[%T]", exec)
+		}
+		if isSessionExecutor(exec) {
+			t.Errorf("nil executor is not a session. type=[%T]", exec)
+		}
+	}
+	if 0 != len(server.executedSQL()) {
+		t.Errorf("nothing should be executed. executed=[%v]", server.executedSQL())
+	}
+}
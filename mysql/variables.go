@@ -0,0 +1,357 @@
+package mysql
+
+/*
+ * SHOW VARIABLES / SHOW STATUS快照
+ * 1、一次查询获取多个变量或状态，结果为map，按名称大小写不敏感读取
+ * 2、ShowSnapshot使用SHOW语句，TableSnapshot使用performance_schema(MariaDB为information_schema)的表
+ * 3、范围、类型为枚举，LIKE模式只允许字母、数字、_及%，不拼接任意字符串
+ * 4、提供整数、布尔、时长、容量等类型的读取方法
+ *
+ * Demo：
+ *	snapshot, err := pool.ShowSnapshot(nil, Show_Variables, Scope_Global, "innodb_buffer_pool_size", "read_only", "wait_timeout")
+ *	if nil != err {
+ *		return err
+ *	}
+ *	size, err := snapshot.Size("innodb_buffer_pool_size")
+ *	readOnly, err := snapshot.Bool("read_only")
+ *	waitTimeout, err := snapshot.Duration("wait_timeout", time.Second)
+ */
+import (
+	"errors"
+	"fmt"
+	"go-tools/log"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 查询的类型
+type ShowKind int
+
+const (
+	Show_Variables ShowKind = iota
+	Show_Status
+)
+
+func (k ShowKind) String() string {
+	switch k {
+	case Show_Variables:
+		return "VARIABLES"
+	case Show_Status:
+		return "STATUS"
+	}
+	return fmt.Sprintf("ShowKind(%d)", int(k))
+}
+
+// 查询的范围，SESSION只对传入的*sql.Conn或*sql.Tx有意义
+type ShowScope int
+
+const (
+	Scope_Session ShowScope = iota
+	Scope_Global
+)
+
+func (s ShowScope) String() string {
+	switch s {
+	case Scope_Session:
+		return "SESSION"
+	case Scope_Global:
+		return "GLOBAL"
+	}
+	return fmt.Sprintf("ShowScope(%d)", int(s))
+}
+
+// 变量不存在
+var ErrVariableNotFound = errors.New("variable not found")
+
+// LIKE模式允许的字符
+var likePattern = regexp.MustCompile(`^[A-Za-z0-9_%]{1,64}$`)
+
+// 变量或状态快照
+type Snapshot struct {
+	Kind   ShowKind
+	Scope  ShowScope
+	Time   time.Time         // 查询完成的时间
+	Values map[string]string // 名称为数据库返回的原始大小写
+
+	lower map[string]string // 小写名称到值的索引
+}
+
+// 由名称、值构造快照
+func NewSnapshot(kind ShowKind, scope ShowScope, values map[string]string) *Snapshot {
+	snapshot := &Snapshot{
+		Kind:   kind,
+		Scope:  scope,
+		Time:   time.Now(),
+		Values: values,
+		lower:  make(map[string]string, len(values)),
+	}
+	for name, value := range values {
+		snapshot.lower[strings.ToLower(name)] = value
+	}
+	return snapshot
+}
+
+/*
+ * 使用SHOW [GLOBAL|SESSION] {VARIABLES|STATUS}查询，patterns为空时返回全部
+ * patterns为LIKE模式，多个模式之间为或的关系
+ * exec为nil时使用连接池
+ */
+func (db *DBPool) ShowSnapshot(exec Executor, kind ShowKind, scope ShowScope, patterns ...string) (*Snapshot, error) {
+	if err := validateShow(kind, scope, patterns); nil != err {
+		log.Log.Warning("Fail to show %v. reason=[%v]", kind, err)
+		return nil, err
+	}
+	sqlText := fmt.Sprintf("SHOW %v %v", scope, kind)
+	if len(patterns) > 0 {
+		conditions := make([]string, len(patterns))
+		for i, pattern := range patterns {
+			// 模式已校验只包含字母、数字、_及%，可以直接作为字符串常量
+			conditions[i] = fmt.Sprintf("Variable_name LIKE '%v'", pattern)
+		}
+		sqlText += " WHERE " + strings.Join(conditions, " OR ")
+	}
+	return db.querySnapshot(exec, kind, scope, sqlText)
+}
+
+/*
+ * 使用performance_schema.{global|session}_{variables|status}表查询，MariaDB使用information_schema
+ * 表中的名称在部分版本中为大写，通过Snapshot的读取方法访问时不受影响
+ * exec为nil时使用连接池
+ */
+func (db *DBPool) TableSnapshot(exec Executor, kind ShowKind, scope ShowScope, patterns ...string) (*Snapshot, error) {
+	if err := validateShow(kind, scope, patterns); nil != err {
+		log.Log.Warning("Fail to query %v table. reason=[%v]", kind, err)
+		return nil, err
+	}
+	schema := "performance_schema"
+	if Flavor_MariaDB == db.Flavor {
+		schema = "information_schema"
+	}
+	sqlText := fmt.Sprintf("SELECT VARIABLE_NAME, VARIABLE_VALUE FROM %v.%v_%v",
+		schema, strings.ToLower(scope.String()), strings.ToLower(kind.String()))
+	params := make([]interface{}, len(patterns))
+	if len(patterns) > 0 {
+		conditions := make([]string, len(patterns))
+		for i, pattern := range patterns {
+			conditions[i] = "VARIABLE_NAME LIKE ?"
+			params[i] = pattern
+		}
+		sqlText += " WHERE " + strings.Join(conditions, " OR ")
+	}
+	return db.querySnapshot(exec, kind, scope, sqlText, params...)
+}
+
+func validateShow(kind ShowKind, scope ShowScope, patterns []string) error {
+	if Show_Variables != kind && Show_Status != kind {
+		return fmt.Errorf("invalid show kind. kind=[%v]", kind)
+	}
+	if Scope_Session != scope && Scope_Global != scope {
+		return fmt.Errorf("invalid show scope. scope=[%v]", scope)
+	}
+	for _, pattern := range patterns {
+		if !likePattern.MatchString(pattern) {
+			return fmt.Errorf("invalid LIKE pattern, only letters, digits, _ and %% are allowed. pattern=[%v]", pattern)
+		}
+	}
+	return nil
+}
+
+func (db *DBPool) querySnapshot(exec Executor, kind ShowKind, scope ShowScope, sqlText string, params ...interface{}) (*Snapshot, error) {
+	if nil == exec {
+		exec = db.DB
+	}
+	ctx, cancel := timeoutContext(db.rwTimeout())
+	defer cancel()
+	rows, err := exec.QueryContext(ctx, sqlText, params...)
+	if nil != err {
+		log.Log.Warning("Fail to query snapshot. sql=[%v] reason=[%v]", sqlText, err)
+		return nil, err
+	}
+	defer CloseRows(rows)
+	values := make(map[string]string)
+	for rows.Next() {
+		var name string
+		var value *string
+		if err = rows.Scan(&name, &value); nil != err {
+			log.Log.Warning("Fail to scan snapshot. sql=[%v] reason=[%v]", sqlText, err)
+			return nil, err
+		}
+		if nil != value {
+			values[name] = *value
+		} else {
+			values[name] = ""
+		}
+	}
+	if err = rows.Err(); nil != err {
+		log.Log.Warning("Fail to query snapshot. sql=[%v] reason=[%v]", sqlText, err)
+		return nil, err
+	}
+	return NewSnapshot(kind, scope, values), nil
+}
+
+// 名称列表，按名称排序
+func (s *Snapshot) Names() []string {
+	names := make([]string, 0, len(s.Values))
+	for name := range s.Values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// 读取字符串值，名称大小写不敏感
+func (s *Snapshot) Get(name string) (string, bool) {
+	if value, ok := s.Values[name]; ok {
+		return value, true
+	}
+	value, ok := s.lower[strings.ToLower(name)]
+	return value, ok
+}
+
+func (s *Snapshot) lookup(name string) (string, error) {
+	value, ok := s.Get(name)
+	if !ok {
+		return "", fmt.Errorf("%w. name=[%v]", ErrVariableNotFound, name)
+	}
+	return value, nil
+}
+
+// 读取整数值
+func (s *Snapshot) Int(name string) (int64, error) {
+	value, err := s.lookup(name)
+	if nil != err {
+		return 0, err
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if nil != err {
+		return 0, fmt.Errorf("variable is not an integer. name=[%v] value=[%v]", name, value)
+	}
+	return n, nil
+}
+
+// 读取无符号整数值，计数器类状态可能超过int64
+func (s *Snapshot) Uint(name string) (uint64, error) {
+	value, err := s.lookup(name)
+	if nil != err {
+		return 0, err
+	}
+	n, err := strconv.ParseUint(strings.TrimSpace(value), 10, 64)
+	if nil != err {
+		return 0, fmt.Errorf("variable is not an unsigned integer. name=[%v] value=[%v]", name, value)
+	}
+	return n, nil
+}
+
+// 读取浮点值
+func (s *Snapshot) Float(name string) (float64, error) {
+	value, err := s.lookup(name)
+	if nil != err {
+		return 0, err
+	}
+	f, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if nil != err {
+		return 0, fmt.Errorf("variable is not a number. name=[%v] value=[%v]", name, value)
+	}
+	return f, nil
+}
+
+// 读取布尔值，支持ON/OFF、YES/NO、TRUE/FALSE、1/0
+func (s *Snapshot) Bool(name string) (bool, error) {
+	value, err := s.lookup(name)
+	if nil != err {
+		return false, err
+	}
+	switch strings.ToUpper(strings.TrimSpace(value)) {
+	case "ON", "YES", "TRUE", "1":
+		return true, nil
+	case "OFF", "NO", "FALSE", "0":
+		return false, nil
+	}
+	return false, fmt.Errorf("variable is not a boolean. name=[%v] value=[%v]", name, value)
+}
+
+// 读取时长，unit为值的单位，如wait_timeout为time.Second，支持long_query_time等小数
+func (s *Snapshot) Duration(name string, unit time.Duration) (time.Duration, error) {
+	f, err := s.Float(name)
+	if nil != err {
+		return 0, err
+	}
+	if f*float64(unit) > math.MaxInt64 {
+		return 0, fmt.Errorf("variable overflows duration. name=[%v] value=[%v]", name, f)
+	}
+	return time.Duration(f * float64(unit)), nil
+}
+
+// 读取容量，单位字节，兼容配置文件格式的K/M/G/T后缀
+func (s *Snapshot) Size(name string) (int64, error) {
+	value, err := s.lookup(name)
+	if nil != err {
+		return 0, err
+	}
+	size, err := ParseSize(value)
+	if nil != err {
+		return 0, fmt.Errorf("variable is not a size. name=[%v] value=[%v]", name, value)
+	}
+	return size, nil
+}
+
+// 解析容量，如134217728、128M、1G
+func ParseSize(value string) (int64, error) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	multiple := int64(1)
+	if "" != value {
+		switch value[len(value)-1] {
+		case 'K':
+			multiple = 1 << 10
+		case 'M':
+			multiple = 1 << 20
+		case 'G':
+			multiple = 1 << 30
+		case 'T':
+			multiple = 1 << 40
+		}
+		if multiple > 1 {
+			value = value[:len(value)-1]
+		}
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if nil != err {
+		return 0, err
+	}
+	if n < 0 || n > math.MaxInt64/multiple {
+		return 0, fmt.Errorf("size out of range. value=[%v]", value)
+	}
+	return n * multiple, nil
+}
+
+// 解析QueryShow的showTag，如VARIABLES、GLOBAL STATUS
+func parseShowTag(showTag string) (kind ShowKind, scope ShowScope, err error) {
+	words := strings.Fields(strings.ToUpper(showTag))
+	if 2 == len(words) {
+		switch words[0] {
+		case "GLOBAL":
+			scope = Scope_Global
+		case "SESSION", "LOCAL":
+			scope = Scope_Session
+		default:
+			return kind, scope, fmt.Errorf("invalid show scope. tag=[%v]", showTag)
+		}
+		words = words[1:]
+	}
+	if 1 != len(words) {
+		return kind, scope, fmt.Errorf("invalid show tag. tag=[%v]", showTag)
+	}
+	switch words[0] {
+	case "VARIABLES":
+		kind = Show_Variables
+	case "STATUS":
+		kind = Show_Status
+	default:
+		return kind, scope, fmt.Errorf("invalid show kind. tag=[%v]", showTag)
+	}
+	return kind, scope, nil
+}
@@ -0,0 +1,112 @@
+package mysql
+
+import (
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestShowSnapshot(t *testing.T) {
+	sqlText := "SHOW GLOBAL VARIABLES WHERE Variable_name LIKE 'read_only' OR Variable_name LIKE 'innodb%'"
+	pool, _ := newFakePool(t, map[string]fakeResult{
+		sqlText: {
+			columns: []string{"Variable_name", "Value"},
+			rows: [][]driver.Value{
+				{"read_only", "ON"},
+				{"innodb_buffer_pool_size", "134217728"},
+				{"innodb_lock_wait_timeout", "50"},
+			},
+		},
+	})
+	snapshot, err := pool.ShowSnapshot(nil, Show_Variables, Scope_Global, "read_only", "innodb%")
+	if nil != err {
+		t.Fatalf("ShowSnapshot fail. err=[%v]", err)
+	}
+	if readOnly, err := snapshot.Bool("READ_ONLY"); nil != err || !readOnly {
+		t.Errorf("unexpected read_only. value=[%v] err=[%v]", readOnly, err)
+	}
+	if size, err := snapshot.Size("innodb_buffer_pool_size"); nil != err || 128<<20 != size {
+		t.Errorf("unexpected buffer pool size. size=[%v] err=[%v]", size, err)
+	}
+	if timeout, err := snapshot.Duration("innodb_lock_wait_timeout", time.Second); nil != err || 50*time.Second != timeout {
+		t.Errorf("unexpected lock wait timeout. timeout=[%v] err=[%v]", timeout, err)
+	}
+	if _, err := snapshot.Int("read_only"); nil == err {
+		t.Errorf("ON should not be parsed as integer")
+	}
+	if _, err := snapshot.Int("max_connections"); !errors.Is(err, ErrVariableNotFound) {
+		t.Errorf("expect ErrVariableNotFound. err=[%v]", err)
+	}
+
+	for _, pattern := range []string{"a' OR 1=1 -- ", "a\\", ""} {
+		if _, err := pool.ShowSnapshot(nil, Show_Variables, Scope_Global, pattern); nil == err {
+			t.Errorf("pattern should be rejected. pattern=[%v]", pattern)
+		}
+	}
+	if _, err := pool.ShowSnapshot(nil, ShowKind(9), Scope_Global); nil == err {
+		t.Errorf("invalid kind should be rejected")
+	}
+}
+
+func TestTableSnapshot(t *testing.T) {
+	pool, server := newFakePool(t, map[string]fakeResult{
+		"SELECT VARIABLE_NAME, VARIABLE_VALUE FROM performance_schema.global_status WHERE VARIABLE_NAME LIKE ?": {
+			columns: []string{"VARIABLE_NAME", "VARIABLE_VALUE"},
+			rows:    [][]driver.Value{{"COM_SELECT", "18446744073709551615"}},
+		},
+		"SELECT VARIABLE_NAME, VARIABLE_VALUE FROM information_schema.session_variables": {
+			columns: []string{"VARIABLE_NAME", "VARIABLE_VALUE"},
+			rows:    [][]driver.Value{{"LONG_QUERY_TIME", "0.500000"}},
+		},
+	})
+	snapshot, err := pool.TableSnapshot(nil, Show_Status, Scope_Global, "Com_select")
+	if nil != err {
+		t.Fatalf("TableSnapshot fail. err=[%v]", err)
+	}
+	if n, err := snapshot.Uint("Com_select"); nil != err || 18446744073709551615 != n {
+		t.Errorf("unexpected Com_select. value=[%v] err=[%v]", n, err)
+	}
+
+	pool.Flavor = Flavor_MariaDB
+	snapshot, err = pool.TableSnapshot(nil, Show_Variables, Scope_Session)
+	if nil != err {
+		t.Fatalf("TableSnapshot on MariaDB fail. err=[%v] executed=[%v]", err, server.executedSQL())
+	}
+	if d, err := snapshot.Duration("long_query_time", time.Second); nil != err || 500*time.Millisecond != d {
+		t.Errorf("unexpected long_query_time. value=[%v] err=[%v]", d, err)
+	}
+}
+
+func TestQueryShow(t *testing.T) {
+	pool, _ := newFakePool(t, map[string]fakeResult{
+		"SHOW SESSION STATUS WHERE Variable_name LIKE 'Threads%'": {
+			columns: []string{"Variable_name", "Value"},
+			rows:    [][]driver.Value{{"Threads_running", "3"}, {"Threads_connected", "10"}},
+		},
+	})
+	value, err := pool.QueryShow(nil, "status", "Threads%")
+	if nil != err || "10" != value {
+		t.Errorf("unexpected value. value=[%v] err=[%v]", value, err)
+	}
+	if _, err = pool.QueryShow(nil, "STATUS; DROP TABLE t", "a"); nil == err {
+		t.Errorf("invalid show tag should be rejected")
+	}
+	if _, err = pool.QueryShow(nil, "GLOBAL STATUS", "a' or '1"); nil == err {
+		t.Errorf("invalid variable name should be rejected")
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	cases := map[string]int64{"1024": 1024, "128M": 128 << 20, "1g": 1 << 30, " 2K ": 2048}
+	for value, want := range cases {
+		if got, err := ParseSize(value); nil != err || want != got {
+			t.Errorf("ParseSize(%q)=[%v] err=[%v], want [%v]", value, got, err, want)
+		}
+	}
+	for _, value := range []string{"", "M", "-1", "abc", "9999999999T"} {
+		if _, err := ParseSize(value); nil == err {
+			t.Errorf("ParseSize(%q) should fail", value)
+		}
+	}
+}